@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
 )
 
 var normalizeInsertQueryMatch = regexp.MustCompile(`(?i)(?:(?:--[^\n]*|#![^\n]*|#\s[^\n]*)\n\s*)*(INSERT\s+INTO\s+([^(]+)(?:\s*\([^()]*(?:\([^()]*\)[^()]*)*\))?)(?:\s*VALUES)?`)
@@ -48,3 +51,123 @@ func extractInsertQueryComponents(query string) (insertStmt string, tableName st
 
 	return
 }
+
+// columnDefaults returns the columns of a table description that have a default expression.
+func columnDefaults(columns []proto.ColumnDescription) []driver.ColumnDefault {
+	var defaults []driver.ColumnDefault
+	for _, col := range columns {
+		if col.DefaultKind == "" {
+			continue
+		}
+		defaults = append(defaults, driver.ColumnDefault{
+			Name:       col.Name,
+			Type:       col.Type,
+			Kind:       col.DefaultKind,
+			Expression: col.DefaultExpression,
+		})
+	}
+	return defaults
+}
+
+// omittableColumns returns the columns an INSERT may leave out, for the
+// server to fill with their DEFAULT or EPHEMERAL expression.
+func omittableColumns(defaults []driver.ColumnDefault) map[string]bool {
+	omittable := make(map[string]bool, len(defaults))
+	for _, d := range defaults {
+		if d.Kind == "DEFAULT" || d.Kind == "EPHEMERAL" {
+			omittable[d.Name] = true
+		}
+	}
+	return omittable
+}
+
+// insertColumnsForValues returns the columns to insert when the first row of
+// a batch has n values for the given columns: the columns without a default if
+// n matches their number, or nil to insert all columns.
+func insertColumnsForValues(columns []string, defaults []driver.ColumnDefault, n int) []string {
+	if n >= len(columns) || len(defaults) == 0 {
+		return nil
+	}
+	omittable := omittableColumns(defaults)
+	required := make([]string, 0, n)
+	for _, name := range columns {
+		if !omittable[name] {
+			required = append(required, name)
+		}
+	}
+	if len(required) != n {
+		return nil
+	}
+	return required
+}
+
+// insertColumnsForStruct returns the columns to insert when the struct of the
+// first row of a batch only has fields for some of the given columns: those
+// columns if all the others have a default, or nil to insert all columns.
+func insertColumnsForStruct(columns []string, defaults []driver.ColumnDefault, fields map[string][]int) []string {
+	if fields == nil || len(defaults) == 0 {
+		return nil
+	}
+	omittable := omittableColumns(defaults)
+	present := make([]string, 0, len(columns))
+	for _, name := range columns {
+		if _, ok := fields[name]; ok {
+			present = append(present, name)
+			continue
+		}
+		if !omittable[name] {
+			return nil
+		}
+	}
+	if len(present) == len(columns) || len(present) == 0 {
+		return nil
+	}
+	return present
+}
+
+// insertQueryWithColumns returns the INSERT of the batch into table restricted to columns.
+func insertQueryWithColumns(table string, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, name := range columns {
+		quoted[i] = "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(name) + "`"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) FORMAT Native", table, strings.Join(quoted, ", "))
+}
+
+// blockWithColumns returns an empty block with the given columns of block.
+func blockWithColumns(block *proto.Block, columns []string) (*proto.Block, error) {
+	narrowed := &proto.Block{Packet: block.Packet, ServerContext: block.ServerContext}
+	for _, name := range columns {
+		for _, col := range block.Columns {
+			if col.Name() == name {
+				if err := narrowed.AddColumn(name, col.Type()); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+	return narrowed, nil
+}
+
+// insertDeduplicationToken returns the insert_deduplication_token of block seq of the batch batchID.
+func insertDeduplicationToken(batchID string, seq int) string {
+	return fmt.Sprintf("%s:%d", batchID, seq)
+}
+
+// checkBatchSize makes room for the next row of a batch limited to maxBytes,
+// flushing it if flush is set and returning ErrBatchFull otherwise.
+func checkBatchSize(b driver.SizedBatch, maxBytes int, flush bool) error {
+	if maxBytes <= 0 || b.Size() < maxBytes {
+		return nil
+	}
+	if flush {
+		if err := b.Flush(); err != nil {
+			return err
+		}
+		if b.Size() < maxBytes {
+			return nil
+		}
+	}
+	return ErrBatchFull
+}
@@ -0,0 +1,166 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// fakeBatchConn prepares fakeBatches, recording the rows they send. It is
+// the conn of the tests of BufferedInserter, ParallelBatch and ShardedBatch.
+type fakeBatchConn struct {
+	driver.Conn
+	mu      sync.Mutex
+	options []driver.PrepareBatchOptions
+	sent    [][]any
+	sendErr error
+	// columns are the columns of the batches, which take a value for each.
+	columns []column.Interface
+	// sending, when set, blocks Send until it is closed.
+	sending chan struct{}
+	// truncate makes the batches take back the rows that fail to convert to
+	// the columns, as the batches of this package do.
+	truncate bool
+}
+
+func (c *fakeBatchConn) PrepareBatch(_ context.Context, _ string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.options = append(c.options, getPrepareBatchOptions(opts...))
+	return &fakeBatch{conn: c}, nil
+}
+
+func (c *fakeBatchConn) ServerVersion() (*driver.ServerVersion, error) {
+	return &driver.ServerVersion{Timezone: time.UTC}, nil
+}
+
+func (c *fakeBatchConn) prepared() []driver.PrepareBatchOptions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.options)
+}
+
+func (c *fakeBatchConn) batches() [][]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.sent)
+}
+
+// fakeBatch records the values of rows with a single column, and the
+// values or the struct of the others.
+type fakeBatch struct {
+	driver.Batch
+	conn    *fakeBatchConn
+	rows    []any
+	flushed []any
+	sent    bool
+}
+
+func (b *fakeBatch) Append(v ...any) error {
+	switch columns := len(b.conn.columns); {
+	case columns <= 1 && len(v) == 1:
+		b.rows = append(b.rows, v[0])
+	case columns > 1 && len(v) == columns:
+		b.rows = append(b.rows, v)
+	default:
+		return errors.New("unexpected number of columns")
+	}
+	return nil
+}
+
+func (b *fakeBatch) AppendStruct(v any) error {
+	if len(b.conn.columns) != 0 {
+		b.rows = append(b.rows, v)
+		return nil
+	}
+	return b.Append(v)
+}
+
+func (b *fakeBatch) appendRow(v []any) (bool, error) {
+	block := newCheckBlock(&column.ServerContext{Timezone: time.UTC}, b.conn.columns)
+	if err := block.Append(v...); err != nil {
+		return true, err
+	}
+	return false, b.Append(v...)
+}
+
+func (b *fakeBatch) truncatable() bool {
+	return b.conn.truncate
+}
+
+func (b *fakeBatch) Columns() []column.Interface {
+	return b.conn.columns
+}
+
+func (b *fakeBatch) ColumnDefaults() []driver.ColumnDefault {
+	return nil
+}
+
+func (b *fakeBatch) Rows() int {
+	return len(b.rows)
+}
+
+// Size counts the bytes of string rows and a byte for the others.
+func (b *fakeBatch) Size() int {
+	size := 0
+	for _, row := range b.rows {
+		if s, ok := row.(string); ok {
+			size += len(s)
+		}
+		size++
+	}
+	return size
+}
+
+func (b *fakeBatch) Flush() error {
+	b.flushed, b.rows = append(b.flushed, b.rows...), nil
+	return nil
+}
+
+func (b *fakeBatch) IsSent() bool {
+	return b.sent
+}
+
+func (b *fakeBatch) Abort() error {
+	b.sent = true
+	return nil
+}
+
+func (b *fakeBatch) Close() error {
+	b.sent = true
+	return nil
+}
+
+func (b *fakeBatch) Send() error {
+	if b.conn.sending != nil {
+		<-b.conn.sending
+	}
+	b.conn.mu.Lock()
+	defer b.conn.mu.Unlock()
+	if b.conn.sendErr != nil {
+		return b.conn.sendErr
+	}
+	b.sent = true
+	b.conn.sent = append(b.conn.sent, append(b.flushed, b.rows...))
+	return nil
+}
+
+// newFakeBatchConn returns a fakeBatchConn of batches with the given
+// columns, as pairs of a name and a type.
+func newFakeBatchConn(t *testing.T, columns ...string) *fakeBatchConn {
+	conn := &fakeBatchConn{}
+	for i := 0; i < len(columns); i += 2 {
+		col, err := column.Type(columns[i+1]).Column(columns[i], &column.ServerContext{Timezone: time.UTC})
+		require.NoError(t, err)
+		conn.columns = append(conn.columns, col)
+	}
+	return conn
+}
@@ -1,9 +1,21 @@
 package clickhouse
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	chproto "github.com/ClickHouse/ch-go/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
 )
 
 func TestExtractNormalizedInsertQueryAndColumns(t *testing.T) {
@@ -411,3 +423,351 @@ INSERT INTO ` + "`_test_1345# $.ДБ`.`2. Таблица №2`" + ` (col1, col2)
 		})
 	}
 }
+
+var testColumnDefaults = []driver.ColumnDefault{
+	{Name: "created", Type: "DateTime", Kind: "DEFAULT", Expression: "now()"},
+	{Name: "raw", Type: "String", Kind: "EPHEMERAL", Expression: "''"},
+	{Name: "doubled", Type: "Int64", Kind: "MATERIALIZED", Expression: "id * 2"},
+}
+
+func TestInsertColumns(t *testing.T) {
+	columns := []string{"id", "created", "name", "raw"}
+
+	assert.Equal(t, []string{"id", "name"}, insertColumnsForValues(columns, testColumnDefaults, 2))
+	assert.Nil(t, insertColumnsForValues(columns, testColumnDefaults, 4))
+	assert.Nil(t, insertColumnsForValues(columns, testColumnDefaults, 3))
+	assert.Nil(t, insertColumnsForValues(columns, nil, 2))
+
+	fields := func(names ...string) map[string][]int {
+		index := make(map[string][]int)
+		for i, name := range names {
+			index[name] = []int{i}
+		}
+		return index
+	}
+	assert.Equal(t, []string{"id", "name"}, insertColumnsForStruct(columns, testColumnDefaults, fields("id", "name")))
+	assert.Equal(t, []string{"id", "name", "raw"}, insertColumnsForStruct(columns, testColumnDefaults, fields("id", "name", "raw", "other")))
+	assert.Nil(t, insertColumnsForStruct(columns, testColumnDefaults, fields("id", "created", "name", "raw")))
+	// name has no default, so the struct is missing a field
+	assert.Nil(t, insertColumnsForStruct(columns, testColumnDefaults, fields("id")))
+	assert.Nil(t, insertColumnsForStruct(columns, testColumnDefaults, nil))
+
+	assert.Equal(t, "INSERT INTO db.t (`id`, `we\\`ird`) FORMAT Native", insertQueryWithColumns("db.t", []string{"id", "we`ird"}))
+}
+
+func TestHTTPBatchOmitsDefaultColumns(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		queries = append(queries, r.URL.Query().Get("query"))
+	}))
+	defer srv.Close()
+
+	newBatch := func(omitDefaults bool) *httpBatch {
+		block := &proto.Block{ServerContext: &column.ServerContext{}}
+		require.NoError(t, block.AddColumn("id", "Int64"))
+		require.NoError(t, block.AddColumn("created", "DateTime"))
+		require.NoError(t, block.AddColumn("name", "String"))
+		return &httpBatch{
+			ctx:          t.Context(),
+			conn:         newTestHTTPConnect(t, srv.URL),
+			connRelease:  func(nativeTransport, error) {},
+			structMap:    &structMap{},
+			block:        block,
+			query:        "INSERT INTO t FORMAT Native",
+			table:        "t",
+			defaults:     testColumnDefaults,
+			omitDefaults: omitDefaults,
+		}
+	}
+
+	b := newBatch(false)
+	assert.Equal(t, testColumnDefaults, b.ColumnDefaults())
+	// short rows need WithOmitDefaultColumns
+	assert.Error(t, b.Append(int64(1), "a"))
+
+	b = newBatch(true)
+	require.NoError(t, b.Append(int64(1), "a"))
+	require.NoError(t, b.Append(int64(2), "b"))
+	assert.Equal(t, []string{"id", "name"}, b.block.ColumnsNames())
+	// the batch keeps the columns of its first row
+	assert.Error(t, b.Append(int64(3), nil, "c"))
+
+	type record struct {
+		ID   int64  `ch:"id"`
+		Name string `ch:"name"`
+	}
+	// so do structs without a field for the columns
+	assert.Error(t, newBatch(false).AppendStruct(&record{ID: 1, Name: "a"}))
+
+	b = newBatch(true)
+	require.NoError(t, b.AppendStruct(&record{ID: 1, Name: "a"}))
+	require.NoError(t, b.Send())
+
+	b = newBatch(false)
+	require.NoError(t, b.Append(int64(1), nil, "a"))
+	require.NoError(t, b.Send())
+
+	assert.Equal(t, []string{
+		"INSERT INTO t (`id`, `name`) FORMAT Native",
+		"INSERT INTO t FORMAT Native",
+	}, queries)
+}
+
+func TestHTTPBatchAppendRow(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	newBatch := func(chType column.Type) *httpBatch {
+		block := &proto.Block{ServerContext: &column.ServerContext{}}
+		require.NoError(t, block.AddColumn("id", "Int64"))
+		require.NoError(t, block.AddColumn("tags", chType))
+		return &httpBatch{
+			ctx:         t.Context(),
+			conn:        newTestHTTPConnect(t, srv.URL),
+			connRelease: func(nativeTransport, error) {},
+			structMap:   &structMap{},
+			block:       block,
+			query:       "INSERT INTO t FORMAT Native",
+			table:       "t",
+		}
+	}
+
+	b := newBatch("Array(String)")
+	assert.True(t, b.truncatable())
+	require.NoError(t, b.Append(int64(1), []string{"a"}))
+	// the id of the bad row is taken back with it
+	kept, err := b.appendRow([]any{int64(2), "b"})
+	assert.Error(t, err)
+	assert.True(t, kept)
+	kept, err = b.appendRow([]any{int64(3), []string{"c"}})
+	require.NoError(t, err)
+	assert.False(t, kept)
+	assert.Equal(t, 2, b.Rows())
+	require.NoError(t, b.Send())
+
+	want := newBatch("Array(String)")
+	require.NoError(t, want.Append(int64(1), []string{"a"}))
+	require.NoError(t, want.Append(int64(3), []string{"c"}))
+	sent := body
+	require.NoError(t, want.Send())
+	assert.Equal(t, body, sent)
+
+	// Append leaves the batch unusable instead
+	b = newBatch("Array(String)")
+	require.NoError(t, b.Append(int64(1), []string{"a"}))
+	assert.Error(t, b.Append(int64(2), "b"))
+	assert.ErrorIs(t, b.Append(int64(3), []string{"c"}), ErrBatchInvalid)
+
+	// so does appendRow if a column can't be truncated
+	b = newBatch("Array(LowCardinality(String))")
+	assert.False(t, b.truncatable())
+	kept, err = b.appendRow([]any{int64(2), "b"})
+	assert.Error(t, err)
+	assert.False(t, kept)
+	assert.ErrorIs(t, b.Append(int64(3), []string{"c"}), ErrBatchInvalid)
+}
+
+func TestBatchDeduplicationToken(t *testing.T) {
+	b := &batch{ctx: t.Context(), dedupID: "batch-1", dedupSeq: 2}
+	options := b.queryOptions()
+	assert.Equal(t, "batch-1:2", options.settings["insert_deduplication_token"])
+
+	b = &batch{ctx: t.Context()}
+	options = b.queryOptions()
+	assert.NotContains(t, options.settings, "insert_deduplication_token")
+
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		tokens = append(tokens, r.URL.Query().Get("insert_deduplication_token"))
+	}))
+	defer srv.Close()
+
+	h := newTestHTTPConnect(t, srv.URL)
+	ctx := Context(t.Context(), WithColumnNamesAndTypes([]ColumnNameAndType{{Name: "a", Type: "Int64"}}))
+	for _, opts := range []driver.PrepareBatchOptions{{InsertDeduplicationToken: "batch-1"}, {}} {
+		batch, err := h.prepareBatch(ctx, func(nativeTransport, error) {}, nil, "INSERT INTO t (a)", opts)
+		require.NoError(t, err)
+		require.NoError(t, batch.Append(int64(1)))
+		// with a token, each Flush is an INSERT of its own
+		require.NoError(t, batch.Flush())
+		require.NoError(t, batch.Append(int64(2)))
+		require.NoError(t, batch.Send())
+	}
+	assert.Equal(t, []string{"batch-1:0", "batch-1:1", ""}, tokens)
+}
+
+type sizedBatch struct {
+	driver.Batch
+	size    int
+	flushes int
+}
+
+func (b *sizedBatch) Size() int {
+	return b.size
+}
+
+func (b *sizedBatch) Flush() error {
+	b.flushes++
+	b.size = 0
+	return nil
+}
+
+func TestBatchMaxBytes(t *testing.T) {
+	b := &sizedBatch{size: 10}
+	assert.NoError(t, checkBatchSize(b, 0, false))
+	assert.NoError(t, checkBatchSize(b, 11, false))
+	assert.ErrorIs(t, checkBatchSize(b, 10, false), ErrBatchFull)
+	assert.NoError(t, checkBatchSize(b, 10, true))
+	assert.Equal(t, 1, b.flushes)
+	assert.Equal(t, 0, b.size)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	defer srv.Close()
+
+	h := newTestHTTPConnect(t, srv.URL)
+	ctx := Context(t.Context(), WithColumnNamesAndTypes([]ColumnNameAndType{{Name: "a", Type: "Int64"}, {Name: "b", Type: "String"}}))
+	for _, opt := range []driver.PrepareBatchOption{driver.WithMaxBytes(25), driver.WithFlushOnMaxBytes(25)} {
+		var opts driver.PrepareBatchOptions
+		opt(&opts)
+		prepared, err := h.prepareBatch(ctx, func(nativeTransport, error) {}, nil, "INSERT INTO t (a, b)", opts)
+		require.NoError(t, err)
+		batch := prepared.(driver.SizedBatch)
+		assert.Equal(t, 0, batch.Size())
+		require.NoError(t, batch.Append(int64(1), "abc"))
+		assert.Equal(t, 8+4, batch.Size())
+		// the row reaching the limit is appended, the next one is rejected or flushes the batch
+		require.NoError(t, batch.Append(int64(2), "defghi"))
+		assert.Equal(t, 2*8+4+7, batch.Size())
+		if opts.FlushOnMaxBytes {
+			require.NoError(t, batch.Append(int64(3), ""))
+			assert.Equal(t, 1, batch.Rows())
+		} else {
+			assert.ErrorIs(t, batch.Append(int64(3), ""), ErrBatchFull)
+			assert.Equal(t, 2, batch.Rows())
+		}
+		require.NoError(t, batch.Send())
+	}
+}
+
+func TestHTTPBatchFlushStreams(t *testing.T) {
+	var (
+		requests int
+		received = make(chan struct{})
+		body     bytes.Buffer
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		buf := make([]byte, 1024)
+		for first := true; ; first = false {
+			n, err := r.Body.Read(buf)
+			body.Write(buf[:n])
+			if first {
+				close(received)
+			}
+			if err != nil {
+				break
+			}
+		}
+	}))
+	defer srv.Close()
+
+	h := newTestHTTPConnect(t, srv.URL)
+	ctx := Context(t.Context(), WithColumnNamesAndTypes([]ColumnNameAndType{{Name: "a", Type: "Int64"}, {Name: "b", Type: "String"}}))
+	batch, err := h.prepareBatch(ctx, func(nativeTransport, error) {}, nil, "INSERT INTO t (a, b)", driver.PrepareBatchOptions{})
+	require.NoError(t, err)
+	require.NoError(t, batch.Append(int64(1), "a"))
+	require.NoError(t, batch.Append(int64(2), "b"))
+	require.NoError(t, batch.Flush())
+	assert.Equal(t, 0, batch.Rows())
+	// the server gets the flushed rows before the batch is sent
+	<-received
+	require.NoError(t, batch.Append(int64(3), "c"))
+	require.NoError(t, batch.Send())
+	assert.Equal(t, 1, requests)
+
+	reader := chproto.NewReader(&body)
+	var values []int64
+	for {
+		block := proto.Block{ServerContext: &column.ServerContext{}}
+		if err := block.Decode(reader, 0); err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+		for i := 0; i < block.Rows(); i++ {
+			values = append(values, block.Columns[0].Row(i, false).(int64))
+		}
+	}
+	assert.Equal(t, []int64{1, 2, 3}, values)
+}
+
+func TestHTTPBatchFlushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-ClickHouse-Exception-Code", "53")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("Code: 53. DB::Exception: Type mismatch. (TYPE_MISMATCH)"))
+	}))
+	defer srv.Close()
+
+	h := newTestHTTPConnect(t, srv.URL)
+	var released error
+	ctx := Context(t.Context(), WithColumnNamesAndTypes([]ColumnNameAndType{{Name: "a", Type: "Int64"}}))
+	batch, err := h.prepareBatch(ctx, func(_ nativeTransport, err error) { released = err }, nil, "INSERT INTO t (a)", driver.PrepareBatchOptions{})
+	require.NoError(t, err)
+	var ex *Exception
+	// a Flush after the server failed the request returns its error
+	deadline := time.Now().Add(5 * time.Second)
+	for err == nil && time.Now().Before(deadline) {
+		require.NoError(t, batch.Append(int64(1)))
+		err = batch.Flush()
+	}
+	require.ErrorAs(t, err, &ex)
+	assert.Equal(t, int32(53), ex.Code)
+	assert.True(t, errors.Is(released, err))
+	assert.ErrorIs(t, batch.Send(), err)
+}
+
+func TestHTTPBatchSendRetry(t *testing.T) {
+	var (
+		attempts int
+		values   []int64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts++; attempts == 1 {
+			// fail before reading the body, while the batch may still be writing it
+			w.Header().Set("X-ClickHouse-Exception-Code", "209")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("Code: 209. DB::Exception: Timeout exceeded while reading from socket. (SOCKET_TIMEOUT)"))
+			return
+		}
+		reader := chproto.NewReader(r.Body)
+		for {
+			block := proto.Block{ServerContext: &column.ServerContext{}}
+			if err := block.Decode(reader, 0); err != nil {
+				break
+			}
+			for i := 0; i < block.Rows(); i++ {
+				values = append(values, block.Columns[0].Row(i, false).(int64))
+			}
+		}
+	}))
+	defer srv.Close()
+
+	h := newTestHTTPConnect(t, srv.URL)
+	h.opt.RetryPolicy = &RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return 0 }}
+	ctx := Context(t.Context(), WithColumnNamesAndTypes([]ColumnNameAndType{{Name: "a", Type: "Int64"}}))
+	batch, err := h.prepareBatch(ctx, func(nativeTransport, error) {}, nil, "INSERT INTO t (a)", driver.PrepareBatchOptions{})
+	require.NoError(t, err)
+	for i := range 10_000 {
+		require.NoError(t, batch.Append(int64(i)))
+	}
+	require.NoError(t, batch.Send())
+	assert.Equal(t, 2, attempts)
+	assert.Len(t, values, 10_000)
+}
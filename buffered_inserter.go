@@ -0,0 +1,397 @@
+package clickhouse
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+// BufferedInserterOptions configures a BufferedInserter.
+type BufferedInserterOptions struct {
+	// MaxRows sends the buffered rows once there are this many.
+	// Defaults to 10000.
+	MaxRows int
+	// MaxBytes sends the buffered rows once their approximate encoded size
+	// (see driver.SizedBatch) reaches this many bytes. Zero disables the limit.
+	MaxBytes int
+	// FlushInterval sends the buffered rows at least this often.
+	// Defaults to 1 second.
+	FlushInterval time.Duration
+	// MaxPendingFlushes is how many full buffers may wait to be sent. Once
+	// they are all waiting, Append blocks until one has been sent.
+	// Defaults to 1.
+	MaxPendingFlushes int
+	// OnError is called from the background sender with the error and the
+	// number of rows of each buffer that failed to be inserted. Set
+	// Options.RetryPolicy to retry transient failures before that.
+	OnError func(err error, rows int)
+	// Context is used to prepare and send the batches, e.g. to pass
+	// settings with clickhouse.Context. Defaults to context.Background().
+	Context context.Context
+	// PrepareBatchOptions are passed to PrepareBatch, in addition to
+	// driver.WithReleaseConnection.
+	PrepareBatchOptions []driver.PrepareBatchOption
+}
+
+// BufferedInserter collects rows appended from any number of goroutines
+// and inserts them in the background, sending a batch whenever MaxRows,
+// MaxBytes or FlushInterval is reached:
+//
+//	inserter, err := clickhouse.NewBufferedInserter(conn, "INSERT INTO events", clickhouse.BufferedInserterOptions{
+//		OnError: func(err error, rows int) { log.Printf("lost %d rows: %v", rows, err) },
+//	})
+//	...
+//	err = inserter.AppendStruct(&event)
+//	...
+//	err = inserter.Close() // sends the remaining rows
+//
+// Batches are prepared with driver.WithReleaseConnection, so the inserter
+// only holds a connection while it sends. They are sent one at a time, in
+// the order they were filled.
+type BufferedInserter struct {
+	conn  driver.Conn
+	query string
+	opt   BufferedInserterOptions
+
+	mu     sync.Mutex
+	batch  driver.Batch
+	rows   int
+	closed bool
+	// columns has the names of the columns of batch once its first row is
+	// appended. The next rows are appended with appendRow if the batch can
+	// take back a row that fails to convert, or else converted with check
+	// first, as such a row leaves the batch unusable.
+	columns  []string
+	truncate bool
+	check    *proto.Block
+	server   *column.ServerContext
+	structs  structMap
+
+	// pending are the buffers waiting to be sent, at most MaxPendingFlushes
+	// of them. cond is broadcast when one is added or taken to be sent.
+	pending []pendingFlush
+	cond    *sync.Cond
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+type pendingFlush struct {
+	batch driver.Batch
+	rows  int
+	// result receives the error of sending batch when the flush was
+	// requested by Flush or Close, rather than passing it to OnError.
+	result chan error
+	// last is set on the flush of Close, after which the sender stops.
+	last bool
+}
+
+// rowBatch is implemented by the batches of this package, which can take
+// back a row that fails to convert when their columns can be truncated (see
+// proto.Block.Truncate).
+type rowBatch interface {
+	driver.Batch
+	appendRow(v []any) (kept bool, err error)
+	truncatable() bool
+}
+
+var (
+	_ rowBatch = (*batch)(nil)
+	_ rowBatch = (*httpBatch)(nil)
+)
+
+// NewBufferedInserter returns a BufferedInserter sending rows with the
+// INSERT query to conn. The query is prepared when the first row of each
+// batch is appended.
+func NewBufferedInserter(conn driver.Conn, query string, opt BufferedInserterOptions) *BufferedInserter {
+	if opt.MaxRows <= 0 {
+		opt.MaxRows = 10_000
+	}
+	if opt.FlushInterval <= 0 {
+		opt.FlushInterval = time.Second
+	}
+	if opt.MaxPendingFlushes <= 0 {
+		opt.MaxPendingFlushes = 1
+	}
+	if opt.Context == nil {
+		opt.Context = context.Background()
+	}
+	b := &BufferedInserter{
+		conn:  conn,
+		query: query,
+		opt:   opt,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	go b.send()
+	go b.tick()
+	return b
+}
+
+// Append buffers a row. It blocks while MaxPendingFlushes buffers are
+// waiting to be sent. A row that fails to convert to the columns of the
+// INSERT is not buffered and its error is returned; the rows buffered before
+// it are kept.
+func (b *BufferedInserter) Append(v ...any) error {
+	return b.append(
+		func([]string) ([]any, error) { return v, nil },
+		func(batch driver.Batch) error { return batch.Append(v...) },
+	)
+}
+
+// AppendStruct buffers a row from the fields of the struct v points to,
+// like Append.
+func (b *BufferedInserter) AppendStruct(v any) error {
+	return b.append(
+		func(columns []string) ([]any, error) { return b.structs.Map("AppendStruct", columns, v, false) },
+		func(batch driver.Batch) error { return batch.AppendStruct(v) },
+	)
+}
+
+// append appends a row to the batch with fn, or with its values for the
+// columns of the batch once it has rows (see appendNext). The batch is
+// prepared, and OnError called, without holding b.mu.
+func (b *BufferedInserter) append(values func(columns []string) ([]any, error), fn func(driver.Batch) error) error {
+	b.mu.Lock()
+	for {
+		if b.closed {
+			b.mu.Unlock()
+			return ErrBufferedInserterClosed
+		}
+		if len(b.pending) >= b.opt.MaxPendingFlushes {
+			b.cond.Wait()
+			continue
+		}
+		if b.batch != nil {
+			break
+		}
+		server := b.server
+		b.mu.Unlock()
+		batch, server, err := b.prepare(server)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		b.server = server
+		if b.batch == nil && !b.closed {
+			b.batch = batch
+			continue
+		}
+		// another goroutine prepared a batch meanwhile, or Close was called
+		b.mu.Unlock()
+		batch.Abort()
+		b.mu.Lock()
+	}
+	var (
+		kept bool
+		err  error
+	)
+	if b.rows == 0 {
+		err = fn(b.batch)
+	} else {
+		kept, err = b.appendNext(values, fn)
+	}
+	if kept {
+		b.mu.Unlock()
+		return err
+	}
+	if err != nil {
+		// the batch is unusable: this is its first row, which is not checked,
+		// or the batch failed to flush
+		failed := b.take(nil)
+		b.mu.Unlock()
+		failed.batch.Abort()
+		if failed.rows > 0 && b.opt.OnError != nil {
+			b.opt.OnError(err, failed.rows)
+		}
+		return err
+	}
+	if b.rows++; b.rows == 1 {
+		columns := b.batch.Columns()
+		b.columns = make([]string, len(columns))
+		for i, col := range columns {
+			b.columns[i] = col.Name()
+		}
+		batch, ok := b.batch.(rowBatch)
+		b.truncate, b.check = ok && batch.truncatable(), nil
+		if !b.truncate {
+			b.check = newCheckBlock(b.server, columns)
+		}
+	}
+	if b.rows >= b.opt.MaxRows || b.full() {
+		b.enqueue(b.take(nil))
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// appendNext appends a row after the first one of the batch. kept reports
+// that the batch is still usable after an error.
+// Must be called with b.mu held.
+func (b *BufferedInserter) appendNext(values func([]string) ([]any, error), fn func(driver.Batch) error) (kept bool, err error) {
+	if !b.truncate && b.check == nil {
+		return false, fn(b.batch)
+	}
+	row, err := values(b.columns)
+	if err != nil {
+		return true, err
+	}
+	if b.truncate {
+		return b.batch.(rowBatch).appendRow(row)
+	}
+	b.check.Reset()
+	if err := b.check.Append(row...); err != nil {
+		return true, err
+	}
+	return false, fn(b.batch)
+}
+
+// prepare prepares a batch. It also returns the context of the server the
+// rows are converted for, which is looked up if server is nil.
+func (b *BufferedInserter) prepare(server *column.ServerContext) (driver.Batch, *column.ServerContext, error) {
+	if server == nil {
+		version, err := b.conn.ServerVersion()
+		if err != nil {
+			return nil, nil, err
+		}
+		sc := serverVersionToContext(*version)
+		server = &sc
+	}
+	opts := append([]driver.PrepareBatchOption{driver.WithReleaseConnection()}, b.opt.PrepareBatchOptions...)
+	batch, err := b.conn.PrepareBatch(b.opt.Context, b.query, opts...)
+	return batch, server, err
+}
+
+// newCheckBlock returns an empty block with the columns of a batch to
+// convert rows with before they are appended to it.
+func newCheckBlock(server *column.ServerContext, columns []column.Interface) *proto.Block {
+	block := &proto.Block{ServerContext: server}
+	for _, col := range columns {
+		if err := block.AddColumn(col.Name(), col.Type()); err != nil {
+			// the rows are converted by the batch only
+			return nil
+		}
+	}
+	return block
+}
+
+// full reports whether the buffered rows reach MaxBytes.
+// Must be called with b.mu held.
+func (b *BufferedInserter) full() bool {
+	sized, ok := b.batch.(driver.SizedBatch)
+	return ok && b.opt.MaxBytes > 0 && sized.Size() >= b.opt.MaxBytes
+}
+
+// take returns the buffered rows to be sent and starts a new buffer.
+// Must be called with b.mu held.
+func (b *BufferedInserter) take(result chan error) pendingFlush {
+	flush := pendingFlush{batch: b.batch, rows: b.rows, result: result}
+	b.batch, b.rows = nil, 0
+	return flush
+}
+
+// waitPending blocks until fewer than MaxPendingFlushes buffers are
+// waiting to be sent. Must be called with b.mu held, which is released
+// while waiting.
+func (b *BufferedInserter) waitPending() {
+	for len(b.pending) >= b.opt.MaxPendingFlushes {
+		b.cond.Wait()
+	}
+}
+
+// enqueue adds a buffer to be sent. Must be called with b.mu held and fewer
+// than MaxPendingFlushes buffers waiting.
+func (b *BufferedInserter) enqueue(flush pendingFlush) {
+	b.pending = append(b.pending, flush)
+	b.cond.Broadcast()
+}
+
+// Flush sends the buffered rows and waits until they and the buffers
+// waiting before them have been sent. It returns the error of sending the
+// buffered rows, which is not passed to OnError.
+func (b *BufferedInserter) Flush() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBufferedInserterClosed
+	}
+	if b.waitPending(); b.closed {
+		b.mu.Unlock()
+		return ErrBufferedInserterClosed
+	}
+	result := make(chan error, 1)
+	b.enqueue(b.take(result))
+	b.mu.Unlock()
+	return <-result
+}
+
+// Close sends the remaining rows, waits for all buffers to be sent and
+// stops the inserter. It returns the error of sending the remaining rows.
+func (b *BufferedInserter) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.waitPending()
+	result := make(chan error, 1)
+	flush := b.take(result)
+	flush.last = true
+	b.enqueue(flush)
+	b.mu.Unlock()
+
+	close(b.stop)
+	<-b.done
+	return <-result
+}
+
+func (b *BufferedInserter) send() {
+	defer close(b.done)
+	for {
+		b.mu.Lock()
+		for len(b.pending) == 0 {
+			b.cond.Wait()
+		}
+		flush := b.pending[0]
+		b.pending = b.pending[1:]
+		b.cond.Broadcast()
+		b.mu.Unlock()
+
+		var err error
+		if flush.batch != nil {
+			err = flush.batch.Send()
+		}
+		switch {
+		case flush.result != nil:
+			flush.result <- err
+		case err != nil && b.opt.OnError != nil:
+			b.opt.OnError(err, flush.rows)
+		}
+		if flush.last {
+			return
+		}
+	}
+}
+
+func (b *BufferedInserter) tick() {
+	ticker := time.NewTicker(b.opt.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.mu.Lock()
+			// the rows wait for the next tick while the queue is full
+			if !b.closed && b.rows > 0 && len(b.pending) < b.opt.MaxPendingFlushes {
+				b.enqueue(b.take(nil))
+			}
+			b.mu.Unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package clickhouse
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferedInserter(t *testing.T) {
+	t.Run("max rows", func(t *testing.T) {
+		conn := newFakeBatchConn(t, "value", "Int64")
+		inserter := NewBufferedInserter(conn, "INSERT INTO t", BufferedInserterOptions{MaxRows: 2, FlushInterval: time.Hour})
+		for i := 0; i < 5; i++ {
+			require.NoError(t, inserter.Append(i))
+		}
+		require.NoError(t, inserter.Close())
+		assert.Equal(t, [][]any{{0, 1}, {2, 3}, {4}}, conn.batches())
+		assert.ErrorIs(t, inserter.Append(5), ErrBufferedInserterClosed)
+		assert.ErrorIs(t, inserter.Flush(), ErrBufferedInserterClosed)
+		assert.NoError(t, inserter.Close())
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		conn := newFakeBatchConn(t, "value", "String")
+		inserter := NewBufferedInserter(conn, "INSERT INTO t", BufferedInserterOptions{MaxBytes: 10, FlushInterval: time.Hour})
+		require.NoError(t, inserter.Append("abcd"))
+		require.NoError(t, inserter.Append("efgh"))
+		require.NoError(t, inserter.Append("ijkl"))
+		require.NoError(t, inserter.Flush())
+		assert.Equal(t, [][]any{{"abcd", "efgh"}, {"ijkl"}}, conn.batches())
+		require.NoError(t, inserter.Close())
+	})
+
+	t.Run("flush interval", func(t *testing.T) {
+		conn := newFakeBatchConn(t, "value", "String")
+		inserter := NewBufferedInserter(conn, "INSERT INTO t", BufferedInserterOptions{FlushInterval: 10 * time.Millisecond})
+		defer inserter.Close()
+		row := &struct {
+			Value string `ch:"value"`
+		}{Value: "a"}
+		require.NoError(t, inserter.AppendStruct(row))
+		assert.Eventually(t, func() bool { return len(conn.batches()) == 1 }, time.Second, 5*time.Millisecond)
+		require.NoError(t, inserter.Flush())
+		assert.Equal(t, [][]any{{row}}, conn.batches())
+	})
+
+	t.Run("concurrent appends", func(t *testing.T) {
+		conn := newFakeBatchConn(t, "value", "Int64")
+		inserter := NewBufferedInserter(conn, "INSERT INTO t", BufferedInserterOptions{MaxRows: 7, FlushInterval: time.Millisecond})
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					assert.NoError(t, inserter.Append(i))
+				}
+			}()
+		}
+		wg.Wait()
+		require.NoError(t, inserter.Close())
+		rows := 0
+		for _, batch := range conn.batches() {
+			assert.LessOrEqual(t, len(batch), 7)
+			rows += len(batch)
+		}
+		assert.Equal(t, 800, rows)
+	})
+
+	t.Run("backpressure", func(t *testing.T) {
+		conn := newFakeBatchConn(t, "value", "Int64")
+		conn.sending = make(chan struct{})
+		inserter := NewBufferedInserter(conn, "INSERT INTO t", BufferedInserterOptions{MaxRows: 1, FlushInterval: time.Hour})
+		// the first row is being sent and the second is waiting
+		require.NoError(t, inserter.Append(1))
+		require.Eventually(t, func() bool {
+			inserter.mu.Lock()
+			defer inserter.mu.Unlock()
+			return len(inserter.pending) == 0
+		}, time.Second, time.Millisecond)
+		require.NoError(t, inserter.Append(2))
+		appended := make(chan struct{})
+		go func() {
+			defer close(appended)
+			assert.NoError(t, inserter.Append(3))
+		}()
+		select {
+		case <-appended:
+			t.Fatal("expected Append to block while the pending flushes are full")
+		case <-time.After(50 * time.Millisecond):
+		}
+		// without holding the lock meanwhile
+		require.True(t, inserter.mu.TryLock())
+		inserter.mu.Unlock()
+		close(conn.sending)
+		<-appended
+		require.NoError(t, inserter.Close())
+		assert.Equal(t, [][]any{{1}, {2}, {3}}, conn.batches())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		sendErr := errors.New("send failed")
+		conn := newFakeBatchConn(t, "value", "Int64")
+		conn.sendErr = sendErr
+		var (
+			mu     sync.Mutex
+			errs   []error
+			failed []int
+		)
+		inserter := NewBufferedInserter(conn, "INSERT INTO t", BufferedInserterOptions{
+			MaxRows:       3,
+			FlushInterval: time.Hour,
+			OnError: func(err error, rows int) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs, failed = append(errs, err), append(failed, rows)
+			},
+		})
+		for i := 0; i < 3; i++ {
+			require.NoError(t, inserter.Append(i))
+		}
+		// nothing is buffered, this waits for the full buffer to be sent
+		require.NoError(t, inserter.Flush())
+		// a bad row is returned to its caller, the rows buffered with it are kept
+		require.NoError(t, inserter.Append(3))
+		assert.Error(t, inserter.Append(4, 5))
+		assert.Error(t, inserter.Append("x"))
+		require.NoError(t, inserter.Append(6))
+		// the error of Flush is returned rather than reported
+		assert.ErrorIs(t, inserter.Flush(), sendErr)
+		// a bad first row is not buffered either
+		assert.Error(t, inserter.Append(7, 8))
+		require.NoError(t, inserter.Close())
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], sendErr)
+		assert.Equal(t, []int{3}, failed)
+		assert.Len(t, conn.prepared(), 3)
+		for _, options := range conn.prepared() {
+			assert.True(t, options.ReleaseConnection)
+		}
+	})
+
+	t.Run("truncating batches", func(t *testing.T) {
+		conn := newFakeBatchConn(t, "value", "Int64")
+		conn.truncate = true
+		inserter := NewBufferedInserter(conn, "INSERT INTO t", BufferedInserterOptions{FlushInterval: time.Hour})
+		require.NoError(t, inserter.Append(1))
+		// the rows are converted by the batch only, which takes back a bad row
+		assert.Nil(t, inserter.check)
+		assert.Error(t, inserter.Append("x"))
+		require.NoError(t, inserter.Append(2))
+		require.NoError(t, inserter.Close())
+		assert.Equal(t, [][]any{{1, 2}}, conn.batches())
+		assert.Len(t, conn.prepared(), 1)
+	})
+}
@@ -0,0 +1,244 @@
+package charrow
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// AppendRecord appends the rows of rec to batch, column by column. Every
+// column of the batch is read from the field of rec with the same name, and
+// every field must have a column. The fields must have the Arrow type of
+// their column as listed in the package documentation; Binary, LargeString,
+// LargeList, FixedSizeList and Date64 arrays are accepted too. The elements
+// of a Tuple are matched by position.
+//
+// Like an error of driver.BatchColumn, an error appending a column leaves
+// the batch unusable.
+func AppendRecord(batch driver.Batch, rec arrow.RecordBatch) error {
+	var (
+		schema  = rec.Schema()
+		columns = batch.Columns()
+		arrays  = make([]arrow.Array, len(columns))
+	)
+	if len(columns) != schema.NumFields() {
+		return fmt.Errorf("charrow: record has %d fields, batch %d columns", schema.NumFields(), len(columns))
+	}
+	for i, col := range columns {
+		indices := schema.FieldIndices(col.Name())
+		if len(indices) != 1 {
+			return fmt.Errorf("charrow: record has no field %s", col.Name())
+		}
+		arrays[i] = rec.Column(indices[0])
+	}
+	for i, col := range columns {
+		if err := appendArray(batch.Column(i), col.Type(), arrays[i]); err != nil {
+			return fmt.Errorf("charrow: column %s: %w", col.Name(), err)
+		}
+	}
+	return nil
+}
+
+// appendArray appends arr to a column of the given type.
+func appendArray(dst driver.BatchColumn, chType column.Type, arr arrow.Array) error {
+	if arr.NullN() == 0 {
+		if values, ok := primitiveValues(arr, string(chType)); ok {
+			return dst.Append(values)
+		}
+	}
+	for i := 0; i < arr.Len(); i++ {
+		v, err := arrowValue(arr, i, string(chType))
+		if err != nil {
+			return err
+		}
+		if err := dst.AppendRow(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// primitiveValues returns the values of a numeric array appended to a
+// column of the same type at once.
+func primitiveValues(arr arrow.Array, chType string) (any, bool) {
+	if typ, ok := primitiveTypes[chType]; !ok || !arrow.TypeEqual(typ, arr.DataType()) {
+		return nil, false
+	}
+	switch a := arr.(type) {
+	case *array.Int8:
+		return a.Int8Values(), true
+	case *array.Int16:
+		return a.Int16Values(), true
+	case *array.Int32:
+		return a.Int32Values(), true
+	case *array.Int64:
+		return a.Int64Values(), true
+	case *array.Uint8:
+		return a.Uint8Values(), true
+	case *array.Uint16:
+		return a.Uint16Values(), true
+	case *array.Uint32:
+		return a.Uint32Values(), true
+	case *array.Uint64:
+		return a.Uint64Values(), true
+	case *array.Float32:
+		return a.Float32Values(), true
+	case *array.Float64:
+		return a.Float64Values(), true
+	}
+	return nil, false
+}
+
+// arrowValue returns value i of arr as a value column.Interface.AppendRow
+// accepts for chType.
+func arrowValue(arr arrow.Array, i int, chType string) (any, error) {
+	if arr.IsNull(i) {
+		return nil, nil
+	}
+	for _, wrapper := range []string{"LowCardinality", "Nullable"} {
+		chType, _ = unwrap(chType, wrapper)
+	}
+	switch a := arr.(type) {
+	case *array.Int8:
+		return a.Value(i), nil
+	case *array.Int16:
+		return a.Value(i), nil
+	case *array.Int32:
+		return a.Value(i), nil
+	case *array.Int64:
+		return a.Value(i), nil
+	case *array.Uint8:
+		return a.Value(i), nil
+	case *array.Uint16:
+		return a.Value(i), nil
+	case *array.Uint32:
+		return a.Value(i), nil
+	case *array.Uint64:
+		return a.Value(i), nil
+	case *array.Float32:
+		return a.Value(i), nil
+	case *array.Float64:
+		return a.Value(i), nil
+	case *array.Boolean:
+		return a.Value(i), nil
+	case *array.String:
+		return a.Value(i), nil
+	case *array.LargeString:
+		return a.Value(i), nil
+	case *array.Binary:
+		return string(a.Value(i)), nil
+	case *array.FixedSizeBinary:
+		if chType == "UUID" {
+			return uuid.FromBytes(a.Value(i))
+		}
+		return string(a.Value(i)), nil
+	case *array.Date32:
+		return a.Value(i).ToTime(), nil
+	case *array.Date64:
+		return a.Value(i).ToTime(), nil
+	case *array.Timestamp:
+		return a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit), nil
+	case *array.Decimal128:
+		return decimal.NewFromBigInt(a.Value(i).BigInt(), -a.DataType().(*arrow.Decimal128Type).Scale), nil
+	case *array.Decimal256:
+		return decimal.NewFromBigInt(a.Value(i).BigInt(), -a.DataType().(*arrow.Decimal256Type).Scale), nil
+	case *array.Dictionary:
+		return arrowValue(a.Dictionary(), a.GetValueIndex(i), chType)
+	case *array.Map:
+		_, args := typeArgs(chType)
+		if len(args) != 2 {
+			return nil, mismatchArrow(arr, chType)
+		}
+		var (
+			row        mapRow
+			start, end = a.ValueOffsets(i)
+		)
+		for j := int(start); j < int(end); j++ {
+			key, err := arrowValue(a.Keys(), j, args[0])
+			if err != nil {
+				return nil, err
+			}
+			value, err := arrowValue(a.Items(), j, args[1])
+			if err != nil {
+				return nil, err
+			}
+			row.Put(key, value)
+		}
+		return &row, nil
+	case array.ListLike:
+		name, args := typeArgs(chType)
+		if name != "Array" || len(args) != 1 {
+			return nil, mismatchArrow(arr, chType)
+		}
+		start, end := a.ValueOffsets(i)
+		values := make([]any, 0, end-start)
+		for j := int(start); j < int(end); j++ {
+			value, err := arrowValue(a.ListValues(), j, args[0])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case *array.Struct:
+		name, args := typeArgs(chType)
+		if name != "Tuple" || len(args) != a.NumField() {
+			return nil, mismatchArrow(arr, chType)
+		}
+		values := make([]any, a.NumField())
+		for j := range values {
+			_, elemType := tupleElement(args[j], j)
+			value, err := arrowValue(a.Field(j), i, elemType)
+			if err != nil {
+				return nil, err
+			}
+			values[j] = value
+		}
+		return values, nil
+	}
+	return nil, mismatchArrow(arr, chType)
+}
+
+func mismatchArrow(arr arrow.Array, chType string) error {
+	return fmt.Errorf("converting Arrow %s to %s is unsupported", arr.DataType(), chType)
+}
+
+// mapRow is a row of a Map column with its entries in order.
+type mapRow struct {
+	keys, values []any
+}
+
+var _ column.IterableOrderedMap = (*mapRow)(nil)
+
+func (m *mapRow) Put(key, value any) {
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *mapRow) Iterator() column.MapIterator {
+	return &mapRowIterator{row: m, i: -1}
+}
+
+type mapRowIterator struct {
+	row *mapRow
+	i   int
+}
+
+func (it *mapRowIterator) Next() bool {
+	it.i++
+	return it.i < len(it.row.keys)
+}
+
+func (it *mapRowIterator) Key() any {
+	return it.row.keys[it.i]
+}
+
+func (it *mapRowIterator) Value() any {
+	return it.row.values[it.i]
+}
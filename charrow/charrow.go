@@ -0,0 +1,253 @@
+// Package charrow converts between ClickHouse results and batches and Apache
+// Arrow records, over both the native and the HTTP protocol.
+//
+// NewRecordReader reads the rows of a query as Arrow records, one per block,
+// and AppendRecord appends the rows of an Arrow record to a batch. ClickHouse
+// types map to Arrow types as follows:
+//
+//	Int8 … Int64, UInt8 … UInt64  Int8 … Int64, Uint8 … Uint64
+//	Float32, Float64              Float32, Float64
+//	Bool                          Boolean
+//	String, Enum8, Enum16         String
+//	FixedString(N)                FixedSizeBinary(N)
+//	UUID                          FixedSizeBinary(16)
+//	Date, Date32                  Date32
+//	DateTime, DateTime64(P)       Timestamp, in seconds or the unit of P
+//	Decimal(P, S)                 Decimal128, or Decimal256 above 38 digits
+//	Nullable(T)                   a nullable T
+//	LowCardinality(T)             Dictionary of T, or T when nested
+//	Array(T)                      List of T
+//	Map(K, V)                     Map of K to V
+//	Tuple(T1, T2, …)              Struct, with fields named 1, 2, … if unnamed
+//
+// Other types are not supported. Importing the package also registers the
+// Arrow, ArrowStream and Parquet formats with clickhouse.RegisterFormatEncoder,
+// so QueryFormat supports them over the native protocol.
+package charrow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Schema returns the Arrow schema of a result with the given columns.
+func Schema(columns []driver.ColumnType) (*arrow.Schema, error) {
+	fields := make([]arrow.Field, len(columns))
+	for i, c := range columns {
+		field, err := Field(c.Name(), c.DatabaseTypeName())
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = field
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// Field returns the Arrow field of a column of the given ClickHouse type.
+func Field(name, chType string) (arrow.Field, error) {
+	typ, err := dataType(chType)
+	if err != nil {
+		return arrow.Field{}, err
+	}
+	if inner, ok := unwrap(chType, "LowCardinality"); ok {
+		typ = &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: typ}
+		chType = inner
+	}
+	_, nullable := unwrap(chType, "Nullable")
+	return arrow.Field{Name: name, Type: typ, Nullable: nullable}, nil
+}
+
+var primitiveTypes = map[string]arrow.DataType{
+	"Int8":    arrow.PrimitiveTypes.Int8,
+	"Int16":   arrow.PrimitiveTypes.Int16,
+	"Int32":   arrow.PrimitiveTypes.Int32,
+	"Int64":   arrow.PrimitiveTypes.Int64,
+	"UInt8":   arrow.PrimitiveTypes.Uint8,
+	"UInt16":  arrow.PrimitiveTypes.Uint16,
+	"UInt32":  arrow.PrimitiveTypes.Uint32,
+	"UInt64":  arrow.PrimitiveTypes.Uint64,
+	"Float32": arrow.PrimitiveTypes.Float32,
+	"Float64": arrow.PrimitiveTypes.Float64,
+	"Bool":    arrow.FixedWidthTypes.Boolean,
+	"String":  arrow.BinaryTypes.String,
+	"UUID":    &arrow.FixedSizeBinaryType{ByteWidth: 16},
+	"Date":    arrow.FixedWidthTypes.Date32,
+	"Date32":  arrow.FixedWidthTypes.Date32,
+}
+
+// decimalPrecisions are the precisions of the Decimal aliases.
+var decimalPrecisions = map[string]int{
+	"Decimal32":  9,
+	"Decimal64":  18,
+	"Decimal128": 38,
+	"Decimal256": 76,
+}
+
+// dataType returns the Arrow type of values of a ClickHouse type.
+// LowCardinality is ignored, so nested LowCardinality types map to their
+// values.
+func dataType(chType string) (arrow.DataType, error) {
+	if typ, ok := primitiveTypes[chType]; ok {
+		return typ, nil
+	}
+	name, args := typeArgs(chType)
+	switch name {
+	case "Nullable", "LowCardinality":
+		if len(args) == 1 {
+			return dataType(args[0])
+		}
+	case "Enum8", "Enum16":
+		return arrow.BinaryTypes.String, nil
+	case "FixedString":
+		if len(args) == 1 {
+			if n, err := strconv.Atoi(args[0]); err == nil {
+				return &arrow.FixedSizeBinaryType{ByteWidth: n}, nil
+			}
+		}
+	case "DateTime":
+		if len(args) <= 1 {
+			return &arrow.TimestampType{Unit: arrow.Second, TimeZone: timezone(args, 0)}, nil
+		}
+	case "DateTime64":
+		if len(args) == 1 || len(args) == 2 {
+			if precision, err := strconv.Atoi(args[0]); err == nil {
+				unit := arrow.TimeUnit(min((precision+2)/3, int(arrow.Nanosecond)))
+				return &arrow.TimestampType{Unit: unit, TimeZone: timezone(args, 1)}, nil
+			}
+		}
+	case "Decimal", "Decimal32", "Decimal64", "Decimal128", "Decimal256":
+		precision, scale, err := decimalArgs(name, args)
+		if err != nil {
+			break
+		}
+		if precision > 38 {
+			return &arrow.Decimal256Type{Precision: int32(precision), Scale: int32(scale)}, nil
+		}
+		return &arrow.Decimal128Type{Precision: int32(precision), Scale: int32(scale)}, nil
+	case "Array":
+		if len(args) == 1 {
+			elem, err := dataType(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return arrow.ListOf(elem), nil
+		}
+	case "Map":
+		if len(args) == 2 {
+			key, err := dataType(args[0])
+			if err != nil {
+				return nil, err
+			}
+			value, err := dataType(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return arrow.MapOf(key, value), nil
+		}
+	case "Tuple":
+		fields := make([]arrow.Field, len(args))
+		for i, arg := range args {
+			name, elemType := tupleElement(arg, i)
+			elem, err := dataType(elemType)
+			if err != nil {
+				return nil, err
+			}
+			_, nullable := unwrap(elemType, "Nullable")
+			fields[i] = arrow.Field{Name: name, Type: elem, Nullable: nullable}
+		}
+		return arrow.StructOf(fields...), nil
+	}
+	return nil, fmt.Errorf("charrow: unsupported type %s", chType)
+}
+
+// unwrap returns the argument of chType if it is a wrapper type such as
+// Nullable(T), looking through LowCardinality for Nullable.
+func unwrap(chType, wrapper string) (string, bool) {
+	name, args := typeArgs(chType)
+	if name == "LowCardinality" && wrapper == "Nullable" && len(args) == 1 {
+		return unwrap(args[0], wrapper)
+	}
+	if name != wrapper || len(args) != 1 {
+		return chType, false
+	}
+	return args[0], true
+}
+
+// typeArgs splits a parameterized type such as Map(String, Array(UInt8))
+// into its name and its top-level arguments.
+func typeArgs(chType string) (name string, args []string) {
+	open := strings.IndexByte(chType, '(')
+	if open == -1 || !strings.HasSuffix(chType, ")") {
+		return chType, nil
+	}
+	var (
+		inner = chType[open+1 : len(chType)-1]
+		depth int
+		quote byte
+		start int
+	)
+	for i := 0; i < len(inner); i++ {
+		switch c := inner[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '`' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(inner[start:i]))
+			start = i + 1
+		}
+	}
+	return chType[:open], append(args, strings.TrimSpace(inner[start:]))
+}
+
+// tupleElement splits an element of a Tuple type into its name and type.
+// Unnamed elements are named by their 1-based position.
+func tupleElement(element string, i int) (name, chType string) {
+	if strings.HasPrefix(element, "`") {
+		if end := strings.IndexByte(element[1:], '`'); end != -1 {
+			return element[1 : end+1], strings.TrimSpace(element[end+2:])
+		}
+	}
+	if end := strings.IndexAny(element, " ("); end != -1 && element[end] == ' ' {
+		return element[:end], strings.TrimSpace(element[end+1:])
+	}
+	return strconv.Itoa(i + 1), element
+}
+
+func timezone(args []string, i int) string {
+	if i >= len(args) {
+		return ""
+	}
+	return strings.Trim(args[i], "'")
+}
+
+func decimalArgs(name string, args []string) (precision, scale int, err error) {
+	if precision, ok := decimalPrecisions[name]; ok {
+		if len(args) != 1 {
+			return 0, 0, fmt.Errorf("charrow: invalid %s arguments", name)
+		}
+		scale, err = strconv.Atoi(args[0])
+		return precision, scale, err
+	}
+	if len(args) != 2 {
+		return 0, 0, fmt.Errorf("charrow: invalid %s arguments", name)
+	}
+	if precision, err = strconv.Atoi(args[0]); err != nil {
+		return 0, 0, err
+	}
+	scale, err = strconv.Atoi(args[1])
+	return precision, scale, err
+}
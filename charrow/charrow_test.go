@@ -0,0 +1,277 @@
+package charrow
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	chproto "github.com/ClickHouse/ch-go/proto"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+// fakeBlock is a driver.Block of columns.
+type fakeBlock []column.Interface
+
+func (b fakeBlock) Rows() int                            { return b[0].Rows() }
+func (b fakeBlock) Column(i int) column.Interface        { return b[i] }
+func (b fakeBlock) ColumnByName(string) column.Interface { return nil }
+func (b fakeBlock) Columns() []string {
+	names := make([]string, len(b))
+	for i, c := range b {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// fakeRows are driver.BlockRows returning a single block.
+type fakeRows struct {
+	driver.BlockRows
+	block  fakeBlock
+	next   bool
+	closed bool
+}
+
+func (r *fakeRows) ColumnTypes() []driver.ColumnType {
+	types := make([]driver.ColumnType, len(r.block))
+	for i, c := range r.block {
+		types[i] = columnType{c}
+	}
+	return types
+}
+
+func (r *fakeRows) NextBlock() bool {
+	r.next = !r.next
+	return r.next
+}
+
+func (r *fakeRows) Block() driver.Block { return r.block }
+func (r *fakeRows) Err() error          { return nil }
+func (r *fakeRows) Close() error {
+	r.closed = true
+	return nil
+}
+
+type columnType struct {
+	column.Interface
+}
+
+func (c columnType) Nullable() bool           { return false }
+func (c columnType) DatabaseTypeName() string { return string(c.Type()) }
+func (c columnType) ScanType() reflect.Type   { return c.Interface.ScanType() }
+
+// fakeBatch is a driver.Batch appending to columns.
+type fakeBatch struct {
+	driver.Batch
+	columns []column.Interface
+}
+
+func (b *fakeBatch) Columns() []column.Interface     { return b.columns }
+func (b *fakeBatch) Column(i int) driver.BatchColumn { return batchColumn{b.columns[i]} }
+
+type batchColumn struct {
+	column.Interface
+}
+
+func (c batchColumn) Append(v any) error {
+	_, err := c.Interface.Append(v)
+	return err
+}
+
+var testColumns = []struct {
+	name, chType string
+	rows         []any
+}{
+	{"id", "UInt64", []any{uint64(1), uint64(2), uint64(3)}},
+	{"name", "LowCardinality(String)", []any{"a", "b", "a"}},
+	{"score", "Nullable(Float64)", []any{1.5, nil, 3.0}},
+	{"at", "DateTime64(3, 'UTC')", []any{
+		time.Date(2024, 1, 2, 3, 4, 5, 6e6, time.UTC),
+		time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC),
+		time.Date(2024, 1, 2, 3, 4, 7, 0, time.UTC),
+	}},
+	{"day", "Date32", []any{
+		time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(1960, 1, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+	}},
+	{"price", "Decimal(10, 2)", []any{decimal.RequireFromString("1.25"), decimal.RequireFromString("-2.5"), decimal.Zero}},
+	{"uuid", "UUID", []any{uuid.MustParse("8b8e5ed9-3a1e-4bd5-a3a7-7b34ffbdb0a2"), uuid.Nil, uuid.Nil}},
+	{"tags", "Array(Nullable(String))", []any{[]*string{ptr("x"), nil}, []*string{}, []*string{ptr("y")}}},
+	{"attrs", "Map(String, UInt8)", []any{map[string]uint8{"k": 1}, map[string]uint8{}, map[string]uint8{"l": 2}}},
+	{"point", "Tuple(x Int32, y String)", []any{
+		map[string]any{"x": int32(1), "y": "p"},
+		map[string]any{"x": int32(2), "y": "q"},
+		map[string]any{"x": int32(3), "y": "r"},
+	}},
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// newColumns returns empty columns of testColumns, or the columns with their
+// rows as decoded from the server.
+func newColumns(t *testing.T, rows bool) []column.Interface {
+	block := &proto.Block{ServerContext: &column.ServerContext{Timezone: time.UTC}}
+	for _, tc := range testColumns {
+		require.NoError(t, block.AddColumn(tc.name, column.Type(tc.chType)))
+	}
+	if !rows {
+		return block.Columns
+	}
+	for i, tc := range testColumns {
+		for _, row := range tc.rows {
+			require.NoError(t, block.Columns[i].AppendRow(row), tc.name)
+		}
+	}
+	return decodeColumns(t, block.Columns)
+}
+
+// decodeColumns encodes and decodes columns, as they are read after a round
+// trip to the server.
+func decodeColumns(t *testing.T, columns []column.Interface) []column.Interface {
+	var (
+		buffer chproto.Buffer
+		block  = &proto.Block{Columns: columns, ServerContext: &column.ServerContext{Timezone: time.UTC}}
+	)
+	require.NoError(t, block.Encode(&buffer, 0))
+	decoded := &proto.Block{ServerContext: block.ServerContext}
+	require.NoError(t, decoded.Decode(chproto.NewReader(bytes.NewReader(buffer.Buf)), 0))
+	return decoded.Columns
+}
+
+func TestField(t *testing.T) {
+	for chType, expected := range map[string]string{
+		"UInt64":                              "uint64",
+		"Nullable(String)":                    "utf8",
+		"LowCardinality(Nullable(String))":    "dictionary<values=utf8, indices=int32, ordered=false>",
+		"FixedString(4)":                      "fixed_size_binary[4]",
+		"DateTime":                            "timestamp[s]",
+		"DateTime('Europe/Berlin')":           "timestamp[s, tz=Europe/Berlin]",
+		"DateTime64(6, 'UTC')":                "timestamp[us, tz=UTC]",
+		"Decimal(40, 5)":                      "decimal256(40, 5)",
+		"Decimal64(3)":                        "decimal(18, 3)",
+		"Enum8('a' = 1, 'b,c' = 2)":           "utf8",
+		"Array(LowCardinality(String))":       "list<item: utf8, nullable>",
+		"Map(String, Array(UInt8))":           "map<utf8, list<item: uint8, nullable>, items_nullable>",
+		"Tuple(Int8, `a b` Nullable(String))": "struct<1: int8, a b: utf8 nullable>",
+	} {
+		field, err := Field("c", chType)
+		require.NoError(t, err, chType)
+		assert.Equal(t, expected, field.Type.String(), chType)
+	}
+
+	field, err := Field("c", "LowCardinality(Nullable(String))")
+	require.NoError(t, err)
+	assert.True(t, field.Nullable)
+	field, err = Field("c", "Array(Nullable(String))")
+	require.NoError(t, err)
+	assert.False(t, field.Nullable)
+
+	for _, chType := range []string{"IPv4", "Variant(String, UInt8)", "Array(Dynamic)"} {
+		_, err := Field("c", chType)
+		assert.Error(t, err, chType)
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer mem.AssertSize(t, 0)
+
+	rows := &fakeRows{block: newColumns(t, true)}
+	reader, err := NewRecordReader(rows, mem)
+	require.NoError(t, err)
+	require.True(t, reader.Next())
+	rec := reader.RecordBatch()
+	assert.EqualValues(t, 3, rec.NumRows())
+
+	assert.Equal(t, []uint64{1, 2, 3}, rec.Column(0).(*array.Uint64).Uint64Values())
+	names := rec.Column(1).(*array.Dictionary)
+	assert.Equal(t, 2, names.Dictionary().Len())
+	assert.Equal(t, "a", names.ValueStr(2))
+	assert.True(t, rec.Column(2).IsNull(1))
+	assert.Equal(t, `["x",null]`, rec.Column(7).(*array.List).ValueStr(0))
+	assert.Equal(t, `{"x":2,"y":"q"}`, rec.Column(9).ValueStr(1))
+
+	batch := &fakeBatch{columns: newColumns(t, false)}
+	require.NoError(t, AppendRecord(batch, rec))
+	appended := decodeColumns(t, batch.columns)
+	for i, tc := range testColumns {
+		require.Equal(t, len(tc.rows), appended[i].Rows(), tc.name)
+		for row := range tc.rows {
+			assert.Equal(t, rows.block[i].Row(row, false), appended[i].Row(row, false), tc.name)
+		}
+	}
+
+	assert.False(t, reader.Next())
+	require.NoError(t, reader.Err())
+	reader.Release()
+	assert.True(t, rows.closed)
+}
+
+func TestAppendRecordFields(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "other", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	builder.Field(0).(*array.Int64Builder).Append(1)
+	rec := builder.NewRecordBatch()
+	defer rec.Release()
+
+	col, err := column.Type("Int64").Column("id", nil)
+	require.NoError(t, err)
+	assert.EqualError(t, AppendRecord(&fakeBatch{columns: []column.Interface{col}}, rec), "charrow: record has no field id")
+
+	col, err = column.Type("String").Column("other", nil)
+	require.NoError(t, err)
+	err = AppendRecord(&fakeBatch{columns: []column.Interface{col}}, rec)
+	assert.ErrorContains(t, err, "charrow: column other")
+}
+
+func TestFormatEncoders(t *testing.T) {
+	for _, format := range []string{"Arrow", "ArrowStream", "Parquet"} {
+		var buffer bytes.Buffer
+		encoder := map[string]clickhouse.FormatEncoder{
+			"Arrow":       encodeArrow,
+			"ArrowStream": encodeArrowStream,
+			"Parquet":     encodeParquet,
+		}[format]
+		require.NoError(t, encoder(&buffer, &fakeRows{block: newColumns(t, true)}), format)
+
+		var table arrow.Table
+		switch format {
+		case "Arrow":
+			reader, err := ipc.NewFileReader(bytes.NewReader(buffer.Bytes()))
+			require.NoError(t, err)
+			rec, err := reader.RecordBatch(0)
+			require.NoError(t, err)
+			table = array.NewTableFromRecords(reader.Schema(), []arrow.RecordBatch{rec})
+			reader.Close()
+		case "ArrowStream":
+			reader, err := ipc.NewReader(&buffer)
+			require.NoError(t, err)
+			require.True(t, reader.Next())
+			table = array.NewTableFromRecords(reader.Schema(), []arrow.RecordBatch{reader.RecordBatch()})
+			reader.Release()
+		case "Parquet":
+			var err error
+			table, err = pqarrow.ReadTable(context.Background(), bytes.NewReader(buffer.Bytes()), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+			require.NoError(t, err)
+		}
+		assert.EqualValues(t, 3, table.NumRows(), format)
+		assert.EqualValues(t, len(testColumns), table.NumCols(), format)
+		table.Release()
+	}
+}
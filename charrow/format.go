@@ -0,0 +1,67 @@
+package charrow
+
+import (
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func init() {
+	clickhouse.RegisterFormatEncoder("Arrow", encodeArrow)
+	clickhouse.RegisterFormatEncoder("ArrowStream", encodeArrowStream)
+	clickhouse.RegisterFormatEncoder("Parquet", encodeParquet)
+}
+
+// recordWriter is the part of the Arrow and Parquet writers the encoders use.
+type recordWriter interface {
+	Write(rec arrow.RecordBatch) error
+	Close() error
+}
+
+func encodeArrow(w io.Writer, rows driver.BlockRows) error {
+	return encodeRecords(rows, func(r *RecordReader) (recordWriter, error) {
+		return ipc.NewFileWriter(w, ipc.WithSchema(r.Schema()), ipc.WithAllocator(r.mem))
+	})
+}
+
+func encodeArrowStream(w io.Writer, rows driver.BlockRows) error {
+	return encodeRecords(rows, func(r *RecordReader) (recordWriter, error) {
+		return ipc.NewWriter(w, ipc.WithSchema(r.Schema()), ipc.WithAllocator(r.mem)), nil
+	})
+}
+
+func encodeParquet(w io.Writer, rows driver.BlockRows) error {
+	return encodeRecords(rows, func(r *RecordReader) (recordWriter, error) {
+		return pqarrow.NewFileWriter(r.Schema(), w, parquet.NewWriterProperties(), pqarrow.DefaultWriterProps())
+	})
+}
+
+// encodeRecords writes the records of rows with the writer returned by open.
+func encodeRecords(rows driver.BlockRows, open func(*RecordReader) (recordWriter, error)) error {
+	reader, err := NewRecordReader(rows, nil)
+	if err != nil {
+		return err
+	}
+	defer reader.Release()
+	writer, err := open(reader)
+	if err != nil {
+		return err
+	}
+	for reader.Next() {
+		if err := writer.Write(reader.RecordBatch()); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	if err := reader.Err(); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,385 @@
+package charrow
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/decimal256"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/shopspring/decimal"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// ErrNoBlockRows is returned by NewRecordReader for rows that can't be read
+// block by block.
+var ErrNoBlockRows = errors.New("charrow: rows do not implement driver.BlockRows")
+
+// NewRecord converts a block of a query result into an Arrow record with the
+// given schema, usually the one returned by Schema for the columns of the
+// result. The caller must release the record.
+func NewRecord(mem memory.Allocator, schema *arrow.Schema, block driver.Block) (arrow.RecordBatch, error) {
+	if len(block.Columns()) != schema.NumFields() {
+		return nil, fmt.Errorf("charrow: block has %d columns, schema %d", len(block.Columns()), schema.NumFields())
+	}
+	arrays := make([]arrow.Array, 0, schema.NumFields())
+	defer func() {
+		for _, arr := range arrays {
+			arr.Release()
+		}
+	}()
+	for i, field := range schema.Fields() {
+		arr, err := newArray(mem, field.Type, block.Column(i))
+		if err != nil {
+			return nil, fmt.Errorf("charrow: column %s: %w", field.Name, err)
+		}
+		arrays = append(arrays, arr)
+	}
+	return array.NewRecordBatch(schema, arrays, int64(block.Rows())), nil
+}
+
+// RecordReader reads the result of a query as Arrow records, one per block.
+// It implements array.RecordReader.
+type RecordReader struct {
+	refs   atomic.Int64
+	mem    memory.Allocator
+	rows   driver.BlockRows
+	schema *arrow.Schema
+	record arrow.RecordBatch
+	err    error
+}
+
+var _ array.RecordReader = (*RecordReader)(nil)
+
+// NewRecordReader returns a reader of the records of rows, allocated with
+// mem, or memory.DefaultAllocator if nil. The rows must come from
+// Conn.Query, and are closed when the reader is released.
+func NewRecordReader(rows driver.Rows, mem memory.Allocator) (*RecordReader, error) {
+	blocks, ok := rows.(driver.BlockRows)
+	if !ok {
+		return nil, ErrNoBlockRows
+	}
+	schema, err := Schema(rows.ColumnTypes())
+	if err != nil {
+		return nil, err
+	}
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	r := &RecordReader{
+		mem:    mem,
+		rows:   blocks,
+		schema: schema,
+	}
+	r.refs.Store(1)
+	return r, nil
+}
+
+func (r *RecordReader) Retain() {
+	r.refs.Add(1)
+}
+
+// Release decreases the reference count of the reader, releasing its
+// current record and closing the rows once it reaches zero.
+func (r *RecordReader) Release() {
+	if r.refs.Add(-1) != 0 {
+		return
+	}
+	r.releaseRecord()
+	if err := r.rows.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *RecordReader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// Next advances to the record of the next block of the result. The previous
+// record is released, unless the caller retained it.
+func (r *RecordReader) Next() bool {
+	r.releaseRecord()
+	if r.err != nil || !r.rows.NextBlock() {
+		return false
+	}
+	r.record, r.err = NewRecord(r.mem, r.schema, r.rows.Block())
+	return r.err == nil
+}
+
+// RecordBatch returns the record Next advanced to. It is valid until the
+// next call to Next or Release.
+func (r *RecordReader) RecordBatch() arrow.RecordBatch {
+	return r.record
+}
+
+// Deprecated: use RecordBatch instead.
+func (r *RecordReader) Record() arrow.RecordBatch {
+	return r.record
+}
+
+func (r *RecordReader) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+func (r *RecordReader) releaseRecord() {
+	if r.record != nil {
+		r.record.Release()
+		r.record = nil
+	}
+}
+
+// newArray converts col into an array of typ.
+func newArray(mem memory.Allocator, typ arrow.DataType, col column.Interface) (arrow.Array, error) {
+	if dict, ok := typ.(*arrow.DictionaryType); ok {
+		values, err := newArray(mem, dict.ValueType, col)
+		if err != nil {
+			return nil, err
+		}
+		defer values.Release()
+		builder := array.NewDictionaryBuilder(mem, dict)
+		defer builder.Release()
+		if err := builder.AppendArray(values); err != nil {
+			return nil, err
+		}
+		return builder.NewArray(), nil
+	}
+
+	builder := array.NewBuilder(mem, typ)
+	defer builder.Release()
+	if !appendData(builder, col) {
+		builder.Reserve(col.Rows())
+		for i := 0; i < col.Rows(); i++ {
+			if err := appendValue(builder, rowValue(col, i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return builder.NewArray(), nil
+}
+
+// appendData appends the values of a numeric column at once.
+func appendData(builder array.Builder, col column.Interface) bool {
+	switch b := builder.(type) {
+	case *array.Int8Builder:
+		return appendValues(b, col)
+	case *array.Int16Builder:
+		return appendValues(b, col)
+	case *array.Int32Builder:
+		return appendValues(b, col)
+	case *array.Int64Builder:
+		return appendValues(b, col)
+	case *array.Uint8Builder:
+		return appendValues(b, col)
+	case *array.Uint16Builder:
+		return appendValues(b, col)
+	case *array.Uint32Builder:
+		return appendValues(b, col)
+	case *array.Uint64Builder:
+		return appendValues(b, col)
+	case *array.Float32Builder:
+		return appendValues(b, col)
+	case *array.Float64Builder:
+		return appendValues(b, col)
+	}
+	return false
+}
+
+func appendValues[T any](builder interface{ AppendValues([]T, []bool) }, col column.Interface) bool {
+	data, ok := col.(interface{ Data() []T })
+	if ok {
+		builder.AppendValues(data.Data(), nil)
+	}
+	return ok
+}
+
+// rowValue returns row i of col, with the entries of maps in their order.
+func rowValue(col column.Interface, i int) any {
+	if _, ok := col.(*column.Map); ok {
+		var row mapRow
+		if err := col.ScanRow(&row, i); err == nil {
+			return row
+		}
+	}
+	return col.Row(i, false)
+}
+
+// appendValue appends a value returned by column.Interface.Row to builder.
+func appendValue(builder array.Builder, v any) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			// NULL of a Nullable column
+			builder.AppendNull()
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		builder.AppendNull()
+		return nil
+	}
+	v = value.Interface()
+
+	switch b := builder.(type) {
+	case *array.Int8Builder:
+		return appendAs[int8](b, v)
+	case *array.Int16Builder:
+		return appendAs[int16](b, v)
+	case *array.Int32Builder:
+		return appendAs[int32](b, v)
+	case *array.Int64Builder:
+		return appendAs[int64](b, v)
+	case *array.Uint8Builder:
+		return appendAs[uint8](b, v)
+	case *array.Uint16Builder:
+		return appendAs[uint16](b, v)
+	case *array.Uint32Builder:
+		return appendAs[uint32](b, v)
+	case *array.Uint64Builder:
+		return appendAs[uint64](b, v)
+	case *array.Float32Builder:
+		return appendAs[float32](b, v)
+	case *array.Float64Builder:
+		return appendAs[float64](b, v)
+	case *array.BooleanBuilder:
+		return appendAs[bool](b, v)
+	case *array.StringBuilder:
+		return appendAs[string](b, v)
+	case *array.FixedSizeBinaryBuilder:
+		switch v := v.(type) {
+		case string:
+			b.Append([]byte(v))
+		case []byte:
+			b.Append(v)
+		default:
+			if value.Kind() != reflect.Array || value.Type().Elem().Kind() != reflect.Uint8 {
+				return mismatch(b, v)
+			}
+			// UUID
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			b.Append(data)
+		}
+	case *array.Date32Builder:
+		t, ok := v.(time.Time)
+		if !ok {
+			return mismatch(b, v)
+		}
+		b.Append(arrow.Date32FromTime(t))
+	case *array.TimestampBuilder:
+		t, ok := v.(time.Time)
+		if !ok {
+			return mismatch(b, v)
+		}
+		b.AppendTime(t)
+	case *array.Decimal128Builder:
+		n, err := scaledDecimal(b, v, b.Type().(*arrow.Decimal128Type).Scale)
+		if err != nil {
+			return err
+		}
+		b.Append(decimal128.FromBigInt(n))
+	case *array.Decimal256Builder:
+		n, err := scaledDecimal(b, v, b.Type().(*arrow.Decimal256Type).Scale)
+		if err != nil {
+			return err
+		}
+		b.Append(decimal256.FromBigInt(n))
+	case *array.MapBuilder:
+		b.Append(true)
+		if row, ok := v.(mapRow); ok {
+			for i := range row.keys {
+				if err := appendValue(b.KeyBuilder(), row.keys[i]); err != nil {
+					return err
+				}
+				if err := appendValue(b.ItemBuilder(), row.values[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if value.Kind() != reflect.Map {
+			return mismatch(b, v)
+		}
+		for iter := value.MapRange(); iter.Next(); {
+			if err := appendValue(b.KeyBuilder(), iter.Key().Interface()); err != nil {
+				return err
+			}
+			if err := appendValue(b.ItemBuilder(), iter.Value().Interface()); err != nil {
+				return err
+			}
+		}
+	case *array.ListBuilder:
+		if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+			return mismatch(b, v)
+		}
+		b.Append(true)
+		for i := 0; i < value.Len(); i++ {
+			if err := appendValue(b.ValueBuilder(), value.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	case *array.StructBuilder:
+		fields := b.Type().(*arrow.StructType).Fields()
+		b.Append(true)
+		for i, field := range fields {
+			var elem reflect.Value
+			switch value.Kind() {
+			case reflect.Slice:
+				if value.Len() != len(fields) {
+					return mismatch(b, v)
+				}
+				elem = value.Index(i)
+			case reflect.Map:
+				elem = value.MapIndex(reflect.ValueOf(field.Name))
+			default:
+				return mismatch(b, v)
+			}
+			var fieldValue any
+			if elem.IsValid() {
+				fieldValue = elem.Interface()
+			}
+			if err := appendValue(b.FieldBuilder(i), fieldValue); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported Arrow type %s", builder.Type())
+	}
+	return nil
+}
+
+func appendAs[T any](builder interface {
+	Append(T)
+	Type() arrow.DataType
+}, v any) error {
+	value, ok := v.(T)
+	if !ok {
+		return mismatch(builder, v)
+	}
+	builder.Append(value)
+	return nil
+}
+
+// scaledDecimal returns a decimal.Decimal as an integer of the given scale.
+func scaledDecimal(builder interface{ Type() arrow.DataType }, v any, scale int32) (*big.Int, error) {
+	d, ok := v.(decimal.Decimal)
+	if !ok {
+		return nil, mismatch(builder, v)
+	}
+	return d.Shift(scale).BigInt(), nil
+}
+
+func mismatch(builder interface{ Type() arrow.DataType }, v any) error {
+	return fmt.Errorf("converting %T to Arrow %s is unsupported", v, builder.Type())
+}
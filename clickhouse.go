@@ -16,6 +16,7 @@ import (
 	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type Conn = driver.Conn
@@ -31,15 +32,22 @@ var (
 	ErrBatchInvalid              = errors.New("clickhouse: batch is invalid. check appended data is correct")
 	ErrBatchAlreadySent          = errors.New("clickhouse: batch has already been sent")
 	ErrBatchNotSent              = errors.New("clickhouse: invalid retry, batch not sent yet")
+	ErrBatchFull                 = errors.New("clickhouse: batch has reached its maximum size, flush or send it")
 	ErrAcquireConnTimeout        = errors.New("clickhouse: acquire conn timeout. you can increase the number of max open conn or the dial timeout")
 	ErrUnsupportedServerRevision = errors.New("clickhouse: unsupported server revision")
 	ErrBindMixedParamsFormats    = errors.New("clickhouse [bind]: mixed named, numeric or positional parameters")
 	ErrAcquireConnNoAddress      = errors.New("clickhouse: no valid address supplied")
 	ErrServerUnexpectedData      = errors.New("code: 101, message: Unexpected packet Data received from client")
 	ErrConnectionClosed          = errors.New("clickhouse: connection is closed")
-	ErrFormatNativeUnsupported   = errors.New("clickhouse: QueryFormat and InsertFormat are only supported over the HTTP protocol, where the server converts every format; connect with Options{Protocol: clickhouse.HTTP} or an http:// DSN")
+	ErrFormatNativeUnsupported   = errors.New("clickhouse: InsertFormat in formats other than Native and QueryFormat in block formats such as Parquet are only supported over the HTTP protocol, where the server converts every format; connect with Options{Protocol: clickhouse.HTTP} or an http:// DSN")
+	ErrBufferedInserterClosed    = errors.New("clickhouse: buffered inserter is closed")
+	ErrSSHAuthNativeOnly         = errors.New("clickhouse: SSH key authentication is only supported over the native protocol")
+	ErrCertificateAuthWithoutTLS = errors.New("clickhouse: certificate authentication requires TLS")
+	ErrClusterSecretNativeOnly   = errors.New("clickhouse: cluster secret authentication is only supported over the native protocol")
+	ErrExtremesHTTPUnsupported   = errors.New("clickhouse: extremes are only sent over the native protocol, the Native format used over HTTP leaves them out")
 
 	errConnMaxLifetimeExceeded = errors.New("clickhouse: connection max lifetime exceeded")
+	errCredentialsRotated      = errors.New("clickhouse: connection credentials were rotated")
 )
 
 type OpError struct {
@@ -71,13 +79,33 @@ func Open(opt *Options) (driver.Conn, error) {
 		opt = &Options{}
 	}
 	o := opt.setDefaults()
+	if err := o.checkCertificateAuth(); err != nil {
+		return nil, err
+	}
+	inst, err := newInstrumentation(o.Telemetry)
+	if err != nil {
+		return nil, err
+	}
+	o.instrumentation = inst
 
 	conn := &clickhouse{
 		opt:       o,
-		idle:      newConnPool(o.ConnMaxLifetime, o.MaxIdleConns),
+		stats:     &poolStats{},
 		open:      make(chan struct{}, o.MaxOpenConns),
 		closeOnce: &sync.Once{},
 		closed:    &atomic.Bool{},
+		sessions:  newHTTPSessions(),
+	}
+	conn.idle = newConnPoolWithOptions(o.ConnMaxLifetime, o.MaxIdleConns, connPoolOptions{
+		maxIdleTime:  o.ConnMaxIdleTime,
+		minIdle:      o.MinIdleConns,
+		dial:         conn.dialIdle,
+		pingInterval: o.IdlePingInterval,
+		pingTimeout:  o.DialTimeout,
+		stats:        conn.stats,
+	})
+	if conn.poolMetrics, err = inst.registerPool(conn); err != nil {
+		return nil, fmt.Errorf("clickhouse [telemetry]: %w", err)
 	}
 
 	return conn, nil
@@ -98,10 +126,14 @@ type nativeTransport interface {
 	// healthCheck reports why the connection is unusable; nil means healthy.
 	healthCheck() error
 	connID() int
+	// addr returns the host:port of Options.Addr the connection was dialed to.
+	addr() string
 	connectedAtTime() time.Time
 	isReleased() bool
 	setReleased(released bool)
 	getLogger() *slog.Logger
+	// telemetry returns the connection state read by instrumented operations.
+	telemetry() *connTelemetry
 	// freeBuffer is called if Options.FreeBufOnConnRelease is set
 	freeBuffer()
 	close() error
@@ -113,6 +145,7 @@ type nativeTransportRelease func(nativeTransport, error)
 // idle connections.
 type connectionPooler interface {
 	Get(ctx context.Context) (nativeTransport, error)
+	GetFunc(ctx context.Context, match func(nativeTransport) bool) (nativeTransport, error)
 	Put(conn nativeTransport)
 	Len() int
 	Cap() int
@@ -123,11 +156,18 @@ type clickhouse struct {
 	opt    *Options
 	connID atomic.Int64
 
-	idle connectionPooler
-	open chan struct{}
+	idle  connectionPooler
+	open  chan struct{}
+	stats *poolStats
 
 	closeOnce *sync.Once
 	closed    *atomic.Bool
+
+	// sessions pins HTTP sessions to the host they were created on.
+	sessions *httpSessions
+
+	// poolMetrics is the registration of the pool metrics callback, nil without a MeterProvider.
+	poolMetrics metric.Registration
 }
 
 // Contributors always returns an empty slice.
@@ -152,13 +192,37 @@ func (ch *clickhouse) ServerVersion() (*driver.ServerVersion, error) {
 	return conn.serverVersion()
 }
 
-func (ch *clickhouse) Query(ctx context.Context, query string, args ...any) (rows driver.Rows, err error) {
+func (ch *clickhouse) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	ctx, op := ch.opt.instrumentation.start(ctx, "query", query)
+	var result driver.Rows
+	err := ch.opt.RetryPolicy.do(ctx, ch.opt.logger(), "query", func() (err error) {
+		result, err = ch.query(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		op.end(err)
+		return nil, err
+	}
+	if r, ok := result.(*rows); ok && op != nil {
+		// the operation lasts until the result is drained
+		r.onClose = op.end
+	} else {
+		op.end(nil)
+	}
+	return result, nil
+}
+
+func (ch *clickhouse) query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
 	conn, err := ch.acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
 	conn.getLogger().Debug("executing query", slog.String("sql", query))
-	return conn.query(ctx, ch.release, query, args...)
+	rows, err := conn.query(ctx, ch.release, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
 }
 
 func (ch *clickhouse) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
@@ -173,7 +237,15 @@ func (ch *clickhouse) QueryRow(ctx context.Context, query string, args ...any) d
 	return conn.queryRow(ctx, ch.release, query, args...)
 }
 
-func (ch *clickhouse) Exec(ctx context.Context, query string, args ...any) error {
+func (ch *clickhouse) Exec(ctx context.Context, query string, args ...any) (err error) {
+	ctx, op := ch.opt.instrumentation.start(ctx, "exec", query)
+	defer func() { op.end(err) }()
+	return ch.opt.RetryPolicy.do(ctx, ch.opt.logger(), "exec", func() error {
+		return ch.exec(ctx, query, args...)
+	})
+}
+
+func (ch *clickhouse) exec(ctx context.Context, query string, args ...any) error {
 	conn, err := ch.acquire(ctx)
 	if err != nil {
 		return err
@@ -195,8 +267,10 @@ func (ch *clickhouse) Exec(ctx context.Context, query string, args ...any) error
 	return nil
 }
 
-func (ch *clickhouse) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
-	conn, err := ch.acquire(ctx)
+func (ch *clickhouse) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (_ driver.Batch, err error) {
+	opCtx, op := ch.opt.instrumentation.start(ctx, "prepare_batch", query)
+	defer func() { op.end(err) }()
+	conn, err := ch.acquire(opCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -248,16 +322,30 @@ func (ch *clickhouse) Ping(ctx context.Context) (err error) {
 }
 
 func (ch *clickhouse) Stats() driver.Stats {
-	return driver.Stats{
+	stats := driver.Stats{
 		Open:         len(ch.open),
 		MaxOpenConns: cap(ch.open),
 
 		Idle:         ch.idle.Len(),
 		MaxIdleConns: ch.idle.Cap(),
 	}
+	ch.stats.fill(&stats)
+	return stats
 }
 
 func (ch *clickhouse) dial(ctx context.Context) (conn nativeTransport, err error) {
+	return ch.dialHost(ctx, "")
+}
+
+// dialIdle dials a connection for the idle pool to keep Options.MinIdleConns.
+func (ch *clickhouse) dialIdle(ctx context.Context) (nativeTransport, error) {
+	ctx, cancel := context.WithTimeout(ctx, ch.opt.DialTimeout)
+	defer cancel()
+	return ch.dial(ctx)
+}
+
+// dialHost dials addr, or the host picked by the dial strategy if addr is empty.
+func (ch *clickhouse) dialHost(ctx context.Context, addr string) (conn nativeTransport, err error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
@@ -273,10 +361,22 @@ func (ch *clickhouse) dial(ctx context.Context) (conn nativeTransport, err error
 		default:
 			conn, err = dial(ctx, addr, connID, opt)
 		}
+		ch.stats.dials.Add(1)
+		if err != nil {
+			ch.stats.dialFailed(addr)
+		}
 
 		return DialResult{conn}, err
 	}
 
+	if addr != "" {
+		result, err := dialFunc(ctx, addr, ch.opt)
+		if err != nil {
+			return nil, err
+		}
+		return result.conn, nil
+	}
+
 	dialStrategy := DefaultDialStrategy
 	if ch.opt.DialStrategy != nil {
 		dialStrategy = ch.opt.DialStrategy
@@ -335,11 +435,36 @@ func (ch *clickhouse) acquire(ctx context.Context) (conn nativeTransport, err er
 
 	select {
 	case ch.open <- struct{}{}:
-	case <-ctx.Done():
-		return nil, context.Cause(ctx)
+	default:
+		// MaxOpenConns are in use
+		ch.stats.waitCount.Add(1)
+		start := time.Now()
+		select {
+		case ch.open <- struct{}{}:
+			ch.stats.waitDuration.Add(int64(time.Since(start)))
+		case <-ctx.Done():
+			ch.stats.waitDuration.Add(int64(time.Since(start)))
+			return nil, context.Cause(ctx)
+		}
+	}
+
+	// requests of an HTTP session must reach the host holding its state
+	var session sessionOptions
+	if ch.opt.Protocol == HTTP {
+		session = queryOptionsSession(ctx)
+	}
+	pinned := ""
+	if session.id != "" {
+		pinned = ch.sessions.host(session.id)
 	}
 
-	conn, err = ch.idle.Get(ctx)
+	if pinned != "" {
+		conn, err = ch.idle.GetFunc(ctx, func(conn nativeTransport) bool {
+			return conn.addr() == pinned
+		})
+	} else {
+		conn, err = ch.idle.Get(ctx)
+	}
 	if err != nil && !errors.Is(err, errQueueEmpty) {
 		select {
 		case <-ch.open:
@@ -352,27 +477,43 @@ func (ch *clickhouse) acquire(ctx context.Context) (conn nativeTransport, err er
 		if badErr := conn.healthCheck(); badErr == nil {
 			conn.setReleased(false)
 			conn.getLogger().Debug("connection acquired from pool")
+			operationFromContext(ctx).attach(conn)
+			ch.pinSession(session, conn)
 			return conn, nil
 		} else {
 			conn.getLogger().Debug("closing bad connection from pool", slog.Any("reason", badErr))
+			ch.stats.badConnClosed.Add(1)
 			conn.close()
 		}
 	}
 
-	if conn, err = ch.dial(ctx); err != nil {
+	if conn, err = ch.dialHost(ctx, pinned); err != nil {
 		select {
 		case <-ch.open:
 		default:
 		}
+		if pinned != "" {
+			// the session is gone with its host, let the next request start over
+			ch.sessions.unpin(session.id)
+		}
 
 		return nil, err
 	}
 
 	conn.getLogger().Debug("new connection established")
+	operationFromContext(ctx).attach(conn)
+	ch.pinSession(session, conn)
 	return conn, nil
 
 }
 
+// pinSession pins the HTTP session to the host of conn, or extends the pin.
+func (ch *clickhouse) pinSession(session sessionOptions, conn nativeTransport) {
+	if session.id != "" {
+		ch.sessions.pin(session.id, conn.addr(), session.timeout)
+	}
+}
+
 func (ch *clickhouse) release(conn nativeTransport, err error) {
 	if conn.isReleased() {
 		return
@@ -392,12 +533,14 @@ func (ch *clickhouse) release(conn nativeTransport, err error) {
 
 	if err != nil {
 		conn.getLogger().Debug("connection closed due to error", slog.Any("error", err))
+		ch.stats.badConnClosed.Add(1)
 		conn.close()
 		return
 	} else if time.Since(conn.connectedAtTime()) >= ch.opt.ConnMaxLifetime {
 		conn.getLogger().Debug("connection closed: lifetime expired",
 			slog.Duration("age", time.Since(conn.connectedAtTime())),
 			slog.Duration("max_lifetime", ch.opt.ConnMaxLifetime))
+		ch.stats.maxLifetimeClosed.Add(1)
 		conn.close()
 		return
 	}
@@ -417,6 +560,9 @@ func (ch *clickhouse) release(conn nativeTransport, err error) {
 
 func (ch *clickhouse) Close() (err error) {
 	ch.closeOnce.Do(func() {
+		if ch.poolMetrics != nil {
+			ch.poolMetrics.Unregister()
+		}
 		err = ch.idle.Close()
 		ch.closed.Store(true)
 	})
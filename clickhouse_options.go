@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/ClickHouse/ch-go/compress"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/churl"
 )
@@ -66,6 +67,23 @@ type Auth struct { // has_control_character
 
 	Username string
 	Password string
+	// CredentialsProvider supplies the username and password in place of
+	// Username and Password, so they can be rotated. GetJWT takes precedence.
+	CredentialsProvider CredentialsProvider
+	// SSHSigner authenticates the user with an SSH key instead of a
+	// password, for users IDENTIFIED WITH ssh_key. Native protocol only.
+	SSHSigner ssh.Signer
+	// CertificateAuth authenticates the user with the TLS client certificate
+	// instead of a password, for users IDENTIFIED WITH ssl_certificate. The
+	// password is not sent. Requires TLS.
+	CertificateAuth bool
+	// ClusterSecret authenticates as a server of Cluster sharing its
+	// <secret>, as clickhouse-server does for distributed queries, instead of
+	// with a password. Queries run on behalf of their initial user without
+	// its password: Username, or the user set with WithInitialUser. Native
+	// protocol only.
+	Cluster       string
+	ClusterSecret string
 }
 
 type Compression struct {
@@ -82,6 +100,22 @@ const (
 	ConnOpenRandom
 )
 
+// TransactionMode selects what transactions of the database/sql driver do.
+type TransactionMode uint8
+
+const (
+	// TransactionBatch is the default mode: a transaction only delimits the
+	// batches prepared in it, which are sent on Commit. Nothing is sent to
+	// the server on Begin, and Rollback closes the connection.
+	TransactionBatch TransactionMode = iota
+	// TransactionServer runs every transaction as an experimental server
+	// transaction: Begin, Commit and Rollback issue BEGIN TRANSACTION, COMMIT
+	// and ROLLBACK on the connection the transaction is pinned to. Batches
+	// prepared in the transaction are sent before COMMIT. Transactions must
+	// be enabled on the server and require the native protocol.
+	TransactionServer
+)
+
 type Protocol int
 
 const (
@@ -125,6 +159,16 @@ type Options struct {
 	DialContext  func(ctx context.Context, addr string) (net.Conn, error)
 	DialStrategy func(ctx context.Context, connID int, options *Options, dial Dial) (DialResult, error)
 
+	// TLSCertFile and TLSKeyFile are the PEM files of the client certificate
+	// presented to the server, and TLSCAFile the PEM file of the certificates
+	// the server is verified with instead of the system roots. They imply TLS
+	// and are read again once changed, the client certificate by each TLS
+	// handshake and the CA certificates by new connections, so certificates
+	// can be rotated without reopening the client.
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSCAFile   string
+
 	// Deprecated: Use Logger instead. Debug enables legacy debug logging to stdout.
 	// For structured logging with levels, use the Logger field.
 	Debug bool
@@ -155,6 +199,9 @@ type Options struct {
 	MaxOpenConns         int           // default MaxIdleConns + 5
 	MaxIdleConns         int           // default 5
 	ConnMaxLifetime      time.Duration // default 1 hour
+	ConnMaxIdleTime      time.Duration // close connections idle for longer, default no limit
+	MinIdleConns         int           // idle connections dialed by Open and kept dialed in the background, at most MaxIdleConns
+	IdlePingInterval     time.Duration // ping connections idle for longer, closing the broken ones
 	ConnOpenStrategy     ConnOpenStrategy
 	FreeBufOnConnRelease bool              // drop preserved memory buffer after each query
 	HttpHeaders          map[string]string // set additional headers on HTTP requests
@@ -173,11 +220,31 @@ type Options struct {
 
 	scheme string
 
+	// credentials tracks Auth.CredentialsProvider, set by setDefaults.
+	credentials *credentialsCache
+	// tlsFiles loads TLSCertFile, TLSKeyFile and TLSCAFile, set by setDefaults.
+	tlsFiles *tlsFiles
+
+	// instrumentation is created from Telemetry by Open.
+	instrumentation *instrumentation
+
 	// ReadTimeout is the maximum duration the client will wait for ClickHouse
 	// to respond to a single Read call for bytes over the connection.
 	// Can be overridden with context.WithDeadline.
 	ReadTimeout time.Duration
 
+	// RetryPolicy retries Query, Exec, Select and Batch.Send on transient
+	// failures. Nil disables retries. See RetryPolicy for the caveats.
+	RetryPolicy *RetryPolicy
+
+	// TransactionMode selects what transactions of the database/sql driver
+	// do. Defaults to TransactionBatch.
+	TransactionMode TransactionMode
+
+	// Telemetry enables client-side OpenTelemetry spans and metrics. Nil
+	// disables them; WithSpan still forwards a caller's span to the server.
+	Telemetry *Telemetry
+
 	// Set a custom transport for the http client.
 	// The default transport configured by the library is passed in as an argument.
 	TransportFunc func(*http.Transport) (http.RoundTripper, error)
@@ -300,6 +367,19 @@ func (o *Options) fromDSN(in string) error {
 			if tlsServerName == "" {
 				return fmt.Errorf("clickhouse [dsn parse]: tls_server_name must not be empty")
 			}
+		case "tls_cert_file":
+			o.TLSCertFile = params.Get(v)
+		case "tls_key_file":
+			o.TLSKeyFile = params.Get(v)
+		case "tls_ca_file":
+			o.TLSCAFile = params.Get(v)
+		case "certificate_auth":
+			certificateAuth := params.Get(v)
+			if certificateAuth == "" {
+				o.Auth.CertificateAuth = true
+			} else if o.Auth.CertificateAuth, err = strconv.ParseBool(certificateAuth); err != nil {
+				return fmt.Errorf("clickhouse [dsn parse]:certificate_auth: %s", err)
+			}
 		case "connection_open_strategy":
 			switch params.Get(v) {
 			case "in_order":
@@ -309,6 +389,15 @@ func (o *Options) fromDSN(in string) error {
 			case "random":
 				o.ConnOpenStrategy = ConnOpenRandom
 			}
+		case "transaction_mode":
+			switch params.Get(v) {
+			case "batch":
+				o.TransactionMode = TransactionBatch
+			case "server":
+				o.TransactionMode = TransactionServer
+			default:
+				return fmt.Errorf("clickhouse [dsn parse]: transaction_mode: unknown mode %q", params.Get(v))
+			}
 		case "max_open_conns":
 			maxOpenConns, err := strconv.Atoi(params.Get(v))
 			if err != nil {
@@ -327,6 +416,24 @@ func (o *Options) fromDSN(in string) error {
 				return fmt.Errorf("conn_max_lifetime invalid value: %w", err)
 			}
 			o.ConnMaxLifetime = connMaxLifetime
+		case "conn_max_idle_time":
+			connMaxIdleTime, err := time.ParseDuration(params.Get(v))
+			if err != nil {
+				return fmt.Errorf("conn_max_idle_time invalid value: %w", err)
+			}
+			o.ConnMaxIdleTime = connMaxIdleTime
+		case "min_idle_conns":
+			minIdleConns, err := strconv.Atoi(params.Get(v))
+			if err != nil {
+				return fmt.Errorf("min_idle_conns invalid value: %w", err)
+			}
+			o.MinIdleConns = minIdleConns
+		case "idle_ping_interval":
+			idlePingInterval, err := time.ParseDuration(params.Get(v))
+			if err != nil {
+				return fmt.Errorf("idle_ping_interval invalid value: %w", err)
+			}
+			o.IdlePingInterval = idlePingInterval
 		case "username":
 			o.Auth.Username = params.Get(v)
 		case "password":
@@ -374,6 +481,12 @@ func (o *Options) fromDSN(in string) error {
 	if tlsServerName != "" && !secure {
 		return fmt.Errorf("clickhouse [dsn parse]: tls_server_name requires secure=true")
 	}
+	if (o.TLSCertFile != "" || o.TLSKeyFile != "" || o.TLSCAFile != "" || o.Auth.CertificateAuth) && !secure {
+		return fmt.Errorf("clickhouse [dsn parse]: tls_cert_file, tls_key_file, tls_ca_file and certificate_auth require secure=true")
+	}
+	if (o.TLSCertFile == "") != (o.TLSKeyFile == "") {
+		return fmt.Errorf("clickhouse [dsn parse]: tls_cert_file and tls_key_file must be set together")
+	}
 	if secure {
 		o.TLS = &tls.Config{
 			InsecureSkipVerify: skipVerify,
@@ -418,6 +531,13 @@ func (o Options) setDefaults() *Options {
 	if o.ConnMaxLifetime == 0 {
 		o.ConnMaxLifetime = time.Hour
 	}
+	o.MinIdleConns = min(max(o.MinIdleConns, 0), o.MaxIdleConns)
+	if o.Auth.CredentialsProvider != nil {
+		o.credentials = &credentialsCache{provider: o.Auth.CredentialsProvider}
+	}
+	if o.tlsFiles = newTLSFiles(&o); o.tlsFiles != nil && o.TLS == nil {
+		o.TLS = &tls.Config{}
+	}
 	if o.BlockBufferSize <= 0 {
 		o.BlockBufferSize = 2
 	}
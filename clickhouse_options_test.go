@@ -257,6 +257,47 @@ func TestParseDSN(t *testing.T) {
 			nil,
 			"clickhouse [dsn parse]: tls_server_name requires secure=true",
 		},
+		{
+			"native protocol with client certificate files",
+			"clickhouse://user@127.0.0.1/test_database?secure=true&tls_cert_file=/certs/client.crt&tls_key_file=/certs/client.key&tls_ca_file=/certs/ca.crt&certificate_auth",
+			&Options{
+				Protocol: Native,
+				TLS: &tls.Config{
+					InsecureSkipVerify: false,
+					ServerName:         "",
+				},
+				TLSCertFile: "/certs/client.crt",
+				TLSKeyFile:  "/certs/client.key",
+				TLSCAFile:   "/certs/ca.crt",
+				Addr:        []string{"127.0.0.1"},
+				Settings:    Settings{},
+				Auth: Auth{
+					Database:        "test_database",
+					Username:        "user",
+					CertificateAuth: true,
+				},
+				scheme: "clickhouse",
+			},
+			"",
+		},
+		{
+			"native protocol with client certificate files without secure",
+			"clickhouse://127.0.0.1/test_database?tls_ca_file=/certs/ca.crt",
+			nil,
+			"clickhouse [dsn parse]: tls_cert_file, tls_key_file, tls_ca_file and certificate_auth require secure=true",
+		},
+		{
+			"native protocol with client certificate without key",
+			"clickhouse://127.0.0.1/test_database?secure&tls_cert_file=/certs/client.crt",
+			nil,
+			"clickhouse [dsn parse]: tls_cert_file and tls_key_file must be set together",
+		},
+		{
+			"native protocol with certificate_auth (bad)",
+			"clickhouse://127.0.0.1/test_database?secure&certificate_auth=ture",
+			nil,
+			"clickhouse [dsn parse]:certificate_auth: strconv.ParseBool: parsing \"ture\": invalid syntax",
+		},
 		{
 			"native protocol with secure (bad)",
 			"clickhouse://127.0.0.1/test_database?secure=ture",
@@ -487,14 +528,17 @@ func TestParseDSN(t *testing.T) {
 		},
 		{
 			"client connection pool settings",
-			"clickhouse://127.0.0.1/test_database?max_open_conns=-1&max_idle_conns=0&conn_max_lifetime=1h",
+			"clickhouse://127.0.0.1/test_database?max_open_conns=-1&max_idle_conns=0&conn_max_lifetime=1h&conn_max_idle_time=5m&min_idle_conns=2&idle_ping_interval=30s",
 			&Options{
-				Protocol:        Native,
-				MaxOpenConns:    -1,
-				MaxIdleConns:    0,
-				ConnMaxLifetime: time.Hour,
-				Addr:            []string{"127.0.0.1"},
-				Settings:        Settings{},
+				Protocol:         Native,
+				MaxOpenConns:     -1,
+				MaxIdleConns:     0,
+				ConnMaxLifetime:  time.Hour,
+				ConnMaxIdleTime:  5 * time.Minute,
+				MinIdleConns:     2,
+				IdlePingInterval: 30 * time.Second,
+				Addr:             []string{"127.0.0.1"},
+				Settings:         Settings{},
 				Auth: Auth{
 					Database: "test_database",
 				},
@@ -563,6 +607,24 @@ func TestParseDSN(t *testing.T) {
 			},
 			"",
 		},
+		{
+			"server transactions",
+			"clickhouse://127.0.0.1/?transaction_mode=server",
+			&Options{
+				Protocol:        Native,
+				Addr:            []string{"127.0.0.1"},
+				Settings:        Settings{},
+				TransactionMode: TransactionServer,
+				scheme:          "clickhouse",
+			},
+			"",
+		},
+		{
+			"unknown transaction mode",
+			"clickhouse://127.0.0.1/?transaction_mode=xa",
+			nil,
+			`clickhouse [dsn parse]: transaction_mode: unknown mode "xa"`,
+		},
 	}
 
 	for _, testCase := range testCases {
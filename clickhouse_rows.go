@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"io"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
 )
 
@@ -12,11 +13,19 @@ type rows struct {
 	row       int
 	block     *proto.Block
 	totals    *proto.Block
+	extremes  *proto.Block
 	errors    chan error
 	stream    chan *proto.Block
 	columns   []string
 	structMap *structMap
 	closed    bool
+	// current is the block returned by the last NextBlock.
+	current *proto.Block
+	// onClose is called once with the final error when the rows are closed.
+	onClose func(error)
+	// extremesErr is returned by Extremes for the results of a protocol
+	// that doesn't carry extremes.
+	extremesErr error
 }
 
 func (r *rows) Next() (result bool) {
@@ -43,9 +52,8 @@ next:
 			if block == nil {
 				return false
 			}
-			if block.Packet == proto.ServerTotals {
-				r.row, r.block, r.totals = 0, nil, block
-				return false
+			if r.keep(block) {
+				goto next
 			}
 			r.row, r.block = 0, block
 		}
@@ -70,6 +78,20 @@ func (r *rows) ScanStruct(dest any) error {
 	return r.Scan(values...)
 }
 
+// keep stores a totals or extremes block, which follow the result rows
+// rather than being part of them, and reports whether block was one.
+func (r *rows) keep(block *proto.Block) bool {
+	switch block.Packet {
+	case proto.ServerTotals:
+		r.totals = block
+	case proto.ServerExtremes:
+		r.extremes = block
+	default:
+		return false
+	}
+	return true
+}
+
 func (r *rows) Totals(dest ...any) error {
 	if r.totals == nil {
 		return sql.ErrNoRows
@@ -77,11 +99,35 @@ func (r *rows) Totals(dest ...any) error {
 	return scan(r.totals, 1, dest...)
 }
 
+var _ driver.ExtremesRows = (*rows)(nil)
+
+func (r *rows) Extremes(min, max []any) error {
+	if r.extremesErr != nil {
+		return r.extremesErr
+	}
+	if r.extremes == nil || r.extremes.Rows() < 2 {
+		return sql.ErrNoRows
+	}
+	if err := scan(r.extremes, 1, min...); err != nil {
+		return err
+	}
+	return scan(r.extremes, 2, max...)
+}
+
 func (r *rows) Columns() []string {
 	return r.columns
 }
 
 func (r *rows) Close() error {
+	alreadyClosed := r.closed
+	err := r.close()
+	if r.onClose != nil && !alreadyClosed {
+		r.onClose(err)
+	}
+	return err
+}
+
+func (r *rows) close() error {
 	r.closed = true
 	if r.errors == nil && r.stream == nil {
 		return r.err
@@ -143,8 +189,7 @@ func (r *rows) HasData() bool {
 			if block == nil {
 				return false
 			}
-			if block.Packet == proto.ServerTotals {
-				r.totals = block
+			if r.keep(block) {
 				continue
 			}
 			r.row = 0
@@ -0,0 +1,112 @@
+package clickhouse
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+type rowsBlock struct {
+	block   *proto.Block
+	columns []string
+}
+
+func (b *rowsBlock) Rows() int {
+	return b.block.Rows()
+}
+
+func (b *rowsBlock) Columns() []string {
+	return b.columns
+}
+
+func (b *rowsBlock) Column(i int) column.Interface {
+	return b.block.Columns[i]
+}
+
+func (b *rowsBlock) ColumnByName(name string) column.Interface {
+	for i, c := range b.columns {
+		if c == name {
+			return b.block.Columns[i]
+		}
+	}
+	return nil
+}
+
+var _ driver.BlockRows = (*rows)(nil)
+
+func (r *rows) NextBlock() (result bool) {
+	defer func() {
+		if !result {
+			r.current = nil
+			r.Close()
+		}
+	}()
+	if r.block == nil {
+		return false
+	}
+	// the current block was returned already or partially read by Next
+	for r.row != 0 || r.block.Rows() == 0 {
+		if r.stream == nil {
+			return false
+		}
+		select {
+		case err := <-r.errors:
+			if err != nil {
+				r.err = err
+				return false
+			}
+		case block := <-r.stream:
+			if block == nil {
+				return false
+			}
+			if r.keep(block) {
+				continue
+			}
+			r.row, r.block = 0, block
+		}
+	}
+	r.row = r.block.Rows()
+	r.current = r.block
+	return true
+}
+
+func (r *rows) Block() driver.Block {
+	if r.current == nil {
+		return nil
+	}
+	return &rowsBlock{block: r.current, columns: r.columns}
+}
+
+// ColumnValues returns all values of col as a []T, for reading a block
+// returned by driver.BlockRows without scanning row by row:
+//
+//	blocks := rows.(driver.BlockRows)
+//	for blocks.NextBlock() {
+//		ids, err := clickhouse.ColumnValues[uint64](blocks.Block().ColumnByName("id"))
+//		...
+//	}
+//
+// Numeric columns (Int8 to Int64, UInt8 to UInt64, Float32 and Float64)
+// return their underlying slice without copying; it must not be modified.
+// String columns return a copy. Other column types are not supported.
+func ColumnValues[T any](col column.Interface) ([]T, error) {
+	if col == nil {
+		return nil, &OpError{Op: "ColumnValues", Err: errors.New("nil column")}
+	}
+	if data, ok := col.(interface{ Data() []T }); ok {
+		return data.Data(), nil
+	}
+	return nil, &OpError{
+		Op:         "ColumnValues",
+		ColumnName: col.Name(),
+		Err: &column.ColumnConverterError{
+			Op:   "ColumnValues",
+			To:   fmt.Sprintf("[]%s", reflect.TypeFor[T]()),
+			From: string(col.Type()),
+		},
+	}
+}
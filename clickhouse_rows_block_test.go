@@ -0,0 +1,85 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+)
+
+func TestRowsNextBlock(t *testing.T) {
+	conn := &blockConn{blocks: [][]int64{{1, 2}, {}, {3}, {4, 5, 6}}}
+	r := conn.newRows(context.Background())
+	assert.Nil(t, r.Block())
+
+	var (
+		ids   []int64
+		sizes []int
+	)
+	for r.NextBlock() {
+		block := r.Block()
+		require.NotNil(t, block)
+		assert.Equal(t, []string{"id", "name"}, block.Columns())
+		sizes = append(sizes, block.Rows())
+
+		values, err := ColumnValues[int64](block.ColumnByName("id"))
+		require.NoError(t, err)
+		ids = append(ids, values...)
+
+		names, err := ColumnValues[string](block.Column(1))
+		require.NoError(t, err)
+		assert.Len(t, names, block.Rows())
+		assert.Equal(t, "row", names[0])
+	}
+	require.NoError(t, r.Err())
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 6}, ids)
+	assert.Equal(t, []int{2, 1, 3}, sizes)
+	assert.Nil(t, r.Block())
+	assert.True(t, r.closed)
+}
+
+func TestRowsNextBlockAfterNext(t *testing.T) {
+	conn := &blockConn{blocks: [][]int64{{1, 2}, {3}, {4, 5}}}
+	r := conn.newRows(context.Background())
+
+	// the partially read first block is skipped
+	require.True(t, r.Next())
+	require.True(t, r.NextBlock())
+	ids, err := ColumnValues[int64](r.Block().Column(0))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, ids)
+
+	// Next continues after the block
+	var id int64
+	var name string
+	require.True(t, r.Next())
+	require.NoError(t, r.Scan(&id, &name))
+	assert.Equal(t, int64(4), id)
+	require.True(t, r.Next())
+	assert.False(t, r.Next())
+	assert.False(t, r.NextBlock())
+}
+
+func TestColumnValuesUnsupported(t *testing.T) {
+	conn := &blockConn{blocks: [][]int64{{1}}}
+	r := conn.newRows(context.Background())
+	defer r.Close()
+	require.True(t, r.NextBlock())
+
+	_, err := ColumnValues[string](r.Block().ColumnByName("id"))
+	var opErr *OpError
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "id", opErr.ColumnName)
+	assert.EqualError(t, err, "clickhouse [ColumnValues]: (id) converting Int64 to []string is unsupported")
+
+	_, err = ColumnValues[int64](r.Block().ColumnByName("missing"))
+	assert.Error(t, err)
+
+	col, err := column.Type("Date").Column("d", &column.ServerContext{})
+	require.NoError(t, err)
+	_, err = ColumnValues[int64](col)
+	assert.Error(t, err)
+}
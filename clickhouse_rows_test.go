@@ -1,12 +1,21 @@
 package clickhouse
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	chdriver "github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
 )
 
@@ -117,3 +126,84 @@ func TestReadWithEmptyBlock(t *testing.T) {
 		})
 	}
 }
+
+func TestRowsTotalsAndExtremes(t *testing.T) {
+	newBlock := func(packet byte, values ...int64) *proto.Block {
+		block := &proto.Block{Packet: packet, ServerContext: &column.ServerContext{}}
+		block.AddColumn("n", "Int64")
+		for _, v := range values {
+			block.Append(v)
+		}
+		return block
+	}
+	newRows := func() *rows {
+		stream := make(chan *proto.Block, 4)
+		stream <- newBlock(proto.ServerData, 3)
+		stream <- newBlock(proto.ServerTotals, 6)
+		stream <- newBlock(proto.ServerExtremes, 1, 3)
+		close(stream)
+		return &rows{block: newBlock(proto.ServerData, 1, 2), stream: stream, columns: []string{"n"}}
+	}
+
+	r := newRows()
+	var (
+		values        []int64
+		n, minN, maxN int64
+	)
+	extremes, ok := chdriver.Rows(r).(chdriver.ExtremesRows)
+	require.True(t, ok)
+	assert.ErrorIs(t, extremes.Extremes([]any{&minN}, []any{&maxN}), sql.ErrNoRows)
+	for r.Next() {
+		require.NoError(t, r.Scan(&n))
+		values = append(values, n)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, values)
+	require.NoError(t, r.Totals(&n))
+	assert.Equal(t, int64(6), n)
+	require.NoError(t, extremes.Extremes([]any{&minN}, []any{&maxN}))
+	assert.Equal(t, int64(1), minN)
+	assert.Equal(t, int64(3), maxN)
+
+	r = newRows()
+	var sizes []int
+	for r.NextBlock() {
+		sizes = append(sizes, r.Block().Rows())
+	}
+	assert.Equal(t, []int{2, 1}, sizes)
+	require.NoError(t, r.Extremes([]any{&minN}, []any{&maxN}))
+	assert.Equal(t, int64(3), maxN)
+
+	// database/sql reads totals and extremes as the next result sets
+	std := &stdRows{rows: newRows(), logger: slog.New(slog.DiscardHandler)}
+	resultSets := [][]int64{}
+	for {
+		var set []int64
+		for {
+			dest := []driver.Value{nil}
+			if err := std.Next(dest); err != nil {
+				require.ErrorIs(t, err, io.EOF)
+				break
+			}
+			set = append(set, dest[0].(int64))
+		}
+		resultSets = append(resultSets, set)
+		if !std.HasNextResultSet() {
+			break
+		}
+		require.NoError(t, std.NextResultSet())
+	}
+	assert.Equal(t, [][]int64{{1, 2, 3}, {6}, {1, 3}}, resultSets)
+	assert.ErrorIs(t, std.NextResultSet(), io.EOF)
+}
+
+func TestHTTPRowsExtremes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	r, err := newTestHTTPConnect(t, srv.URL).query(context.Background(), func(nativeTransport, error) {}, "SELECT 1 SETTINGS extremes = 1")
+	require.NoError(t, err)
+	var minN, maxN int64
+	assert.ErrorIs(t, r.Extremes([]any{&minN}, []any{&maxN}), ErrExtremesHTTPUnsupported)
+}
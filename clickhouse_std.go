@@ -77,6 +77,7 @@ func (o *stdConnOpener) Connect(ctx context.Context) (_ driver.Conn, err error)
 				slog.String("addr", o.opt.Addr[num]),
 			)
 			return &stdDriver{
+				opt:    o.opt,
 				conn:   conn,
 				logger: connLogger,
 			}, nil
@@ -116,6 +117,7 @@ func Connector(opt *Options) driver.Connector {
 	logger := o.logger().With(slog.String("component", "std-driver"))
 
 	return &stdConnOpener{
+		err:    o.checkCertificateAuth(),
 		opt:    o,
 		logger: logger,
 	}
@@ -130,6 +132,7 @@ func OpenDB(opt *Options) *sql.DB {
 	logger := o.logger().With(slog.String("component", "std-driver"))
 
 	db := sql.OpenDB(&stdConnOpener{
+		err:    o.checkCertificateAuth(),
 		opt:    o,
 		logger: logger,
 	})
@@ -140,6 +143,7 @@ func OpenDB(opt *Options) *sql.DB {
 	db.SetMaxIdleConns(o.MaxIdleConns)
 	db.SetMaxOpenConns(o.MaxOpenConns)
 	db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(o.ConnMaxIdleTime)
 
 	return db
 }
@@ -208,6 +212,9 @@ func (std *stdDriver) Begin() (driver.Tx, error) {
 		std.logger.Debug("begin: connection is bad", slog.Any("reason", err))
 		return nil, driver.ErrBadConn
 	}
+	if std.opt != nil && std.opt.TransactionMode == TransactionServer {
+		return std.beginServerTx(context.Background(), driver.TxOptions{})
+	}
 
 	return std, nil
 }
@@ -217,6 +224,9 @@ func (std *stdDriver) BeginTx(ctx context.Context, opts driver.TxOptions) (drive
 		std.logger.Debug("begin tx: connection is bad", slog.Any("reason", err))
 		return nil, driver.ErrBadConn
 	}
+	if std.opt != nil && std.opt.TransactionMode == TransactionServer {
+		return std.beginServerTx(ctx, opts)
+	}
 
 	return std, nil
 }
@@ -248,6 +258,82 @@ func (std *stdDriver) Rollback() error {
 
 var _ driver.Tx = (*stdDriver)(nil)
 
+// stdServerTx is a server transaction, see TransactionServer.
+type stdServerTx struct {
+	std *stdDriver
+}
+
+func (std *stdDriver) beginServerTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, ok := std.conn.(*httpConnect); ok {
+		return nil, errors.New("clickhouse: server transactions require the native protocol")
+	}
+	// ClickHouse transactions provide snapshot isolation only
+	switch level := sql.IsolationLevel(opts.Isolation); level {
+	case sql.LevelDefault, sql.LevelSnapshot:
+	default:
+		return nil, fmt.Errorf("clickhouse: unsupported transaction isolation level: %s", level)
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("clickhouse: read-only transactions are not supported")
+	}
+	if err := std.conn.exec(ctx, "BEGIN TRANSACTION"); err != nil {
+		if isConnBrokenError(err) {
+			std.logger.Error("begin transaction got a fatal error, resetting connection", slog.Any("error", err))
+			return nil, driver.ErrBadConn
+		}
+		std.logger.Error("begin transaction error", slog.Any("error", err))
+		return nil, err
+	}
+	std.commit = nil
+	return &stdServerTx{std: std}, nil
+}
+
+func (tx *stdServerTx) Commit() error {
+	std := tx.std
+	if commit := std.commit; commit != nil {
+		std.commit = nil
+		if err := commit(); err != nil {
+			std.logger.Error("commit: sending batch failed, rolling back", slog.Any("error", err))
+			// the transaction can't be committed after a failed INSERT
+			tx.abort()
+			return err
+		}
+	}
+	if err := std.conn.exec(context.Background(), "COMMIT"); err != nil {
+		std.logger.Error("commit error", slog.Any("error", err))
+		tx.abort()
+		return err
+	}
+	return nil
+}
+
+// abort ends a failed transaction so the connection can be reused, or
+// closes the connection if that fails.
+func (tx *stdServerTx) abort() {
+	if err := tx.std.conn.exec(context.Background(), "ROLLBACK"); err != nil {
+		tx.std.conn.close()
+	}
+}
+
+func (tx *stdServerTx) Rollback() error {
+	std := tx.std
+	if std.commit != nil {
+		// a prepared batch holds its INSERT open on the connection, the
+		// server rolls the transaction back when the connection closes
+		std.commit = nil
+		std.conn.close()
+		return nil
+	}
+	if err := std.conn.exec(context.Background(), "ROLLBACK"); err != nil {
+		std.logger.Error("rollback error", slog.Any("error", err))
+		std.conn.close()
+		return err
+	}
+	return nil
+}
+
+var _ driver.Tx = (*stdServerTx)(nil)
+
 func (std *stdDriver) CheckNamedValue(nv *driver.NamedValue) error { return nil }
 
 var _ driver.NamedValueChecker = (*stdDriver)(nil)
@@ -467,14 +553,19 @@ func (r *stdRows) Next(dest []driver.Value) error {
 }
 
 func (r *stdRows) HasNextResultSet() bool {
-	return r.rows.totals != nil
+	return r.rows.totals != nil || r.rows.extremes != nil
 }
 
+// NextResultSet moves to the totals row, then to the min and max rows of the
+// extremes, when the query returned them.
 func (r *stdRows) NextResultSet() error {
 	switch {
 	case r.rows.totals != nil:
-		r.rows.block = r.rows.totals
+		r.rows.row, r.rows.block = 0, r.rows.totals
 		r.rows.totals = nil
+	case r.rows.extremes != nil:
+		r.rows.row, r.rows.block = 0, r.rows.extremes
+		r.rows.extremes = nil
 	default:
 		return io.EOF
 	}
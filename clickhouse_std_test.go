@@ -0,0 +1,156 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chdriver "github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// fakeStdConn records the statements executed by the database/sql driver.
+type fakeStdConn struct {
+	stdConnect
+	execs   []string
+	execErr map[string]error
+	closed  bool
+	batch   *fakeStdBatch
+}
+
+func (c *fakeStdConn) healthCheck() error {
+	if c.closed {
+		return errors.New("closed")
+	}
+	return nil
+}
+
+func (c *fakeStdConn) close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeStdConn) exec(ctx context.Context, query string, args ...any) error {
+	c.execs = append(c.execs, query)
+	return c.execErr[query]
+}
+
+func (c *fakeStdConn) prepareBatch(ctx context.Context, release nativeTransportRelease, acquire nativeTransportAcquire, query string, options chdriver.PrepareBatchOptions) (chdriver.Batch, error) {
+	c.batch = &fakeStdBatch{conn: c}
+	return c.batch, nil
+}
+
+type fakeStdBatch struct {
+	chdriver.Batch
+	conn    *fakeStdConn
+	rows    int
+	sendErr error
+}
+
+func (b *fakeStdBatch) Append(v ...any) error {
+	b.rows++
+	return nil
+}
+
+func (b *fakeStdBatch) Send() error {
+	b.conn.execs = append(b.conn.execs, "INSERT")
+	return b.sendErr
+}
+
+func newServerTxDriver() (*stdDriver, *fakeStdConn) {
+	conn := &fakeStdConn{execErr: map[string]error{}}
+	return &stdDriver{
+		opt:    &Options{TransactionMode: TransactionServer},
+		conn:   conn,
+		logger: newNoopLogger(),
+	}, conn
+}
+
+func TestStdServerTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("commit", func(t *testing.T) {
+		std, conn := newServerTxDriver()
+		tx, err := std.BeginTx(ctx, driver.TxOptions{})
+		require.NoError(t, err)
+		_, err = std.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil)
+		require.NoError(t, err)
+		stmt, err := std.PrepareContext(ctx, "INSERT INTO t")
+		require.NoError(t, err)
+		_, err = stmt.(*stdBatch).Exec([]driver.Value{1})
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+		assert.Equal(t, []string{"BEGIN TRANSACTION", "INSERT INTO t VALUES (1)", "INSERT", "COMMIT"}, conn.execs)
+		assert.False(t, conn.closed)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		std, conn := newServerTxDriver()
+		tx, err := std.BeginTx(ctx, driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSnapshot)})
+		require.NoError(t, err)
+		require.NoError(t, tx.Rollback())
+		assert.Equal(t, []string{"BEGIN TRANSACTION", "ROLLBACK"}, conn.execs)
+		assert.False(t, conn.closed)
+	})
+
+	t.Run("rollback with pending batch closes the connection", func(t *testing.T) {
+		std, conn := newServerTxDriver()
+		tx, err := std.Begin()
+		require.NoError(t, err)
+		_, err = std.PrepareContext(ctx, "INSERT INTO t")
+		require.NoError(t, err)
+		require.NoError(t, tx.Rollback())
+		assert.Equal(t, []string{"BEGIN TRANSACTION"}, conn.execs)
+		assert.True(t, conn.closed)
+	})
+
+	t.Run("failed batch rolls back", func(t *testing.T) {
+		std, conn := newServerTxDriver()
+		tx, err := std.BeginTx(ctx, driver.TxOptions{})
+		require.NoError(t, err)
+		_, err = std.PrepareContext(ctx, "INSERT INTO t")
+		require.NoError(t, err)
+		boom := errors.New("boom")
+		conn.batch.sendErr = boom
+		assert.ErrorIs(t, tx.Commit(), boom)
+		assert.Equal(t, []string{"BEGIN TRANSACTION", "INSERT", "ROLLBACK"}, conn.execs)
+		assert.False(t, conn.closed)
+	})
+
+	t.Run("failed commit", func(t *testing.T) {
+		std, conn := newServerTxDriver()
+		tx, err := std.BeginTx(ctx, driver.TxOptions{})
+		require.NoError(t, err)
+		conflict := &Exception{Code: 649, Message: "Transaction failed"}
+		conn.execErr["COMMIT"] = conflict
+		conn.execErr["ROLLBACK"] = conflict
+		assert.ErrorIs(t, tx.Commit(), conflict)
+		assert.Equal(t, []string{"BEGIN TRANSACTION", "COMMIT", "ROLLBACK"}, conn.execs)
+		assert.True(t, conn.closed)
+	})
+
+	t.Run("unsupported options", func(t *testing.T) {
+		std, conn := newServerTxDriver()
+		_, err := std.BeginTx(ctx, driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable)})
+		assert.EqualError(t, err, "clickhouse: unsupported transaction isolation level: Serializable")
+		_, err = std.BeginTx(ctx, driver.TxOptions{ReadOnly: true})
+		assert.Error(t, err)
+		assert.Empty(t, conn.execs)
+	})
+
+	t.Run("batch mode", func(t *testing.T) {
+		std, conn := newServerTxDriver()
+		std.opt.TransactionMode = TransactionBatch
+		tx, err := std.BeginTx(ctx, driver.TxOptions{})
+		require.NoError(t, err)
+		assert.Same(t, std, tx)
+		_, err = std.PrepareContext(ctx, "INSERT INTO t")
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+		assert.Equal(t, []string{"INSERT"}, conn.execs)
+	})
+}
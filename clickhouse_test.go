@@ -871,6 +871,10 @@ func (m *mockConnectionPool) Get(ctx context.Context) (nativeTransport, error) {
 	return nil, errQueueEmpty
 }
 
+func (m *mockConnectionPool) GetFunc(ctx context.Context, match func(nativeTransport) bool) (nativeTransport, error) {
+	return m.Get(ctx)
+}
+
 func (m *mockConnectionPool) Put(conn nativeTransport) {
 	// No-op for this test
 }
@@ -886,3 +890,95 @@ func (m *mockConnectionPool) Cap() int {
 func (m *mockConnectionPool) Close() error {
 	return nil
 }
+
+// TestStats checks the counters of Stats over the life of pooled connections.
+func TestStats(t *testing.T) {
+	var failedDials atomic.Int64
+	conn, err := Open(&Options{
+		Addr:            []string{"localhost:9000"},
+		DialTimeout:     time.Second,
+		MaxOpenConns:    2,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+		DialStrategy: func(ctx context.Context, connID int, opt *Options, dial Dial) (DialResult, error) {
+			// nothing listens on port 1
+			if _, err := dial(ctx, "127.0.0.1:1", opt); err != nil {
+				failedDials.Add(1)
+			}
+			return DialResult{conn: newMockTransport(connID)}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer conn.Close()
+	ch := conn.(*clickhouse)
+
+	first, err := ch.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	second, err := ch.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	// the pool is full, the next acquire waits for a release
+	acquired := make(chan nativeTransport)
+	go func() {
+		conn, err := ch.acquire(context.Background())
+		if err != nil {
+			t.Errorf("acquire failed: %v", err)
+		}
+		acquired <- conn
+	}()
+	time.Sleep(20 * time.Millisecond)
+	ch.release(first, nil)
+	third := <-acquired
+	if third != first {
+		t.Error("expected the released connection to be reused")
+	}
+
+	// the second connection doesn't fit in the idle pool with the third
+	ch.release(third, nil)
+	ch.release(second, nil)
+	// a connection released after an error, or broken, is closed
+	broken, err := ch.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	ch.release(broken, errors.New("query failed"))
+	broken, err = ch.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	broken.(*mockTransport).setBad(true)
+	ch.release(broken, nil)
+	// and so is a connection that reached its lifetime
+	expired, err := ch.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	expired.(*mockTransport).connectedAt = time.Now().Add(-2 * time.Hour)
+	ch.release(expired, nil)
+
+	stats := ch.Stats()
+	if stats.WaitCount != 1 || stats.WaitDuration < 20*time.Millisecond {
+		t.Errorf("expected one wait of at least 20ms, got %d for %s", stats.WaitCount, stats.WaitDuration)
+	}
+	if stats.Dials != 4 || stats.Dials != failedDials.Load() {
+		t.Errorf("expected 4 dials, got %d", stats.Dials)
+	}
+	if stats.DialErrors["127.0.0.1:1"] != 4 {
+		t.Errorf("expected 4 dial errors for 127.0.0.1:1, got %v", stats.DialErrors)
+	}
+	if stats.MaxIdleClosed != 1 {
+		t.Errorf("expected 1 connection closed by MaxIdleConns, got %d", stats.MaxIdleClosed)
+	}
+	if stats.BadConnClosed != 2 {
+		t.Errorf("expected 2 bad connections closed, got %d", stats.BadConnClosed)
+	}
+	if stats.MaxLifetimeClosed != 1 {
+		t.Errorf("expected 1 connection closed by ConnMaxLifetime, got %d", stats.MaxLifetimeClosed)
+	}
+}
@@ -23,18 +23,33 @@ import (
 )
 
 func dial(ctx context.Context, addr string, num int, opt *Options) (*connect, error) {
+	conn, err := dialAuth(ctx, addr, num, opt, false)
+	if opt.credentials != nil && isAuthenticationFailed(err) {
+		// the provider may have cached credentials rotated since
+		conn, err = dialAuth(ctx, addr, num, opt, true)
+	}
+	return conn, err
+}
+
+// dialAuth dials addr, refreshing the credentials of the provider if refresh.
+func dialAuth(ctx context.Context, addr string, num int, opt *Options, refresh bool) (*connect, error) {
 	var (
 		err  error
 		conn net.Conn
 	)
 
+	tlsConfig, err := opt.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	switch {
 	case opt.DialContext != nil:
 		conn, err = opt.DialContext(ctx, addr)
 	default:
 		switch {
-		case opt.TLS != nil:
-			conn, err = tls.DialWithDialer(&net.Dialer{Timeout: opt.DialTimeout}, "tcp", addr, opt.TLS)
+		case tlsConfig != nil:
+			conn, err = tls.DialWithDialer(&net.Dialer{Timeout: opt.DialTimeout}, "tcp", addr, tlsConfig)
 		default:
 			conn, err = net.DialTimeout("tcp", addr, opt.DialTimeout)
 		}
@@ -73,7 +88,6 @@ func dial(ctx context.Context, addr string, num int, opt *Options) (*connect, er
 			conn:                 conn,
 			logger:               logger,
 			buffer:               new(chproto.Buffer),
-			reader:               chproto.NewReader(conn),
 			revision:             ClientTCPProtocolVersion,
 			structMap:            &structMap{},
 			compression:          compression,
@@ -84,19 +98,38 @@ func dial(ctx context.Context, addr string, num int, opt *Options) (*connect, er
 			maxCompressionBuffer: opt.MaxCompressionBuffer,
 		}
 	)
+	connect.connTelemetry.addr = addr
+	connect.reader = chproto.NewReader(countingReader{r: conn, n: &connect.connTelemetry.received})
 
 	auth := opt.Auth
-	if useJWTAuth(opt) {
+	switch {
+	case auth.ClusterSecret != "":
+		// the server trusts the initial user of the queries
+	case useJWTAuth(opt):
 		jwt, err := opt.GetJWT(ctx)
 		if err != nil {
+			conn.Close()
 			return nil, fmt.Errorf("failed to get JWT: %w", err)
 		}
 
 		auth.Username = jwtAuthMarker
 		auth.Password = jwt
+		auth.SSHSigner = nil
+	case opt.credentials != nil:
+		credentials, generation, err := opt.credentials.get(ctx, refresh)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		auth.Username, auth.Password = credentials.Username, credentials.Password
+		connect.credentialsGeneration = generation
+	}
+	if auth.CertificateAuth {
+		auth.Password = ""
 	}
 
 	if err := connect.handshake(auth); err != nil {
+		conn.Close()
 		return nil, err
 	}
 
@@ -137,16 +170,31 @@ type connect struct {
 	maxCompressionBuffer int
 	readerMutex          sync.Mutex
 	closeMutex           sync.Mutex
+	connTelemetry        connTelemetry
+	// credentialsGeneration is the generation of the credentials of
+	// Options.credentials the connection authenticated with.
+	credentialsGeneration uint64
+	// interserverSalt is the salt of the query hashes over
+	// Auth.ClusterSecret.
+	interserverSalt string
 }
 
 func (c *connect) connID() int {
 	return c.id
 }
 
+func (c *connect) addr() string {
+	return c.connTelemetry.addr
+}
+
 func (c *connect) getLogger() *slog.Logger {
 	return c.logger
 }
 
+func (c *connect) telemetry() *connTelemetry {
+	return &c.connTelemetry
+}
+
 func (c *connect) connectedAtTime() time.Time {
 	return c.connectedAt
 }
@@ -193,6 +241,10 @@ func (c *connect) healthCheck() error {
 			errConnMaxLifetimeExceeded, age.Round(time.Millisecond), c.opt.ConnMaxLifetime)
 	}
 
+	if c.opt.credentials != nil && c.credentialsGeneration != c.opt.credentials.current() {
+		return errCredentialsRotated
+	}
+
 	if err := c.connCheck(); err != nil {
 		return fmt.Errorf("clickhouse: connection check failed: %w", err)
 	}
@@ -441,6 +493,7 @@ func (c *connect) flush() error {
 	}
 
 	n, err := c.conn.Write(c.buffer.Buf)
+	c.connTelemetry.sent.Add(uint64(n))
 	if err != nil {
 		return fmt.Errorf("write: %w", err)
 	}
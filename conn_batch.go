@@ -20,12 +20,15 @@ var insertMatch = regexp.MustCompile(`(?i)(?:(?:--[^\n]*|#![^\n]*|#\s[^\n]*)\n\s
 var columnMatch = regexp.MustCompile(`INSERT INTO .+\s\((?P<Columns>.+)\)$`)
 
 func (c *connect) prepareBatch(ctx context.Context, release nativeTransportRelease, acquire nativeTransportAcquire, query string, opts driver.PrepareBatchOptions) (driver.Batch, error) {
-	query, _, queryColumns, verr := extractNormalizedInsertQueryAndColumns(query)
+	query, table, queryColumns, verr := extractNormalizedInsertQueryAndColumns(query)
 	if verr != nil {
 		return nil, verr
 	}
 
 	options := queryOptions(ctx)
+	if opts.InsertDeduplicationToken != "" {
+		options.settings["insert_deduplication_token"] = insertDeduplicationToken(opts.InsertDeduplicationToken, 0)
+	}
 	if deadline, ok := ctx.Deadline(); ok {
 		c.conn.SetDeadline(deadline)
 		defer c.conn.SetDeadline(time.Time{})
@@ -35,9 +38,20 @@ func (c *connect) prepareBatch(ctx context.Context, release nativeTransportRelea
 		return nil, err
 	}
 	var (
-		onProcess  = options.onProcess()
-		block, err = c.firstBlock(ctx, onProcess)
+		onProcess = options.onProcess()
+		defaults  []driver.ColumnDefault
 	)
+	// the server describes the table before the block when it has column defaults
+	onProcess.tableColumns = func(info *proto.TableColumns) {
+		columns, err := info.Columns()
+		if err != nil {
+			c.logger.Debug("failed to parse table columns", slog.Any("error", err))
+			return
+		}
+		defaults = columnDefaults(columns)
+	}
+	block, err := c.firstBlock(ctx, onProcess)
+	onProcess.tableColumns = nil
 	if err != nil {
 		release(c, err)
 		return nil, err
@@ -62,13 +76,19 @@ func (c *connect) prepareBatch(ctx context.Context, release nativeTransportRelea
 	b := &batch{
 		ctx:          ctx,
 		query:        query,
+		table:        table,
+		defaults:     defaults,
 		conn:         c,
 		block:        block,
 		released:     false,
 		connRelease:  connRelease,
 		connAcquire:  connAcquire,
 		onProcess:    onProcess,
-		closeOnFlush: opts.CloseOnFlush,
+		closeOnFlush: opts.CloseOnFlush || opts.InsertDeduplicationToken != "",
+		dedupID:      opts.InsertDeduplicationToken,
+		maxBytes:     opts.MaxBytes,
+		flushAtMax:   opts.FlushOnMaxBytes,
+		omitDefaults: opts.OmitDefaultColumns,
 	}
 
 	if opts.ReleaseConnection {
@@ -82,10 +102,18 @@ type batch struct {
 	err          error
 	ctx          context.Context
 	query        string
+	table        string
+	defaults     []driver.ColumnDefault
 	conn         *connect
 	sent         bool // sent signalize that batch is send to ClickHouse.
 	released     bool // released signalize that conn was returned to pool and can't be used.
 	closeOnFlush bool // closeOnFlush signalize that batch should close query and release conn when use Flush
+	flushed      bool // flushed signalize that rows were sent by Flush, so Send can't be retried.
+	dedupID      string
+	dedupSeq     int // dedupSeq numbers the blocks deduplicated under dedupID.
+	maxBytes     int
+	flushAtMax   bool // flushAtMax signalize that the block is flushed at maxBytes rather than rejecting rows.
+	omitDefaults bool // omitDefaults signalize that the first row may leave out the columns with a default.
 	block        *proto.Block
 	connRelease  func(*connect, error)
 	connAcquire  func(context.Context) (*connect, error)
@@ -111,25 +139,56 @@ func (b *batch) Abort() error {
 }
 
 func (b *batch) Append(v ...any) error {
+	_, err := b.append(v, false)
+	return err
+}
+
+// appendRow appends a row like Append, but a row that fails to convert is
+// taken back, and the batch kept usable, if its columns can be truncated.
+func (b *batch) appendRow(v []any) (kept bool, err error) {
+	return b.append(v, true)
+}
+
+// truncatable reports whether appendRow can take back any row.
+func (b *batch) truncatable() bool {
+	return b.block.Truncate(b.block.Rows())
+}
+
+func (b *batch) append(v []any, truncate bool) (bool, error) {
 	if b.sent {
-		return ErrBatchAlreadySent
+		return false, ErrBatchAlreadySent
 	}
 	if b.err != nil {
-		return b.err
+		return false, b.err
 	}
 
 	if len(v) > 0 {
 		if r, ok := v[0].(*rows); ok {
-			return b.appendRowsBlocks(r)
+			return false, b.appendRowsBlocks(r)
+		}
+	}
+	if err := checkBatchSize(b, b.maxBytes, b.flushAtMax); err != nil {
+		return false, err
+	}
+
+	if b.omitDefaults && b.block.Rows() == 0 && !b.flushed {
+		if columns := insertColumnsForValues(b.block.ColumnsNames(), b.defaults, len(v)); columns != nil {
+			if err := b.insertColumns(columns); err != nil {
+				return false, err
+			}
 		}
 	}
 
+	rows := b.block.Rows()
 	if err := b.block.Append(v...); err != nil {
+		if truncate && b.block.Truncate(rows) {
+			return true, err
+		}
 		b.err = fmt.Errorf("%w: %w", ErrBatchInvalid, err)
 		b.release(err)
-		return err
+		return false, err
 	}
-	return nil
+	return false, nil
 }
 
 // appendRowsBlocks is an experimental feature that allows rows blocks be appended directly to the batch.
@@ -166,6 +225,13 @@ func (b *batch) AppendStruct(v any) error {
 	if b.err != nil {
 		return b.err
 	}
+	if b.omitDefaults && b.block.Rows() == 0 && !b.flushed {
+		if columns := insertColumnsForStruct(b.block.ColumnsNames(), b.defaults, b.conn.structMap.fields(v)); columns != nil {
+			if err := b.insertColumns(columns); err != nil {
+				return err
+			}
+		}
+	}
 	values, err := b.conn.structMap.Map("AppendStruct", b.block.ColumnsNames(), v, false)
 	if err != nil {
 		return err
@@ -173,6 +239,49 @@ func (b *batch) AppendStruct(v any) error {
 	return b.Append(values...)
 }
 
+// insertColumns restarts the INSERT of the empty batch with only the given
+// columns, leaving the others to the server.
+func (b *batch) insertColumns(columns []string) (err error) {
+	defer func() {
+		if err != nil {
+			b.err = fmt.Errorf("%w: %w", ErrBatchInvalid, err)
+			b.release(err)
+		}
+	}()
+	query := insertQueryWithColumns(b.table, columns)
+	if b.released {
+		// the INSERT is sent again when the batch reacquires a connection
+		block, err := blockWithColumns(b.block, columns)
+		if err != nil {
+			return err
+		}
+		b.query, b.block = query, block
+		return nil
+	}
+
+	// nothing was sent yet, so ending the INSERT of all columns inserts no rows
+	if err := b.closeQuery(); err != nil {
+		return err
+	}
+	options := b.queryOptions()
+	if err := b.conn.sendQuery(query, &options); err != nil {
+		return err
+	}
+	block, err := b.conn.firstBlock(b.ctx, b.onProcess)
+	if err != nil {
+		return err
+	}
+	if err := block.SortColumns(columns); err != nil {
+		return err
+	}
+	b.query, b.block = query, block
+	return nil
+}
+
+func (b *batch) ColumnDefaults() []driver.ColumnDefault {
+	return slices.Clone(b.defaults)
+}
+
 func (b *batch) IsSent() bool {
 	return b.sent
 }
@@ -217,13 +326,35 @@ func (b *batch) Send() (err error) {
 	if b.err != nil {
 		return b.err
 	}
-	if b.sent || b.released {
-		if err = b.resetConnection(); err != nil {
+	policy := b.conn.opt.RetryPolicy
+	if b.flushed && b.dedupID == "" {
+		// rows sent by an earlier Flush would be inserted twice by a retry
+		policy = nil
+	}
+	reconnect := b.sent || b.released
+	_, op := b.conn.opt.instrumentation.start(b.ctx, "batch_send", b.query)
+	defer func() { op.end(err) }()
+	b.onProcess = op.hookProcess(b.onProcess)
+	return policy.do(b.ctx, b.conn.logger, "batch send", func() error {
+		if reconnect {
+			if err := b.resetConnection(); err != nil {
+				return err
+			}
+		}
+		op.attach(b.conn)
+		if err := b.send(); err != nil {
+			// the INSERT is in an unknown state, a retry starts over on a new connection
+			b.release(err)
+			reconnect = true
 			return err
 		}
-	}
+		return nil
+	})
+}
+
+func (b *batch) send() error {
 	if b.block.Rows() != 0 {
-		if err = b.conn.sendData(b.block, ""); err != nil {
+		if err := b.conn.sendData(b.block, ""); err != nil {
 			// there might be an error caused by context cancellation
 			// in this case we should return context error instead of net.OpError
 			if ctxErr := b.ctx.Err(); ctxErr != nil {
@@ -233,23 +364,18 @@ func (b *batch) Send() (err error) {
 			return err
 		}
 	}
-	if err = b.closeQuery(); err != nil {
-		return err
-	}
-	return nil
+	return b.closeQuery()
 }
 
 func (b *batch) resetConnection() (err error) {
-	// acquire a new conn
-	if b.conn, err = b.connAcquire(b.ctx); err != nil {
+	// acquire a new conn, keeping the released one on failure so it isn't released twice
+	conn, err := b.connAcquire(b.ctx)
+	if err != nil {
 		return err
 	}
+	b.conn, b.released = conn, false
 
-	defer func() {
-		b.released = false
-	}()
-
-	options := queryOptions(b.ctx)
+	options := b.queryOptions()
 	if deadline, ok := b.ctx.Deadline(); ok {
 		b.conn.conn.SetDeadline(deadline)
 		defer b.conn.conn.SetDeadline(time.Time{})
@@ -288,22 +414,45 @@ func (b *batch) Flush() error {
 			}
 			return err
 		}
+		b.flushed = true
 		if b.closeOnFlush {
-			b.release(b.closeQuery())
+			err := b.closeQuery()
+			b.release(err)
+			if err != nil && b.dedupID != "" {
+				// the block may have been inserted or not, keep it to be sent again under the same token
+				return err
+			}
+			b.dedupSeq++
 		}
 	}
 	b.block.Reset()
 	return nil
 }
 
+// queryOptions returns the options of the INSERT of the current block.
+func (b *batch) queryOptions() QueryOptions {
+	options := queryOptions(b.ctx)
+	if b.dedupID != "" {
+		options.settings["insert_deduplication_token"] = insertDeduplicationToken(b.dedupID, b.dedupSeq)
+	}
+	return options
+}
+
 func (b *batch) Rows() int {
 	return b.block.Rows()
 }
 
+func (b *batch) Size() int {
+	return b.block.Size()
+}
+
 func (b *batch) Columns() []column.Interface {
 	return slices.Clone(b.block.Columns)
 }
 
+var _ driver.SizedBatch = (*batch)(nil)
+var _ driver.DefaultsBatch = (*batch)(nil)
+
 func (b *batch) closeQuery() error {
 	if err := b.conn.sendData(proto.NewBlock(), ""); err != nil {
 		return err
@@ -1,24 +1,580 @@
 package clickhouse
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	chproto "github.com/ClickHouse/ch-go/proto"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
 )
 
-// The native protocol server only exchanges Native blocks: producing or
-// parsing any other format would have to happen client-side. Client-side
-// codecs are deliberately out of scope for the experimental release, so both
-// methods return ErrFormatNativeUnsupported; the intended direction for
-// native-protocol support is server-side formatting, not client codecs.
+// The native protocol server only exchanges Native blocks, so QueryFormat
+// leans on the server to render the rows and only assembles the stream
+// client-side:
+//
+//   - row formats (CSV, TSV, JSONEachRow, RowBinary, ...) wrap the query in
+//     formatRow(), which makes the server render every result row in the
+//     requested format into a String column. Concatenating those strings
+//     yields exactly the format's row stream.
+//   - their WithNames and WithNamesAndTypes variants and the JSON document
+//     formats (JSON, JSONCompact, ...) are the same rows, preceded by a
+//     header or wrapped in the document written from the names and types
+//     of the result columns, which a DESCRIBE of the query returns first.
+//   - block formats are encoded from the Native blocks of the result by the
+//     FormatEncoder registered for them. Native itself is built in; the
+//     charrow module registers Arrow, ArrowStream and Parquet.
+//
+// InsertFormat sends the INSERT with a FORMAT Native clause and streams the
+// blocks of the payload in Data packets, as clickhouse-client does once it
+// has parsed its input. The native protocol carries insert data as Native
+// blocks only, so the other formats, which would have to be parsed
+// client-side, are left to HTTP, where the server parses every format.
+
+// nativeRowFormats lists the output formats whose complete output is the
+// concatenation of their per-row output, keyed by lower-cased name. Only these
+// can be produced over the native protocol via formatRow().
+var nativeRowFormats = map[string]bool{
+	"csv":                       true,
+	"tsv":                       true,
+	"tsvraw":                    true,
+	"tabseparated":              true,
+	"tabseparatedraw":           true,
+	"customseparated":           true,
+	"tskv":                      true,
+	"jsoneachrow":               true,
+	"jsonlines":                 true,
+	"ndjson":                    true,
+	"jsonstringseachrow":        true,
+	"jsoncompacteachrow":        true,
+	"jsoncompactstringseachrow": true,
+	"rowbinary":                 true,
+	"lineasstring":              true,
+}
+
+// headerFormat writes the header rows of the WithNames and WithNamesAndTypes
+// variants of a row format: each value is written with value and separated
+// by delimiter, unless delimiterSetting overrides it, and the row is
+// enclosed in begin and end. Binary headers are the column count followed by
+// the values as strings.
+type headerFormat struct {
+	value            func(b *strings.Builder, s string)
+	delimiter        string
+	delimiterSetting string
+	begin, end       string
+	binary           bool
+}
+
+// nativeHeaderFormats lists the row formats of nativeRowFormats with WithNames
+// and WithNamesAndTypes variants, keyed by lower-cased name.
+var nativeHeaderFormats = map[string]headerFormat{
+	"csv":                       {value: writeCSVString, delimiter: ",", end: "\n", delimiterSetting: "format_csv_delimiter"},
+	"tsv":                       {value: writeEscapedString, delimiter: "\t", end: "\n"},
+	"tabseparated":              {value: writeEscapedString, delimiter: "\t", end: "\n"},
+	"tsvraw":                    {value: writeRawString, delimiter: "\t", end: "\n"},
+	"tabseparatedraw":           {value: writeRawString, delimiter: "\t", end: "\n"},
+	"jsoncompacteachrow":        {value: writeJSONString, delimiter: ", ", begin: "[", end: "]\n"},
+	"jsoncompactstringseachrow": {value: writeJSONString, delimiter: ", ", begin: "[", end: "]\n"},
+	"rowbinary":                 {binary: true},
+}
+
+// nativeJSONFormats maps the JSON document formats to the row format their
+// rows are rendered in, keyed by lower-cased name.
+var nativeJSONFormats = map[string]string{
+	"json":               "JSONEachRow",
+	"jsonstrings":        "JSONStringsEachRow",
+	"jsoncompact":        "JSONCompactEachRow",
+	"jsoncompactstrings": "JSONCompactStringsEachRow",
+}
+
+// FormatEncoder encodes the result of a query in a block format for
+// QueryFormat over the native protocol, where the server only sends Native
+// blocks. It writes the encoded rows to w, reading them block by block with
+// NextBlock and Block, and returns once they are exhausted. The rows are
+// closed after it returns.
+type FormatEncoder func(w io.Writer, rows driver.BlockRows) error
+
+var formatEncoders = struct {
+	sync.RWMutex
+	encoders map[string]FormatEncoder
+}{
+	encoders: map[string]FormatEncoder{"native": encodeNative},
+}
+
+// RegisterFormatEncoder makes QueryFormat over the native protocol encode
+// format with encoder, for the block formats, such as Parquet or Arrow, that
+// the server only produces over HTTP. Format names are matched ignoring case.
+// It is meant to be called from the init function of the package providing
+// the encoder, and panics if encoder is nil or format already has one.
+func RegisterFormatEncoder(format string, encoder FormatEncoder) {
+	formatEncoders.Lock()
+	defer formatEncoders.Unlock()
+	if encoder == nil {
+		panic("clickhouse: RegisterFormatEncoder encoder is nil")
+	}
+	name := strings.ToLower(format)
+	if _, dup := formatEncoders.encoders[name]; dup {
+		panic("clickhouse: RegisterFormatEncoder called twice for format " + format)
+	}
+	formatEncoders.encoders[name] = encoder
+}
+
+// nativeFormat is how QueryFormat produces a format over the native protocol.
+type nativeFormat struct {
+	// row is the format formatRow() renders each row in.
+	row string
+	// header writes the column names, and their types with types set,
+	// before the rows.
+	header *headerFormat
+	types  bool
+	// json wraps the rows in a JSON document.
+	json bool
+	// encoder encodes the blocks of the result instead of formatRow().
+	encoder FormatEncoder
+}
+
+func lookupNativeFormat(format string) (nativeFormat, bool) {
+	name := strings.ToLower(format)
+	formatEncoders.RLock()
+	encoder, ok := formatEncoders.encoders[name]
+	formatEncoders.RUnlock()
+	switch {
+	case ok:
+		return nativeFormat{encoder: encoder}, true
+	case nativeRowFormats[name]:
+		return nativeFormat{row: format}, true
+	case nativeJSONFormats[name] != "":
+		return nativeFormat{row: nativeJSONFormats[name], json: true}, true
+	}
+	for _, suffix := range []string{"withnamesandtypes", "withnames"} {
+		base, ok := strings.CutSuffix(name, suffix)
+		if header, supported := nativeHeaderFormats[base]; ok && supported {
+			return nativeFormat{
+				row:    format[:len(base)],
+				header: &header,
+				types:  suffix == "withnamesandtypes",
+			}, true
+		}
+	}
+	return nativeFormat{}, false
+}
+
+func nativeFormatSupported(format string) bool {
+	_, ok := lookupNativeFormat(format)
+	return ok
+}
+
+// trimQuery trims the whitespace and trailing semicolon of query, so it can
+// be used as a subquery.
+func trimQuery(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), ";")
+}
+
+// nativeFormatQuery wraps query so the server renders every row in format.
+// The format name has already been validated as a plain identifier.
+func nativeFormatQuery(format string, query string) string {
+	return fmt.Sprintf("SELECT formatRow('%s', *) FROM (%s)", format, trimQuery(query))
+}
+
+func (c *connect) queryFormat(ctx context.Context, release nativeTransportRelease, format string, query string, args ...any) (io.ReadCloser, error) {
+	f, ok := lookupNativeFormat(format)
+	if !ok {
+		// The connection is healthy and unused - release it back to the pool.
+		release(c, nil)
+		return nil, fmt.Errorf("%w: format %s", ErrFormatNativeUnsupported, format)
+	}
+	c.logger.Debug("native format query", slog.String("sql", query), slog.String("format", format))
+	if f.encoder != nil {
+		rows, err := c.query(ctx, release, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		return newNativeEncodedStream(rows, f.encoder), nil
+	}
+
+	stream := &nativeFormatStream{}
+	if f.header != nil || f.json {
+		columns, err := c.describeQuery(ctx, query, args...)
+		if err != nil {
+			release(c, err)
+			return nil, err
+		}
+		if f.json {
+			stream.document = &jsonDocument{start: time.Now()}
+			stream.pending = stream.document.begin(columns)
+			ctx = stream.document.trackProgress(ctx)
+		} else {
+			stream.pending = f.header.write(c.formatDelimiter(ctx, f.header), columns, f.types)
+		}
+	}
+	rows, err := c.query(ctx, release, nativeFormatQuery(f.row, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	stream.rows = rows
+	return stream, nil
+}
+
+// formatColumn is a result column, as returned by DESCRIBE.
+type formatColumn struct {
+	name, typ string
+}
+
+// describeQuery returns the columns of the result of query, without
+// releasing the connection.
+func (c *connect) describeQuery(ctx context.Context, query string, args ...any) ([]formatColumn, error) {
+	// the query ID and the callbacks are left to the query itself
+	ctx = Context(ctx, func(o *QueryOptions) error {
+		o.queryID = ""
+		o.events = QueryOptions{}.events
+		return nil
+	})
+	rows, err := c.query(ctx, func(nativeTransport, error) {}, fmt.Sprintf("DESCRIBE (%s)", trimQuery(query)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []formatColumn
+	for rows.Next() {
+		var (
+			col    formatColumn
+			ignore string
+		)
+		if err := rows.Scan(&col.name, &col.typ, &ignore, &ignore, &ignore, &ignore, &ignore); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Close()
+}
+
+// formatDelimiter returns the delimiter the server renders the values of a
+// row with, which a setting can override.
+func (c *connect) formatDelimiter(ctx context.Context, header *headerFormat) string {
+	if header.delimiterSetting == "" {
+		return header.delimiter
+	}
+	options := queryOptions(ctx)
+	for _, settings := range []Settings{options.settings, c.opt.Settings} {
+		v, ok := settings[header.delimiterSetting]
+		if !ok {
+			continue
+		}
+		if cv, ok := v.(CustomSetting); ok {
+			v = cv.Value
+		}
+		if delimiter := fmt.Sprint(v); delimiter != "" {
+			return delimiter[:1]
+		}
+	}
+	return header.delimiter
+}
+
+// write returns the header of the column names, followed by the one of their
+// types with types set.
+func (h *headerFormat) write(delimiter string, columns []formatColumn, types bool) string {
+	var b strings.Builder
+	if h.binary {
+		var buffer chproto.Buffer
+		buffer.PutUVarInt(uint64(len(columns)))
+		for _, col := range columns {
+			buffer.PutString(col.name)
+		}
+		if types {
+			for _, col := range columns {
+				buffer.PutString(col.typ)
+			}
+		}
+		return string(buffer.Buf)
+	}
+	row := func(value func(formatColumn) string) {
+		b.WriteString(h.begin)
+		for i, col := range columns {
+			if i > 0 {
+				b.WriteString(delimiter)
+			}
+			h.value(&b, value(col))
+		}
+		b.WriteString(h.end)
+	}
+	row(func(col formatColumn) string { return col.name })
+	if types {
+		row(func(col formatColumn) string { return col.typ })
+	}
+	return b.String()
+}
+
+func writeRawString(b *strings.Builder, s string) {
+	b.WriteString(s)
+}
+
+// writeCSVString writes s double-quoted, as CSV output does.
+func writeCSVString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	b.WriteString(strings.ReplaceAll(s, `"`, `""`))
+	b.WriteByte('"')
+}
+
+// escapedStringReplacer escapes strings as the TabSeparated format does.
+var escapedStringReplacer = strings.NewReplacer(
+	"\\", "\\\\",
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\b", "\\b",
+	"\f", "\\f",
+	"\x00", "\\0",
+	"'", "\\'",
+)
+
+func writeEscapedString(b *strings.Builder, s string) {
+	b.WriteString(escapedStringReplacer.Replace(s))
+}
+
+func writeJSONString(b *strings.Builder, s string) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	// Encode terminates the value with a newline
+	b.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// jsonDocument writes the document of the JSON formats around their rows:
+// the columns first, then the rows and the statistics of the query.
+type jsonDocument struct {
+	start     time.Time
+	rows      int
+	rowsRead  atomic.Uint64
+	bytesRead atomic.Uint64
+}
+
+// trackProgress returns ctx with a progress callback counting the rows and
+// bytes read, which still calls the one of ctx.
+func (d *jsonDocument) trackProgress(ctx context.Context) context.Context {
+	progress := queryOptions(ctx).events.progress
+	return Context(ctx, WithProgress(func(p *Progress) {
+		d.rowsRead.Add(p.Rows)
+		d.bytesRead.Add(p.Bytes)
+		if progress != nil {
+			progress(p)
+		}
+	}))
+}
+
+func (d *jsonDocument) begin(columns []formatColumn) string {
+	var b strings.Builder
+	b.WriteString("{\n\t\"meta\":\n\t[")
+	for i, col := range columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("\n\t\t{\n\t\t\t\"name\": ")
+		writeJSONString(&b, col.name)
+		b.WriteString(",\n\t\t\t\"type\": ")
+		writeJSONString(&b, col.typ)
+		b.WriteString("\n\t\t}")
+	}
+	b.WriteString("\n\t],\n\n\t\"data\":\n\t[\n")
+	return b.String()
+}
+
+func (d *jsonDocument) row(row string) string {
+	row = "\t\t" + strings.TrimSuffix(row, "\n")
+	if d.rows++; d.rows > 1 {
+		row = ",\n" + row
+	}
+	return row
+}
+
+func (d *jsonDocument) end() string {
+	return fmt.Sprintf("\n\t],\n\n\t\"rows\": %d,\n\n\t\"statistics\":\n\t{\n\t\t\"elapsed\": %g,\n\t\t\"rows_read\": %d,\n\t\t\"bytes_read\": %d\n\t}\n}\n",
+		d.rows, time.Since(d.start).Seconds(), d.rowsRead.Load(), d.bytesRead.Load())
+}
+
+// nativeFormatStream is the io.ReadCloser returned by connect.queryFormat.
+// It serves the formatRow() strings of the result one after another; the
+// connection is released by the rows stream once the result is drained.
+type nativeFormatStream struct {
+	rows    *rows
+	pending string
+	err     error
+	closed  bool
+	// document wraps the rows of the JSON formats.
+	document *jsonDocument
+}
+
+func (s *nativeFormatStream) Read(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("clickhouse: read on closed format stream")
+	}
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if !s.rows.Next() {
+			if s.err = s.rows.Err(); s.err == nil {
+				s.err = io.EOF
+				if s.document != nil {
+					s.pending = s.document.end()
+				}
+			}
+			continue
+		}
+		if err := s.rows.Scan(&s.pending); err != nil {
+			s.err = err
+		} else if s.document != nil {
+			s.pending = s.document.row(s.pending)
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *nativeFormatStream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.pending = ""
+	return s.rows.Close()
+}
+
+// nativeEncodedStream is the io.ReadCloser returned by connect.queryFormat
+// for the formats of a FormatEncoder, which encodes the rows into a pipe.
+type nativeEncodedStream struct {
+	*io.PipeReader
+	done chan struct{}
+	err  error
+}
+
+func newNativeEncodedStream(rows *rows, encoder FormatEncoder) *nativeEncodedStream {
+	r, w := io.Pipe()
+	s := &nativeEncodedStream{PipeReader: r, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		err := encoder(w, rows)
+		if closeErr := rows.Close(); err == nil {
+			err = closeErr
+		}
+		s.err = err
+		w.CloseWithError(err)
+	}()
+	return s
+}
+
+func (s *nativeEncodedStream) Close() error {
+	s.PipeReader.Close()
+	<-s.done
+	if errors.Is(s.err, io.ErrClosedPipe) {
+		// closed before the encoder was done
+		return nil
+	}
+	return s.err
+}
+
+// encodeNative is the FormatEncoder of the Native format: the blocks of the
+// result as the server sends them, without the block info of the protocol.
+func encodeNative(w io.Writer, rows driver.BlockRows) error {
+	var buffer chproto.Buffer
+	for rows.NextBlock() {
+		var (
+			block = rows.Block()
+			out   = &proto.Block{Columns: make([]column.Interface, len(block.Columns()))}
+		)
+		for i := range out.Columns {
+			out.Columns[i] = block.Column(i)
+		}
+		buffer.Reset()
+		if err := out.Encode(&buffer, 0); err != nil {
+			return err
+		}
+		if _, err := w.Write(buffer.Buf); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (c *connect) insertFormat(ctx context.Context, release nativeTransportRelease, format string, query string, data io.Reader) (err error) {
+	if !strings.EqualFold(format, "Native") {
+		// The connection is healthy and unused - release it back to the pool.
+		release(c, nil)
+		return fmt.Errorf("%w: format %s", ErrFormatNativeUnsupported, format)
+	}
+	insertStmt, _, _, err := extractInsertQueryComponents(query)
+	if err != nil {
+		release(c, nil)
+		return err
+	}
+	c.logger.Debug("native format insert", slog.String("sql", query), slog.String("format", format))
+	defer func() { release(c, err) }()
+	// the payload is read while the INSERT is open, closing the connection
+	// is the only way to interrupt a blocked write
+	stopCW := contextWatchdog(ctx, func() { _ = c.conn.Close() })
+	defer stopCW()
 
-func (c *connect) queryFormat(_ context.Context, release nativeTransportRelease, _ string, _ string, _ ...any) (io.ReadCloser, error) {
-	// The connection is healthy and unused - release it back to the pool.
-	release(c, nil)
-	return nil, ErrFormatNativeUnsupported
+	options := queryOptions(ctx)
+	if err := c.sendQuery(insertStmt+" FORMAT Native", &options); err != nil {
+		return err
+	}
+	onProcess := options.onProcess()
+	sample, err := c.firstBlock(ctx, onProcess)
+	if err != nil {
+		return err
+	}
+	if err := c.sendNativeBlocks(ctx, sample, data); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("insert %s: %w", format, err)
+	}
+	if err := c.sendData(proto.NewBlock(), ""); err != nil {
+		return err
+	}
+	return c.process(ctx, onProcess)
 }
 
-func (c *connect) insertFormat(_ context.Context, release nativeTransportRelease, _ string, _ string, _ io.Reader) error {
-	// The connection is healthy and unused - release it back to the pool.
-	release(c, nil)
-	return ErrFormatNativeUnsupported
+// sendNativeBlocks sends the blocks of the Native payload data, with their
+// columns in the order of the sample block the server returned for the
+// INSERT.
+func (c *connect) sendNativeBlocks(ctx context.Context, sample *proto.Block, data io.Reader) error {
+	serverContext := serverVersionToContext(c.server)
+	if location := queryOptionsUserLocation(ctx); location != nil {
+		serverContext.Timezone = location
+	}
+	reader := chproto.NewReader(data)
+	for {
+		// a file in the Native format has no block info, as for revision 0
+		block := proto.Block{ServerContext: &serverContext}
+		if err := block.Decode(reader, 0); err != nil {
+			// the payload may only end before the header of a block
+			if errors.Is(err, io.EOF) && block.Columns == nil {
+				return nil
+			}
+			return err
+		}
+		if block.Rows() == 0 {
+			// an empty block would end the INSERT
+			continue
+		}
+		if err := block.SortColumns(sample.ColumnsNames()); err != nil {
+			return err
+		}
+		if err := c.sendData(&block, ""); err != nil {
+			return err
+		}
+	}
 }
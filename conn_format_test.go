@@ -0,0 +1,268 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chproto "github.com/ClickHouse/ch-go/proto"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+func TestNativeFormatSupported(t *testing.T) {
+	for _, format := range []string{
+		"CSV", "csv", "TSV", "TabSeparatedRaw", "JSONEachRow", "JSONCompactEachRow", "RowBinary",
+		"CSVWithNames", "TSVWithNamesAndTypes", "RowBinaryWithNamesAndTypes", "JSON", "JSONCompactStrings", "Native",
+	} {
+		assert.True(t, nativeFormatSupported(format), format)
+	}
+	for _, format := range []string{"XML", "Parquet", "ArrowStream", "Pretty", "TSKVWithNames", "CustomSeparatedWithNames", "WithNames"} {
+		assert.False(t, nativeFormatSupported(format), format)
+	}
+
+	f, _ := lookupNativeFormat("CSVWithNamesAndTypes")
+	assert.Equal(t, "CSV", f.row)
+	assert.True(t, f.types)
+	f, _ = lookupNativeFormat("JSONStrings")
+	assert.Equal(t, "JSONStringsEachRow", f.row)
+	assert.True(t, f.json)
+}
+
+func TestRegisterFormatEncoder(t *testing.T) {
+	encoder := func(w io.Writer, rows driver.BlockRows) error {
+		_, err := io.WriteString(w, "encoded")
+		return err
+	}
+	RegisterFormatEncoder("TestEncoded", encoder)
+	f, ok := lookupNativeFormat("testencoded")
+	require.True(t, ok)
+	assert.NotNil(t, f.encoder)
+	assert.Panics(t, func() { RegisterFormatEncoder("TESTENCODED", encoder) })
+	assert.Panics(t, func() { RegisterFormatEncoder("TestNil", nil) })
+}
+
+func TestNativeFormatHeader(t *testing.T) {
+	columns := []formatColumn{{name: "id", typ: "UInt64"}, {name: `a "b"`, typ: "Map(String, String)"}}
+	for _, tc := range []struct {
+		format, delimiter string
+		expected          string
+	}{
+		{"CSVWithNames", ",", "\"id\",\"a \"\"b\"\"\"\n"},
+		{"CSVWithNames", ";", "\"id\";\"a \"\"b\"\"\"\n"},
+		{"TSVWithNamesAndTypes", "\t", "id\ta \"b\"\nUInt64\tMap(String, String)\n"},
+		{"JSONCompactEachRowWithNames", ", ", "[\"id\", \"a \\\"b\\\"\"]\n"},
+		{"RowBinaryWithNames", "", "\x02\x02id\x05a \"b\""},
+	} {
+		f, ok := lookupNativeFormat(tc.format)
+		require.True(t, ok, tc.format)
+		assert.Equal(t, tc.expected, f.header.write(tc.delimiter, columns, f.types), tc.format)
+	}
+
+	conn := &connect{opt: &Options{Settings: Settings{"format_csv_delimiter": ";"}}}
+	f, _ := lookupNativeFormat("CSVWithNames")
+	assert.Equal(t, ";", conn.formatDelimiter(context.Background(), f.header))
+	ctx := Context(context.Background(), WithSettings(Settings{"format_csv_delimiter": CustomSetting{"|"}}))
+	assert.Equal(t, "|", conn.formatDelimiter(ctx, f.header))
+	f, _ = lookupNativeFormat("TSVWithNames")
+	assert.Equal(t, "\t", conn.formatDelimiter(ctx, f.header))
+}
+
+func TestNativeFormatJSONDocument(t *testing.T) {
+	stream := make(chan *proto.Block, 1)
+	errCh := make(chan error)
+	stream <- formatRowsBlock(t, `{"id":"2","name":"bob"}`+"\n")
+	close(stream)
+	close(errCh)
+
+	document := &jsonDocument{start: time.Now()}
+	ctx := document.trackProgress(context.Background())
+	queryOptions(ctx).events.progress(&Progress{Rows: 2, Bytes: 32})
+	s := &nativeFormatStream{
+		rows: &rows{
+			block:  formatRowsBlock(t, `{"id":"1","name":"alice"}`+"\n"),
+			stream: stream,
+			errors: errCh,
+		},
+		document: document,
+		pending:  document.begin([]formatColumn{{name: "id", typ: "UInt64"}, {name: "name", typ: "String"}}),
+	}
+	got, err := io.ReadAll(s)
+	require.NoError(t, err)
+
+	var result struct {
+		Meta       []struct{ Name, Type string }
+		Data       []map[string]string
+		Rows       int
+		Statistics struct {
+			RowsRead  uint64 `json:"rows_read"`
+			BytesRead uint64 `json:"bytes_read"`
+		}
+	}
+	require.NoError(t, json.Unmarshal(got, &result), string(got))
+	assert.Equal(t, []struct{ Name, Type string }{{"id", "UInt64"}, {"name", "String"}}, result.Meta)
+	assert.Equal(t, []map[string]string{{"id": "1", "name": "alice"}, {"id": "2", "name": "bob"}}, result.Data)
+	assert.Equal(t, 2, result.Rows)
+	assert.Equal(t, uint64(2), result.Statistics.RowsRead)
+	assert.Equal(t, uint64(32), result.Statistics.BytesRead)
+	assert.Contains(t, string(got), "\t\"data\":\n\t[\n\t\t{\"id\":\"1\",\"name\":\"alice\"},\n\t\t{\"id\":\"2\",")
+}
+
+func TestEncodeNative(t *testing.T) {
+	block := proto.NewBlock()
+	require.NoError(t, block.AddColumn("id", "UInt64"))
+	require.NoError(t, block.AddColumn("name", "LowCardinality(String)"))
+	require.NoError(t, block.Append(uint64(1), "alice"))
+	require.NoError(t, block.Append(uint64(2), "bob"))
+	stream := make(chan *proto.Block, 1)
+	stream <- block
+	close(stream)
+	errCh := make(chan error)
+	close(errCh)
+	header := proto.NewBlock()
+	require.NoError(t, header.AddColumn("id", "UInt64"))
+	require.NoError(t, header.AddColumn("name", "LowCardinality(String)"))
+
+	s := newNativeEncodedStream(&rows{block: header, stream: stream, errors: errCh, columns: header.ColumnsNames()}, encodeNative)
+	got, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// the output is the Native blocks HTTP sends, without block info
+	decoded := proto.NewBlock()
+	require.NoError(t, decoded.Decode(chproto.NewReader(bytes.NewReader(got)), 0))
+	assert.Equal(t, []string{"id", "name"}, decoded.ColumnsNames())
+	require.Equal(t, 2, decoded.Rows())
+	assert.Equal(t, uint64(2), decoded.Columns[0].Row(1, false))
+	assert.Equal(t, "bob", decoded.Columns[1].Row(1, false))
+}
+
+func TestNativeFormatQuery(t *testing.T) {
+	assert.Equal(t, "SELECT formatRow('CSV', *) FROM (SELECT 1)", nativeFormatQuery("CSV", "SELECT 1"))
+	assert.Equal(t, "SELECT formatRow('JSONEachRow', *) FROM (SELECT * FROM t WHERE a = ?)",
+		nativeFormatQuery("JSONEachRow", "  SELECT * FROM t WHERE a = ?;\n"))
+}
+
+func formatRowsBlock(t *testing.T, values ...string) *proto.Block {
+	t.Helper()
+	block := proto.NewBlock()
+	require.NoError(t, block.AddColumn("row", "String"))
+	for _, v := range values {
+		require.NoError(t, block.Append(v))
+	}
+	return block
+}
+
+func TestNativeFormatStream(t *testing.T) {
+	stream := make(chan *proto.Block, 1)
+	errCh := make(chan error)
+	stream <- formatRowsBlock(t, "3,carol\n")
+	close(stream)
+	close(errCh)
+
+	s := &nativeFormatStream{rows: &rows{
+		block:  formatRowsBlock(t, "1,alice\n", "2,bob\n"),
+		stream: stream,
+		errors: errCh,
+	}}
+	got, err := io.ReadAll(oneByteReader{s})
+	require.NoError(t, err)
+	assert.Equal(t, "1,alice\n2,bob\n3,carol\n", string(got))
+	require.NoError(t, s.Close())
+
+	_, err = s.Read(make([]byte, 1))
+	require.Error(t, err)
+}
+
+func TestNativeFormatStreamError(t *testing.T) {
+	boom := errors.New("boom")
+	stream := make(chan *proto.Block)
+	errCh := make(chan error, 1)
+	errCh <- boom
+	close(errCh)
+	close(stream)
+
+	s := &nativeFormatStream{rows: &rows{
+		block:  formatRowsBlock(t, "1,alice\n"),
+		stream: stream,
+		errors: errCh,
+	}}
+	got, err := io.ReadAll(s)
+	require.ErrorIs(t, err, boom)
+	assert.Equal(t, "1,alice\n", string(got))
+	require.ErrorIs(t, s.Close(), boom)
+}
+
+// writtenConn records the bytes written to it.
+type writtenConn struct {
+	mockNetConn
+	written bytes.Buffer
+}
+
+func (c *writtenConn) Write(b []byte) (int, error) {
+	return c.written.Write(b)
+}
+
+func TestSendNativeBlocks(t *testing.T) {
+	var payload chproto.Buffer
+	for _, rows := range [][]string{{"alice", "bob"}, nil, {"carol"}} {
+		block := proto.NewBlock()
+		require.NoError(t, block.AddColumn("name", "String"))
+		require.NoError(t, block.AddColumn("id", "UInt64"))
+		for i, name := range rows {
+			require.NoError(t, block.Append(name, uint64(i+1)))
+		}
+		require.NoError(t, block.Encode(&payload, 0))
+	}
+	sample := proto.NewBlock()
+	require.NoError(t, sample.AddColumn("id", "UInt64"))
+	require.NoError(t, sample.AddColumn("name", "String"))
+
+	conn := &writtenConn{}
+	c := &connect{
+		conn:     conn,
+		buffer:   new(chproto.Buffer),
+		logger:   newNoopLogger(),
+		opt:      &Options{},
+		revision: ClientTCPProtocolVersion,
+	}
+	require.NoError(t, c.sendNativeBlocks(context.Background(), sample, bytes.NewReader(payload.Buf)))
+
+	// the empty block is left out, as it would end the INSERT
+	reader := chproto.NewReader(&conn.written)
+	var names [][]any
+	for range 2 {
+		packet, err := reader.ReadByte()
+		require.NoError(t, err)
+		assert.Equal(t, byte(proto.ClientData), packet)
+		_, err = reader.Str()
+		require.NoError(t, err)
+		block := proto.NewBlock()
+		require.NoError(t, block.Decode(reader, ClientTCPProtocolVersion))
+		assert.Equal(t, []string{"id", "name"}, block.ColumnsNames())
+		var values []any
+		for i := range block.Rows() {
+			values = append(values, block.Columns[1].Row(i, false))
+		}
+		names = append(names, values)
+	}
+	assert.Equal(t, [][]any{{"alice", "bob"}, {"carol"}}, names)
+	assert.Zero(t, conn.written.Len())
+
+	// a payload may only end between blocks
+	err := c.sendNativeBlocks(context.Background(), sample, bytes.NewReader(payload.Buf[:len(payload.Buf)-1]))
+	assert.Error(t, err)
+	// and must have the columns of the INSERT
+	other := proto.NewBlock()
+	require.NoError(t, other.AddColumn("id", "UInt64"))
+	err = c.sendNativeBlocks(context.Background(), other, bytes.NewReader(payload.Buf))
+	assert.Error(t, err)
+}
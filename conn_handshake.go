@@ -30,14 +30,35 @@ func (c *connect) handshake(auth Auth) error {
 		handshake.Encode(c.buffer)
 		{
 			c.buffer.PutString(auth.Database)
-			c.buffer.PutString(auth.Username)
-			c.buffer.PutString(auth.Password)
+			switch {
+			case auth.ClusterSecret != "":
+				salt, err := newInterserverSalt()
+				if err != nil {
+					return err
+				}
+				c.interserverSalt = salt
+				c.buffer.PutString(interserverAuthMarker)
+				c.buffer.PutString("")
+				c.buffer.PutString(auth.Cluster)
+				c.buffer.PutString(salt)
+			case auth.SSHSigner != nil:
+				c.buffer.PutString(sshAuthMarker + auth.Username)
+				c.buffer.PutString(auth.Password)
+			default:
+				c.buffer.PutString(auth.Username)
+				c.buffer.PutString(auth.Password)
+			}
 		}
 		if err := c.flush(); err != nil {
 			return fmt.Errorf("handshake: failed to send hello to %s (conn_id=%d): %w",
 				c.conn.RemoteAddr(), c.id, err)
 		}
 	}
+	if auth.SSHSigner != nil && auth.ClusterSecret == "" {
+		if err := c.sshChallenge(auth); err != nil {
+			return err
+		}
+	}
 	{
 		packet, err := c.reader.ReadByte()
 		if err != nil {
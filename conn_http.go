@@ -29,8 +29,11 @@ import (
 )
 
 const (
-	quotaKeyParamName = "quota_key"
-	queryIDParamName  = "query_id"
+	quotaKeyParamName       = "quota_key"
+	queryIDParamName        = "query_id"
+	sessionIDParamName      = "session_id"
+	sessionTimeoutParamName = "session_timeout"
+	sessionCheckParamName   = "session_check"
 )
 
 type Pool[T any] struct {
@@ -109,6 +112,18 @@ func applyOptionsToRequest(ctx context.Context, req *http.Request, opt *Options)
 	jwt := queryOpt.jwt
 	useJWT := jwt != "" || useJWTAuth(opt)
 
+	username, password := opt.Auth.Username, opt.Auth.Password
+	if opt.credentials != nil && !useJWT {
+		credentials, _, err := opt.credentials.get(ctx, false)
+		if err != nil {
+			return err
+		}
+		username, password = credentials.Username, credentials.Password
+	}
+	if opt.Auth.CertificateAuth {
+		password = ""
+	}
+
 	switch {
 	case opt.TLS != nil && useJWT:
 		if jwt == "" {
@@ -120,20 +135,20 @@ func applyOptionsToRequest(ctx context.Context, req *http.Request, opt *Options)
 		}
 
 		req.Header.Set("Authorization", "Bearer "+jwt)
-	case opt.TLS != nil && len(opt.Auth.Username) > 0:
-		req.Header.Set("X-ClickHouse-User", opt.Auth.Username)
-		if len(opt.Auth.Password) > 0 {
-			req.Header.Set("X-ClickHouse-Key", opt.Auth.Password)
+	case opt.TLS != nil && len(username) > 0:
+		req.Header.Set("X-ClickHouse-User", username)
+		if len(password) > 0 {
+			req.Header.Set("X-ClickHouse-Key", password)
 			req.Header.Set("X-ClickHouse-SSL-Certificate-Auth", "off")
 		} else {
 			req.Header.Set("X-ClickHouse-SSL-Certificate-Auth", "on")
 		}
-	case opt.TLS == nil && len(opt.Auth.Username) > 0:
-		if len(opt.Auth.Password) > 0 {
-			req.URL.User = url.UserPassword(opt.Auth.Username, opt.Auth.Password)
+	case opt.TLS == nil && len(username) > 0:
+		if len(password) > 0 {
+			req.URL.User = url.UserPassword(username, password)
 
 		} else {
-			req.URL.User = url.User(opt.Auth.Username)
+			req.URL.User = url.User(username)
 		}
 	}
 
@@ -157,6 +172,13 @@ func dialHttp(ctx context.Context, addr string, num int, opt *Options) (*httpCon
 	scheme := opt.scheme
 	compression := opt.Compression
 
+	if opt.Auth.SSHSigner != nil {
+		return nil, ErrSSHAuthNativeOnly
+	}
+	if opt.Auth.ClusterSecret != "" {
+		return nil, ErrClusterSecretNativeOnly
+	}
+
 	if scheme == "" {
 		switch opt.Protocol {
 		case HTTP:
@@ -226,8 +248,13 @@ func dialHttp(ctx context.Context, addr string, num int, opt *Options) (*httpCon
 		blockBufferSize: opt.BlockBufferSize,
 		waitEndOfQuery:  settingEnabled(opt.Settings, "wait_end_of_query"),
 	}
+	conn.connTelemetry.addr = u.Host
 
 	handshake, err := conn.queryHello(ctx, func(nativeTransport, error) {})
+	if opt.credentials != nil && isAuthenticationFailed(err) {
+		// the rejected request refreshed the credentials of the provider
+		handshake, err = conn.queryHello(ctx, func(nativeTransport, error) {})
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query server hello: %w", err)
 	}
@@ -238,6 +265,11 @@ func dialHttp(ctx context.Context, addr string, num int, opt *Options) (*httpCon
 }
 
 func createHTTPRoundTripper(opt *Options) (http.RoundTripper, error) {
+	tlsConfig, err := opt.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	httpProxy := http.ProxyFromEnvironment
 	if opt.HTTPProxyURL != nil {
 		httpProxy = http.ProxyURL(opt.HTTPProxyURL)
@@ -252,7 +284,7 @@ func createHTTPRoundTripper(opt *Options) (http.RoundTripper, error) {
 		MaxConnsPerHost:       opt.HttpMaxConnsPerHost,
 		IdleConnTimeout:       opt.ConnMaxLifetime,
 		ResponseHeaderTimeout: opt.ReadTimeout,
-		TLSClientConfig:       opt.TLS,
+		TLSClientConfig:       tlsConfig,
 		DisableCompression:    true,
 	}
 
@@ -286,16 +318,25 @@ type httpConnect struct {
 	blockBufferSize uint8
 	handshake       proto.ServerHandshake
 	waitEndOfQuery  bool // connection-level wait_end_of_query from Options.Settings
+	connTelemetry   connTelemetry
 }
 
 func (h *httpConnect) serverVersion() (*ServerVersion, error) {
 	return &h.handshake, nil
 }
 
+func (h *httpConnect) telemetry() *connTelemetry {
+	return &h.connTelemetry
+}
+
 func (h *httpConnect) connID() int {
 	return h.id
 }
 
+func (h *httpConnect) addr() string {
+	return h.url.Host
+}
+
 func (h *httpConnect) connectedAtTime() time.Time {
 	return h.connectedAt
 }
@@ -433,7 +474,7 @@ func (h *httpConnect) readData(reader *chproto.Reader, timezone *time.Location,
 
 	serverContext := serverVersionToContext(h.handshake)
 	serverContext.Timezone = location
-	block := proto.Block{ServerContext: &serverContext}
+	block := proto.Block{Packet: proto.ServerData, ServerContext: &serverContext}
 	if h.compression == CompressionLZ4 || h.compression == CompressionZSTD {
 		reader.EnableCompression()
 		defer reader.DisableCompression()
@@ -682,6 +723,15 @@ func (h *httpConnect) createRequest(ctx context.Context, requestUrl string, read
 		if options.quotaKey != "" {
 			query.Set(quotaKeyParamName, options.quotaKey)
 		}
+		if session := options.session; session.id != "" {
+			query.Set(sessionIDParamName, session.id)
+			if session.timeout > 0 {
+				query.Set(sessionTimeoutParamName, strconv.Itoa(int(max(session.timeout.Seconds(), 1))))
+			}
+			if session.check {
+				query.Set(sessionCheckParamName, "1")
+			}
+		}
 		for key, value := range options.settings {
 			// check that query doesn't change format
 			if key == "default_format" {
@@ -754,10 +804,14 @@ func (h *httpConnect) executeRequest(req *http.Request) (*http.Response, error)
 	if h.client == nil {
 		return nil, sqldriver.ErrBadConn
 	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = countingReadCloser{countingReader{req.Body, &h.connTelemetry.sent}, req.Body}
+	}
 	resp, err := h.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	resp.Body = countingReadCloser{countingReader{resp.Body, &h.connTelemetry.received}, resp.Body}
 
 	if resp.StatusCode != http.StatusOK {
 		defer discardAndClose(resp.Body)
@@ -773,7 +827,15 @@ func (h *httpConnect) executeRequest(req *http.Request) (*http.Response, error)
 			return nil, &HTTPError{StatusCode: resp.StatusCode, Err: fmt.Errorf("failed to read response: %w", err)}
 		}
 
-		return nil, newHTTPError(resp.StatusCode, resp.Header, msgBytes)
+		httpErr := newHTTPError(resp.StatusCode, resp.Header, msgBytes)
+		if h.opt.credentials != nil && isAuthenticationFailed(httpErr) {
+			// the provider may have cached credentials rotated since, refresh
+			// them for the next requests
+			if _, _, err := h.opt.credentials.get(req.Context(), true); err != nil {
+				h.logger.Debug("failed to refresh credentials", slog.Any("error", err))
+			}
+		}
+		return nil, httpErr
 	}
 	return resp, nil
 }
@@ -1,6 +1,7 @@
 package clickhouse
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
@@ -13,26 +14,38 @@ import (
 	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
 )
 
-func fetchColumnNamesAndTypesForInsert(h *httpConnect, release nativeTransportRelease, ctx context.Context, tableName string, requestedColumnNames []string) ([]ColumnNameAndType, error) {
+func fetchColumnNamesAndTypesForInsert(h *httpConnect, release nativeTransportRelease, ctx context.Context, tableName string, requestedColumnNames []string) ([]ColumnNameAndType, []driver.ColumnDefault, error) {
 	describeTableQuery := fmt.Sprintf("DESCRIBE TABLE %s", tableName)
 	r, err := h.query(ctx, release, describeTableQuery)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer r.Close()
 
 	columnsToTypes := make(map[string]string)
-	var allColumns []string
+	var (
+		allColumns []string
+		defaults   []driver.ColumnDefault
+	)
 	for r.Next() {
 		var (
-			colName     string
-			colType     string
-			defaultType string
-			ignore      string
+			colName           string
+			colType           string
+			defaultType       string
+			defaultExpression string
+			ignore            string
 		)
 
-		if err = r.Scan(&colName, &colType, &defaultType, &ignore, &ignore, &ignore, &ignore); err != nil {
-			return nil, err
+		if err = r.Scan(&colName, &colType, &defaultType, &defaultExpression, &ignore, &ignore, &ignore); err != nil {
+			return nil, nil, err
+		}
+		if defaultType != "" {
+			defaults = append(defaults, driver.ColumnDefault{
+				Name:       colName,
+				Type:       colType,
+				Kind:       defaultType,
+				Expression: defaultExpression,
+			})
 		}
 		// these column types cannot be specified in INSERT queries
 		if defaultType == "MATERIALIZED" || defaultType == "ALIAS" {
@@ -51,7 +64,7 @@ func fetchColumnNamesAndTypesForInsert(h *httpConnect, release nativeTransportRe
 		for _, colName := range requestedColumnNames {
 			colType, ok := columnsToTypes[colName]
 			if !ok {
-				return nil, fmt.Errorf("column %s is not present in the table %s", colName, tableName)
+				return nil, nil, fmt.Errorf("column %s is not present in the table %s", colName, tableName)
 			}
 
 			insertColumns = append(insertColumns, ColumnNameAndType{
@@ -70,25 +83,28 @@ func fetchColumnNamesAndTypesForInsert(h *httpConnect, release nativeTransportRe
 		}
 	}
 
-	return insertColumns, nil
+	return insertColumns, defaults, nil
 }
 
-func newBlock(h *httpConnect, release nativeTransportRelease, ctx context.Context, query string) (string, *proto.Block, error) {
+// newBlock returns the normalized INSERT query, the table it inserts into,
+// its empty block and the column defaults of the table.
+func newBlock(h *httpConnect, release nativeTransportRelease, ctx context.Context, query string) (string, string, *proto.Block, []driver.ColumnDefault, error) {
 	normalizedQuery, tableName, requestedColumnNames, err := extractNormalizedInsertQueryAndColumns(query)
 	if err != nil {
-		return "", nil, err
+		return "", "", nil, nil, err
 	}
 
 	opt := queryOptions(ctx)
 	columns := opt.columnNamesAndTypes
+	var defaults []driver.ColumnDefault
 
 	// If the user didn't supply known column names/types, do expensive DESC TABLE logic
 	if opt.columnNamesAndTypes == nil {
-		fetchedColumns, err := fetchColumnNamesAndTypesForInsert(h, release, ctx, tableName, requestedColumnNames)
+		fetchedColumns, fetchedDefaults, err := fetchColumnNamesAndTypesForInsert(h, release, ctx, tableName, requestedColumnNames)
 		if err != nil {
-			return "", nil, fmt.Errorf("failed to determine columns for HTTP insert: %w", err)
+			return "", "", nil, nil, fmt.Errorf("failed to determine columns for HTTP insert: %w", err)
 		}
-		columns = fetchedColumns
+		columns, defaults = fetchedColumns, fetchedDefaults
 	}
 
 	var block proto.Block
@@ -96,16 +112,16 @@ func newBlock(h *httpConnect, release nativeTransportRelease, ctx context.Contex
 	block.ServerContext = &serverContext
 	for _, col := range columns {
 		if err := block.AddColumn(col.Name, column.Type(col.Type)); err != nil {
-			return "", nil, err
+			return "", "", nil, nil, err
 		}
 	}
 
-	return normalizedQuery, &block, nil
+	return normalizedQuery, tableName, &block, defaults, nil
 }
 
 func (h *httpConnect) prepareBatch(ctx context.Context, release nativeTransportRelease, acquire nativeTransportAcquire, query string, opts driver.PrepareBatchOptions) (driver.Batch, error) {
 	// release is not used within newBlock since the connection is held for the batch.
-	query, block, err := newBlock(h, func(nativeTransport, error) {}, ctx, query)
+	query, table, block, defaults, err := newBlock(h, func(nativeTransport, error) {}, ctx, query)
 	if err != nil {
 		err = fmt.Errorf("failed to init block for HTTP batch: %w", err)
 		release(h, err)
@@ -113,25 +129,52 @@ func (h *httpConnect) prepareBatch(ctx context.Context, release nativeTransportR
 	}
 
 	return &httpBatch{
-		ctx:         ctx,
-		conn:        h,
-		connRelease: release,
-		structMap:   &structMap{},
-		block:       block,
-		query:       query,
+		ctx:          ctx,
+		conn:         h,
+		connRelease:  release,
+		structMap:    &structMap{},
+		block:        block,
+		query:        query,
+		table:        table,
+		defaults:     defaults,
+		dedupID:      opts.InsertDeduplicationToken,
+		closeOnFlush: opts.CloseOnFlush || opts.InsertDeduplicationToken != "",
+		maxBytes:     opts.MaxBytes,
+		flushAtMax:   opts.FlushOnMaxBytes,
+		omitDefaults: opts.OmitDefaultColumns,
 	}, nil
 }
 
 type httpBatch struct {
-	query       string
-	err         error
-	ctx         context.Context
-	conn        *httpConnect
-	released    bool
-	connRelease nativeTransportRelease
-	structMap   *structMap
-	sent        bool
-	block       *proto.Block
+	query        string
+	table        string
+	defaults     []driver.ColumnDefault
+	dedupID      string
+	dedupSeq     int // dedupSeq numbers the INSERTs deduplicated under dedupID.
+	closeOnFlush bool
+	flushed      bool
+	maxBytes     int
+	flushAtMax   bool
+	omitDefaults bool
+	err          error
+	ctx          context.Context
+	conn         *httpConnect
+	released     bool
+	connRelease  nativeTransportRelease
+	structMap    *structMap
+	sent         bool
+	block        *proto.Block
+	stream       *httpBatchStream
+}
+
+// httpBatchStream is the INSERT request a batch writes the blocks it flushes
+// into, until it is sent.
+type httpBatchStream struct {
+	pipe   *io.PipeWriter
+	writer io.WriteCloser // writer compresses into pipe with the HTTP compression.
+	rw     HTTPReaderWriter
+	done   chan struct{} // done is closed once the request has ended with err.
+	err    error
 }
 
 func (b *httpBatch) release(err error) {
@@ -141,18 +184,106 @@ func (b *httpBatch) release(err error) {
 	}
 }
 
+// Flush writes the buffered rows into the INSERT request of the batch,
+// which the first Flush starts and Send completes. With closeOnFlush, each
+// Flush is an INSERT of its own instead.
 func (b *httpBatch) Flush() error {
-	// Flush and Send are effectively the same for HTTP, but users should just use Send until we
-	// figure out a way to do proper streaming.
+	if b.sent {
+		return ErrBatchAlreadySent
+	}
+	if b.err != nil {
+		return b.err
+	}
+	if b.block.Rows() == 0 {
+		return nil
+	}
+	if b.closeOnFlush {
+		// the block is kept if the INSERT fails, to be sent again under the same token
+		if err := b.send(b.ctx); err != nil {
+			return err
+		}
+		b.flushed = true
+		b.dedupSeq++
+		return nil
+	}
+	if b.stream == nil {
+		b.openStream(b.ctx)
+	}
+	if err := b.writeStream(); err != nil {
+		err = b.closeStream(err)
+		b.err = err
+		b.release(err)
+		return err
+	}
+	b.flushed = true
+	return nil
+}
+
+// openStream starts the INSERT request the batch streams its blocks into.
+func (b *httpBatch) openStream(ctx context.Context) {
+	options, headers := b.insertRequest()
+	rw := b.conn.compressionPool.Get()
+	pipeReader, pipeWriter := io.Pipe()
+	b.stream = &httpBatchStream{
+		pipe:   pipeWriter,
+		writer: rw.reset(pipeWriter),
+		rw:     rw,
+		done:   make(chan struct{}),
+	}
+	b.conn.logger.Debug("batch: streaming via HTTP", slog.Int("columns", len(b.block.Columns)))
+	go func(stream *httpBatchStream) {
+		defer close(stream.done)
+		stream.err = b.request(ctx, pipeReader, &options, headers)
+		// unblock a Flush writing into a request that has ended
+		pipeReader.CloseWithError(cmp.Or(stream.err, io.ErrClosedPipe))
+	}(b.stream)
+}
+
+// writeStream writes the buffered rows into the INSERT request and resets
+// the block.
+func (b *httpBatch) writeStream() error {
+	select {
+	case <-b.stream.done:
+		// the server ended the request early, most likely with an error
+		return cmp.Or(b.stream.err, io.ErrClosedPipe)
+	default:
+	}
+	if b.block.Rows() == 0 {
+		return nil
+	}
+	b.conn.buffer.Reset()
+	if err := b.conn.writeData(b.block); err != nil {
+		return err
+	}
+	if _, err := b.stream.writer.Write(b.conn.buffer.Buf); err != nil {
+		return err
+	}
+	b.block.Reset()
 	return nil
 }
 
+// closeStream ends the INSERT request and waits for its result. A non-nil
+// err aborts the request instead, so the server rejects it.
+func (b *httpBatch) closeStream(err error) error {
+	stream := b.stream
+	if err == nil {
+		err = stream.writer.Close()
+	}
+	stream.pipe.CloseWithError(err)
+	<-stream.done
+	b.conn.compressionPool.Put(stream.rw)
+	return cmp.Or(stream.err, err)
+}
+
 func (b *httpBatch) Close() error {
 	if b.sent || b.released {
 		return nil
 	}
 
 	b.sent = true
+	if b.stream != nil {
+		b.closeStream(os.ErrProcessDone)
+	}
 	b.release(nil)
 
 	return nil
@@ -166,30 +297,71 @@ func (b *httpBatch) Abort() error {
 	if b.sent {
 		return ErrBatchAlreadySent
 	}
+	if b.stream != nil {
+		b.closeStream(os.ErrProcessDone)
+	}
 	return nil
 }
 
 func (b *httpBatch) Append(v ...any) error {
+	_, err := b.append(v, false)
+	return err
+}
+
+// appendRow appends a row like Append, but a row that fails to convert is
+// taken back, and the batch kept usable, if its columns can be truncated.
+func (b *httpBatch) appendRow(v []any) (kept bool, err error) {
+	return b.append(v, true)
+}
+
+// truncatable reports whether appendRow can take back any row.
+func (b *httpBatch) truncatable() bool {
+	return b.block.Truncate(b.block.Rows())
+}
+
+func (b *httpBatch) append(v []any, truncate bool) (bool, error) {
 	if b.sent {
-		return ErrBatchAlreadySent
+		return false, ErrBatchAlreadySent
 	}
 	if b.err != nil {
-		return b.err
+		return false, b.err
+	}
+	if err := checkBatchSize(b, b.maxBytes, b.flushAtMax); err != nil {
+		return false, err
 	}
 
+	if b.omitDefaults && b.block.Rows() == 0 && !b.flushed {
+		if columns := insertColumnsForValues(b.block.ColumnsNames(), b.defaults, len(v)); columns != nil {
+			if err := b.insertColumns(columns); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	rows := b.block.Rows()
 	if err := b.block.Append(v...); err != nil {
+		if truncate && b.block.Truncate(rows) {
+			return true, err
+		}
 		b.err = fmt.Errorf("%w: %w", ErrBatchInvalid, err)
 		b.release(err)
-		return err
+		return false, err
 	}
 
-	return nil
+	return false, nil
 }
 
 func (b *httpBatch) AppendStruct(v any) error {
 	if b.err != nil {
 		return b.err
 	}
+	if b.omitDefaults && b.block.Rows() == 0 && !b.flushed {
+		if columns := insertColumnsForStruct(b.block.ColumnsNames(), b.defaults, b.structMap.fields(v)); columns != nil {
+			if err := b.insertColumns(columns); err != nil {
+				return err
+			}
+		}
+	}
 	values, err := b.structMap.Map("AppendStruct", b.block.ColumnsNames(), v, false)
 	if err != nil {
 		return err
@@ -197,6 +369,24 @@ func (b *httpBatch) AppendStruct(v any) error {
 	return b.Append(values...)
 }
 
+// insertColumns restricts the empty batch to the given columns, leaving the
+// others to the server.
+func (b *httpBatch) insertColumns(columns []string) error {
+	block, err := blockWithColumns(b.block, columns)
+	if err != nil {
+		b.err = fmt.Errorf("%w: %w", ErrBatchInvalid, err)
+		b.release(err)
+		return err
+	}
+	b.block = block
+	b.query = insertQueryWithColumns(b.table, columns)
+	return nil
+}
+
+func (b *httpBatch) ColumnDefaults() []driver.ColumnDefault {
+	return slices.Clone(b.defaults)
+}
+
 func (b *httpBatch) Column(idx int) driver.BatchColumn {
 	if len(b.block.Columns) <= idx {
 		return &batchColumn{
@@ -230,11 +420,30 @@ func (b *httpBatch) Send() (err error) {
 	if b.err != nil {
 		return b.err
 	}
-	if b.block.Rows() == 0 {
+	if b.block.Rows() == 0 && b.stream == nil {
 		return nil
 	}
+	ctx, op := b.conn.opt.instrumentation.start(b.ctx, "batch_send", b.query)
+	defer func() { op.end(err) }()
+	op.attach(b.conn)
+	if b.stream != nil {
+		// the flushed blocks are gone, so the request can't be retried
+		return b.closeStream(b.writeStream())
+	}
+	if b.flushed && b.dedupID == "" {
+		return b.send(ctx)
+	}
+	// the block is kept until the server accepts it, so every attempt resends it in full
+	return b.conn.opt.RetryPolicy.do(ctx, b.conn.logger, "batch send", func() error { return b.send(ctx) })
+}
 
+// insertRequest returns the options and headers of the INSERT requests of
+// the batch.
+func (b *httpBatch) insertRequest() (QueryOptions, map[string]string) {
 	options := queryOptions(b.ctx)
+	if b.dedupID != "" {
+		options.settings["insert_deduplication_token"] = insertDeduplicationToken(b.dedupID, b.dedupSeq)
+	}
 	headers := make(map[string]string)
 	switch b.conn.compression {
 	case CompressionGZIP, CompressionDeflate, CompressionBrotli:
@@ -243,16 +452,40 @@ func (b *httpBatch) Send() (err error) {
 		options.settings["decompress"] = "1"
 		options.settings["compress"] = "1"
 	}
+	options.settings["query"] = b.query
+	headers["Content-Type"] = "application/octet-stream"
+	return options, headers
+}
+
+// request sends an INSERT request with the given body.
+func (b *httpBatch) request(ctx context.Context, body io.Reader, options *QueryOptions, headers map[string]string) error {
+	res, err := b.conn.sendStreamQuery(ctx, body, options, headers) //nolint:bodyclose // false positive
+	if err != nil {
+		return fmt.Errorf("batch sendStreamQuery: %w", err)
+	}
+	// A 200 status is not yet success: a failure after the server flushed its
+	// headers arrives in-band, in the response body.
+	if err := b.conn.insertResponseError(res); err != nil {
+		return fmt.Errorf("batch: %w", err)
+	}
+	return nil
+}
+
+// send inserts the buffered rows with a request of their own.
+func (b *httpBatch) send(ctx context.Context) error {
+	options, headers := b.insertRequest()
 
 	compressionWriter := b.conn.compressionPool.Get()
 	defer b.conn.compressionPool.Put(compressionWriter)
 	pipeReader, pipeWriter := io.Pipe()
 	connWriter := compressionWriter.reset(pipeWriter)
 
+	done := make(chan struct{})
 	go func() {
 		var err error
-		defer pipeWriter.CloseWithError(err)
-		defer connWriter.Close()
+		defer close(done)
+		// an encoding error aborts the request
+		defer func() { pipeWriter.CloseWithError(err) }()
 		b.conn.buffer.Reset()
 		if err = b.conn.writeData(b.block); err != nil {
 			return
@@ -260,22 +493,19 @@ func (b *httpBatch) Send() (err error) {
 		if _, err = connWriter.Write(b.conn.buffer.Buf); err != nil {
 			return
 		}
+		err = connWriter.Close()
 	}()
 
-	options.settings["query"] = b.query
-	headers["Content-Type"] = "application/octet-stream"
-
 	b.conn.logger.Debug("batch: sending via HTTP",
 		slog.Int("columns", len(b.block.Columns)),
 		slog.Int("rows", b.block.Rows()))
-	res, err := b.conn.sendStreamQuery(b.ctx, pipeReader, &options, headers) //nolint:bodyclose // false positive
+	err := b.request(ctx, pipeReader, &options, headers)
+	// unblock the writer if the request ended before reading the body, and
+	// wait for it before the buffer and the block are reused by a retry
+	pipeReader.CloseWithError(cmp.Or(err, io.ErrClosedPipe))
+	<-done
 	if err != nil {
-		return fmt.Errorf("batch sendStreamQuery: %w", err)
-	}
-	// A 200 status is not yet success: a failure after the server flushed its
-	// headers arrives in-band, in the response body.
-	if err := b.conn.insertResponseError(res); err != nil {
-		return fmt.Errorf("batch: %w", err)
+		return err
 	}
 
 	b.conn.logger.Debug("batch: send complete")
@@ -288,8 +518,13 @@ func (b *httpBatch) Rows() int {
 	return b.block.Rows()
 }
 
+func (b *httpBatch) Size() int {
+	return b.block.Size()
+}
+
 func (b *httpBatch) Columns() []column.Interface {
 	return slices.Clone(b.block.Columns)
 }
 
-var _ driver.Batch = (*httpBatch)(nil)
+var _ driver.SizedBatch = (*httpBatch)(nil)
+var _ driver.DefaultsBatch = (*httpBatch)(nil)
@@ -68,9 +68,10 @@ func (h *httpConnect) query(ctx context.Context, release nativeTransportRelease,
 		block := proto.NewBlock()
 		release(h, nil)
 		return &rows{
-			block:     block,
-			columns:   block.ColumnsNames(),
-			structMap: &structMap{},
+			block:       block,
+			columns:     block.ColumnsNames(),
+			structMap:   &structMap{},
+			extremesErr: ErrExtremesHTTPUnsupported,
 		}, nil
 	}
 
@@ -136,11 +137,12 @@ func (h *httpConnect) query(ctx context.Context, release nativeTransportRelease,
 	}
 
 	return &rows{
-		block:     block,
-		stream:    stream,
-		errors:    errCh,
-		columns:   block.ColumnsNames(),
-		structMap: &structMap{},
+		block:       block,
+		stream:      stream,
+		errors:      errCh,
+		columns:     block.ColumnsNames(),
+		structMap:   &structMap{},
+		extremesErr: ErrExtremesHTTPUnsupported,
 	}, nil
 }
 
@@ -0,0 +1,83 @@
+package clickhouse
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultSessionTimeout is the server default of session_timeout, used to
+// forget the host of a session that didn't set WithSessionTimeout.
+const defaultSessionTimeout = 60 * time.Second
+
+// httpSessions remembers which host each HTTP session lives on. Session
+// state is local to the server that created it, so every request of a
+// session has to go to that host.
+type httpSessions struct {
+	mu    sync.Mutex
+	hosts map[string]sessionHost
+	now   func() time.Time
+}
+
+type sessionHost struct {
+	addr    string
+	expires time.Time
+}
+
+func newHTTPSessions() *httpSessions {
+	return &httpSessions{
+		hosts: make(map[string]sessionHost),
+		now:   time.Now,
+	}
+}
+
+// host returns the address the session is pinned to, or "" if the session
+// is unknown or has been idle for longer than its timeout.
+func (s *httpSessions) host(id string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	host, ok := s.hosts[id]
+	if !ok {
+		return ""
+	}
+	if !s.now().Before(host.expires) {
+		delete(s.hosts, id)
+		return ""
+	}
+	return host.addr
+}
+
+// pin records that the session lives on addr, and extends how long it is
+// remembered by its timeout, as the server does on each request.
+func (s *httpSessions) pin(id, addr string, timeout time.Duration) {
+	if s == nil {
+		return
+	}
+	if timeout <= 0 {
+		timeout = defaultSessionTimeout
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if _, ok := s.hosts[id]; !ok {
+		// sweep expired sessions when a new one starts so abandoned ids don't accumulate
+		for other, host := range s.hosts {
+			if !now.Before(host.expires) {
+				delete(s.hosts, other)
+			}
+		}
+	}
+	s.hosts[id] = sessionHost{addr: addr, expires: now.Add(timeout)}
+}
+
+// unpin forgets the host of the session, e.g. after the host failed to dial.
+func (s *httpSessions) unpin(id string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.hosts, id)
+}
@@ -0,0 +1,130 @@
+package clickhouse
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSessionRequestParams(t *testing.T) {
+	conn := &httpConnect{
+		opt: &Options{},
+		url: &url.URL{Scheme: "http", Host: "ch-1:8123", RawQuery: "default_format=Native"},
+	}
+	request := func(ctx context.Context) url.Values {
+		options := queryOptions(ctx)
+		req, err := conn.prepareRequest(ctx, "SELECT 1", &options, nil)
+		require.NoError(t, err)
+		return req.URL.Query()
+	}
+
+	params := request(context.Background())
+	assert.False(t, params.Has(sessionIDParamName))
+
+	params = request(Context(context.Background(), WithSessionID("s1")))
+	assert.Equal(t, "s1", params.Get(sessionIDParamName))
+	assert.False(t, params.Has(sessionTimeoutParamName))
+	assert.False(t, params.Has(sessionCheckParamName))
+
+	params = request(Context(context.Background(),
+		WithSessionID("s1"),
+		WithSessionTimeout(5*time.Minute),
+		WithSessionCheck(true),
+	))
+	assert.Equal(t, "s1", params.Get(sessionIDParamName))
+	assert.Equal(t, "300", params.Get(sessionTimeoutParamName))
+	assert.Equal(t, "1", params.Get(sessionCheckParamName))
+	assert.Equal(t, "Native", params.Get("default_format"))
+
+	params = request(Context(context.Background(), WithSessionID("s1"), WithSessionTimeout(time.Millisecond)))
+	assert.Equal(t, "1", params.Get(sessionTimeoutParamName))
+}
+
+func TestHTTPSessions(t *testing.T) {
+	now := time.Now()
+	sessions := newHTTPSessions()
+	sessions.now = func() time.Time { return now }
+
+	assert.Empty(t, sessions.host("s1"))
+	sessions.pin("s1", "ch-1:8123", 0)
+	sessions.pin("s2", "ch-2:8123", 5*time.Minute)
+	assert.Equal(t, "ch-1:8123", sessions.host("s1"))
+	assert.Equal(t, "ch-2:8123", sessions.host("s2"))
+
+	// every use extends the pin by the session timeout
+	now = now.Add(50 * time.Second)
+	sessions.pin("s1", "ch-1:8123", 0)
+	now = now.Add(50 * time.Second)
+	assert.Equal(t, "ch-1:8123", sessions.host("s1"))
+
+	now = now.Add(defaultSessionTimeout)
+	assert.Empty(t, sessions.host("s1"))
+	assert.Equal(t, "ch-2:8123", sessions.host("s2"))
+
+	// starting a session sweeps the expired ones
+	now = now.Add(5 * time.Minute)
+	sessions.pin("s3", "ch-1:8123", 0)
+	assert.Len(t, sessions.hosts, 1)
+
+	sessions.unpin("s3")
+	assert.Empty(t, sessions.host("s3"))
+
+	var unset *httpSessions
+	unset.pin("s1", "ch-1:8123", 0)
+	assert.Empty(t, unset.host("s1"))
+}
+
+func TestAcquireHTTPSession(t *testing.T) {
+	var (
+		hosts = []*mockTransport{
+			{id: 1, connectedAt: time.Now(), address: "ch-1:8123"},
+			{id: 2, connectedAt: time.Now(), address: "ch-2:8123"},
+		}
+		dials = 0
+	)
+	opened, err := Open(&Options{
+		Addr:     []string{"ch-1:8123", "ch-2:8123"},
+		Protocol: HTTP,
+		DialStrategy: func(ctx context.Context, connID int, opt *Options, dial Dial) (DialResult, error) {
+			conn := hosts[dials]
+			dials++
+			return DialResult{conn: conn}, nil
+		},
+	})
+	require.NoError(t, err)
+	ch := opened.(*clickhouse)
+	defer ch.Close()
+
+	session := Context(context.Background(), WithSessionID("s1"))
+	first, err := ch.acquire(session)
+	require.NoError(t, err)
+	second, err := ch.acquire(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, first.connID())
+	require.Equal(t, 2, second.connID())
+	assert.Equal(t, "ch-1:8123", ch.sessions.host("s1"))
+
+	// the session gets the connection to its host even when another one is first in line
+	ch.release(second, nil)
+	ch.release(first, nil)
+	conn, err := ch.acquire(session)
+	require.NoError(t, err)
+	assert.Equal(t, 1, conn.connID())
+	other, err := ch.acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, other.connID())
+	ch.release(conn, nil)
+	ch.release(other, nil)
+	assert.Equal(t, 2, dials)
+
+	// sessions are ignored over the native protocol
+	ch.opt.Protocol = Native
+	conn, err = ch.acquire(Context(context.Background(), WithSessionID("s2")))
+	require.NoError(t, err)
+	ch.release(conn, nil)
+	assert.Empty(t, ch.sessions.host("s2"))
+}
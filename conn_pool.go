@@ -1,37 +1,134 @@
 package clickhouse
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"log/slog"
+	"maps"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2/internal/circular"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 )
 
 var errQueueEmpty = errors.New("clickhouse: connection pool queue is empty")
 
 type connPool struct {
 	mu    sync.RWMutex
-	conns *circular.Queue[nativeTransport]
-
-	ticker   *time.Ticker
-	finish   chan struct{}
-	finished chan struct{}
+	conns *circular.Queue[idleConn]
+
+	ticker    *time.Ticker
+	finish    chan struct{}
+	finished  chan struct{}
+	closeOnce sync.Once
+	// ctx is cancelled when the pool is closed, stopping its dials and pings.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// replenish wakes the background goroutine to dial idle connections.
+	replenish chan struct{}
 
 	maxConnLifetime time.Duration
+	maxIdleTime     time.Duration
+	minIdle         int
+	pingInterval    time.Duration
+	pingTimeout     time.Duration
+	dial            func(context.Context) (nativeTransport, error)
+	stats           *poolStats
+}
+
+// idleConn is a connection of the pool.
+type idleConn struct {
+	conn nativeTransport
+	// since is when the connection was put in the pool, and checked when it
+	// was last pinged or put in the pool.
+	since, checked time.Time
+}
+
+// connPoolOptions configures the idle connections of a connPool.
+type connPoolOptions struct {
+	// maxIdleTime closes the connections idle for longer.
+	maxIdleTime time.Duration
+	// minIdle connections are kept in the pool with dial.
+	minIdle int
+	dial    func(context.Context) (nativeTransport, error)
+	// pingInterval pings the connections idle for longer, with pingTimeout.
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	stats        *poolStats
+}
+
+// poolStats counts the events of a connection pool reported by Stats.
+type poolStats struct {
+	waitCount         atomic.Int64
+	waitDuration      atomic.Int64
+	dials             atomic.Int64
+	maxIdleClosed     atomic.Int64
+	maxIdleTimeClosed atomic.Int64
+	maxLifetimeClosed atomic.Int64
+	badConnClosed     atomic.Int64
+
+	mu         sync.Mutex
+	dialErrors map[string]int64
+}
+
+func (s *poolStats) dialFailed(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dialErrors == nil {
+		s.dialErrors = make(map[string]int64)
+	}
+	s.dialErrors[addr]++
+}
+
+// fill sets the counters of stats.
+func (s *poolStats) fill(stats *driver.Stats) {
+	stats.WaitCount = s.waitCount.Load()
+	stats.WaitDuration = time.Duration(s.waitDuration.Load())
+	stats.Dials = s.dials.Load()
+	stats.MaxIdleClosed = s.maxIdleClosed.Load()
+	stats.MaxIdleTimeClosed = s.maxIdleTimeClosed.Load()
+	stats.MaxLifetimeClosed = s.maxLifetimeClosed.Load()
+	stats.BadConnClosed = s.badConnClosed.Load()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.DialErrors = maps.Clone(s.dialErrors)
 }
 
 func newConnPool(lifetime time.Duration, capacity int) *connPool {
+	return newConnPoolWithOptions(lifetime, capacity, connPoolOptions{})
+}
+
+func newConnPoolWithOptions(lifetime time.Duration, capacity int, opt connPoolOptions) *connPool {
+	// the pool is checked as often as the shortest of its timeouts
+	interval := lifetime
+	for _, d := range []time.Duration{opt.maxIdleTime, opt.pingInterval} {
+		if d > 0 {
+			interval = min(interval, d)
+		}
+	}
 	pool := &connPool{
-		conns:           circular.New[nativeTransport](capacity),
-		ticker:          time.NewTicker(lifetime),
+		conns:           circular.New[idleConn](capacity),
+		ticker:          time.NewTicker(interval),
 		finish:          make(chan struct{}),
 		finished:        make(chan struct{}),
+		replenish:       make(chan struct{}, 1),
 		maxConnLifetime: lifetime,
+		maxIdleTime:     opt.maxIdleTime,
+		pingInterval:    opt.pingInterval,
+		pingTimeout:     cmp.Or(opt.pingTimeout, opt.pingInterval),
+		stats:           cmp.Or(opt.stats, &poolStats{}),
+	}
+	if opt.dial != nil {
+		pool.minIdle, pool.dial = min(opt.minIdle, capacity), opt.dial
 	}
+	pool.ctx, pool.cancel = context.WithCancel(context.Background())
 
+	// the idle connections are dialed before the pool is used; if a dial
+	// fails, the background goroutine retries on its next check
+	pool.dialIdle()
 	go pool.runDrainPool()
 
 	return pool
@@ -60,6 +157,7 @@ func (i *connPool) Get(ctx context.Context) (nativeTransport, error) {
 	if i.closed() {
 		return nil, ErrConnectionClosed
 	}
+	defer i.wantIdle()
 
 	// this loop continues until either:
 	// a) the provided context is cancelled
@@ -77,55 +175,100 @@ func (i *connPool) Get(ctx context.Context) (nativeTransport, error) {
 			return nil, errQueueEmpty // queue is empty
 		}
 
-		if !i.isExpired(conn) {
-			return conn, nil
+		if !i.evict(conn) {
+			return conn.conn, nil
 		}
+	}
+}
 
-		i.logExpired(conn, "closing expired connection from pool")
-		conn.close()
+// GetFunc pulls the oldest idle connection for which match returns true,
+// leaving the others in the pool. It returns errQueueEmpty if there is none.
+func (i *connPool) GetFunc(ctx context.Context, match func(nativeTransport) bool) (nativeTransport, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed() {
+		return nil, ErrConnectionClosed
+	}
+	defer i.wantIdle()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, context.Cause(ctx)
+		}
+
+		var (
+			conn  idleConn
+			found bool
+		)
+		for removed := range i.conns.DeleteFunc(func(c idleConn) bool {
+			if found || !match(c.conn) {
+				return false
+			}
+			found = true
+			return true
+		}) {
+			conn = removed
+		}
+		if !found {
+			return nil, errQueueEmpty
+		}
+
+		if !i.evict(conn) {
+			return conn.conn, nil
+		}
 	}
 }
 
 func (i *connPool) Put(conn nativeTransport) {
 	if i.isExpired(conn) {
 		i.logExpired(conn, "connection not returned to pool: lifetime expired")
+		i.stats.maxLifetimeClosed.Add(1)
 		conn.close()
 		return
 	}
 
 	if err := conn.healthCheck(); err != nil {
 		conn.getLogger().Debug("connection not returned to pool: connection is bad", slog.Any("reason", err))
+		i.stats.badConnClosed.Add(1)
 		conn.close()
 		return
 	}
 
+	now := time.Now()
+	i.push(idleConn{conn: conn, since: now, checked: now})
+}
+
+// push puts an idle connection in the pool, closing it if the pool is full or
+// closed.
+func (i *connPool) push(conn idleConn) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
 	if i.closed() {
+		conn.conn.close()
 		return
 	}
 
 	// Try to push the connection
 	if !i.conns.Push(conn) {
 		// Buffer is full, close the connection
-		conn.getLogger().Debug("connection not returned to pool: pool is full")
-		conn.close()
+		conn.conn.getLogger().Debug("connection not returned to pool: pool is full")
+		i.stats.maxIdleClosed.Add(1)
+		conn.conn.close()
 	}
 }
 
 func (i *connPool) Close() error {
+	i.closeOnce.Do(func() {
+		i.cancel()
+		close(i.finish)
+	})
+	<-i.finished
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	if i.closed() {
-		return nil
-	}
-
-	close(i.finish)
-
-	<-i.finished
-
 	// Drain all remaining connections from the pool
 	i.drainPool()
 
@@ -153,6 +296,10 @@ func (i *connPool) runDrainPool() {
 			i.mu.Lock()
 			i.drainPool()
 			i.mu.Unlock()
+			i.pingIdle()
+			i.dialIdle()
+		case <-i.replenish:
+			i.dialIdle()
 		case <-i.finish:
 			return
 		}
@@ -167,17 +314,93 @@ func (i *connPool) drainPool() {
 	if i.closed() {
 		// Close all connections
 		for conn := range i.conns.Clear() {
-			conn.close()
+			conn.conn.close()
 		}
 		return
 	}
 
 	// Remove only expired connections
-	for conn := range i.conns.DeleteFunc(func(conn nativeTransport) bool {
-		return i.isExpired(conn)
+	for range i.conns.DeleteFunc(i.evict) {
+	}
+}
+
+// evict closes conn if it reached its lifetime or idle time, reporting
+// whether it did.
+func (i *connPool) evict(conn idleConn) bool {
+	switch idle := time.Since(conn.since); {
+	case i.isExpired(conn.conn):
+		i.logExpired(conn.conn, "closing expired connection from pool")
+		i.stats.maxLifetimeClosed.Add(1)
+	case i.maxIdleTime > 0 && idle >= i.maxIdleTime:
+		conn.conn.getLogger().Debug("closing idle connection from pool",
+			slog.Duration("idle", idle),
+			slog.Duration("max_idle_time", i.maxIdleTime),
+		)
+		i.stats.maxIdleTimeClosed.Add(1)
+	default:
+		return false
+	}
+	conn.conn.close()
+	return true
+}
+
+// wantIdle wakes the background goroutine if fewer than minIdle connections
+// are idle. Must be called with i.mu held or before the pool is shared.
+func (i *connPool) wantIdle() {
+	if i.conns.Len() >= i.minIdle {
+		return
+	}
+	select {
+	case i.replenish <- struct{}{}:
+	default:
+	}
+}
+
+// dialIdle dials connections until minIdle are idle. A failed dial is retried
+// on the next tick.
+func (i *connPool) dialIdle() {
+	for i.Len() < i.minIdle && i.ctx.Err() == nil {
+		conn, err := i.dial(i.ctx)
+		if err != nil {
+			return
+		}
+		conn.setReleased(true)
+		conn.getLogger().Debug("idle connection established")
+		now := time.Now()
+		i.push(idleConn{conn: conn, since: now, checked: now})
+	}
+}
+
+// pingIdle pings the connections not used nor pinged for pingInterval,
+// closing those that fail. They are out of the pool while pinged.
+func (i *connPool) pingIdle() {
+	if i.pingInterval <= 0 {
+		return
+	}
+	var (
+		now  = time.Now()
+		idle []idleConn
+	)
+	i.mu.Lock()
+	for conn := range i.conns.DeleteFunc(func(c idleConn) bool {
+		return now.Sub(c.checked) >= i.pingInterval
 	}) {
-		i.logExpired(conn, "closing expired connection from pool")
-		conn.close()
+		idle = append(idle, conn)
+	}
+	i.mu.Unlock()
+
+	for _, conn := range idle {
+		ctx, cancel := context.WithTimeout(i.ctx, i.pingTimeout)
+		err := conn.conn.ping(ctx)
+		cancel()
+		if err != nil {
+			conn.conn.getLogger().Debug("closing idle connection from pool: ping failed", slog.Any("error", err))
+			i.stats.badConnClosed.Add(1)
+			conn.conn.close()
+			continue
+		}
+		conn.checked = time.Now()
+		i.push(conn)
 	}
 }
 
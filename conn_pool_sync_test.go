@@ -4,6 +4,8 @@ package clickhouse
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"testing/synctest"
 	"time"
@@ -67,3 +69,121 @@ func TestConnPool_ExpiredConnectionsAreDrained(t *testing.T) {
 		synctest.Wait()
 	})
 }
+
+func TestConnPool_MaxIdleTime(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		pool := newConnPoolWithOptions(time.Hour, 5, connPoolOptions{maxIdleTime: 50 * time.Millisecond})
+		defer pool.Close()
+
+		idle := &mockTransport{connectedAt: time.Now(), id: 1}
+		pool.Put(idle)
+		time.Sleep(40 * time.Millisecond)
+		// a connection used before its idle time is up stays open
+		retrieved, err := pool.Get(context.Background())
+		require.NoError(t, err)
+		pool.Put(retrieved)
+
+		// checked after 10ms of idle time
+		time.Sleep(20 * time.Millisecond)
+		synctest.Wait()
+		assert.False(t, idle.isClosed(), "connection should be idle for less than 50ms")
+		// checked after 60ms
+		time.Sleep(40 * time.Millisecond)
+		synctest.Wait()
+		assert.True(t, idle.isClosed(), "idle connection should be closed")
+		assert.Equal(t, 0, pool.Len())
+		assert.Equal(t, int64(1), pool.stats.maxIdleTimeClosed.Load())
+	})
+}
+
+func TestConnPool_MinIdle(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var (
+			mu     sync.Mutex
+			dialed []*mockTransport
+			fail   bool
+		)
+		pool := newConnPoolWithOptions(time.Hour, 3, connPoolOptions{
+			minIdle: 2,
+			dial: func(ctx context.Context) (nativeTransport, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if fail {
+					return nil, errors.New("connection refused")
+				}
+				conn := newMockTransport(len(dialed) + 1)
+				dialed = append(dialed, conn)
+				return conn, nil
+			},
+		})
+		dials := func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(dialed)
+		}
+
+		// the idle connections are dialed before the pool is returned
+		assert.Equal(t, 2, pool.Len())
+		assert.Equal(t, 2, dials())
+
+		// and replaced once used
+		conn, err := pool.Get(context.Background())
+		require.NoError(t, err)
+		assert.True(t, conn.isReleased())
+		synctest.Wait()
+		assert.Equal(t, 2, pool.Len())
+		assert.Equal(t, 3, dials())
+
+		// a failed dial is retried on the next check
+		mu.Lock()
+		fail = true
+		mu.Unlock()
+		_, err = pool.Get(context.Background())
+		require.NoError(t, err)
+		synctest.Wait()
+		assert.Equal(t, 1, pool.Len())
+		mu.Lock()
+		fail = false
+		mu.Unlock()
+		time.Sleep(time.Hour)
+		synctest.Wait()
+		assert.Equal(t, 2, pool.Len())
+		// the idle connection reached its lifetime and was replaced too
+		assert.Equal(t, 5, dials())
+		assert.True(t, dialed[2].isClosed())
+
+		require.NoError(t, pool.Close())
+		for _, conn := range dialed[3:] {
+			assert.True(t, conn.isClosed())
+		}
+	})
+}
+
+func TestConnPool_IdlePing(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		pool := newConnPoolWithOptions(time.Hour, 5, connPoolOptions{pingInterval: 50 * time.Millisecond})
+		defer pool.Close()
+
+		good := &mockTransport{connectedAt: time.Now(), id: 1}
+		bad := &mockTransport{connectedAt: time.Now(), id: 2, pingErr: errors.New("connection reset")}
+		pool.Put(good)
+		pool.Put(bad)
+
+		time.Sleep(50 * time.Millisecond)
+		synctest.Wait()
+		assert.Equal(t, 1, pool.Len())
+		assert.Equal(t, 1, good.pings)
+		assert.False(t, good.isClosed())
+		assert.True(t, bad.isClosed(), "connection failing its ping should be closed")
+		assert.Equal(t, int64(1), pool.stats.badConnClosed.Load())
+
+		// a used connection is not pinged
+		retrieved, err := pool.Get(context.Background())
+		require.NoError(t, err)
+		time.Sleep(40 * time.Millisecond)
+		pool.Put(retrieved)
+		time.Sleep(10 * time.Millisecond)
+		synctest.Wait()
+		assert.Equal(t, 1, good.pings)
+	})
+}
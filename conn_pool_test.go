@@ -529,16 +529,56 @@ func TestConnPool_FIFOOrdering(t *testing.T) {
 	}
 }
 
+func TestConnPool_GetFunc(t *testing.T) {
+	pool := newConnPool(time.Hour, 10)
+	defer pool.Close()
+
+	for id := 1; id <= 4; id++ {
+		pool.Put(&mockTransport{connectedAt: time.Now(), id: id})
+	}
+	pool.Put(&mockTransport{connectedAt: time.Now().Add(-2 * time.Hour), id: 6})
+	pool.Put(&mockTransport{connectedAt: time.Now(), id: 8})
+
+	even := func(conn nativeTransport) bool { return conn.connID()%2 == 0 }
+	ctx := context.Background()
+
+	conn, err := pool.GetFunc(ctx, even)
+	require.NoError(t, err)
+	assert.Equal(t, 2, conn.connID())
+	conn, err = pool.GetFunc(ctx, even)
+	require.NoError(t, err)
+	assert.Equal(t, 4, conn.connID())
+	// the expired connection is closed and skipped
+	conn, err = pool.GetFunc(ctx, even)
+	require.NoError(t, err)
+	assert.Equal(t, 8, conn.connID())
+	_, err = pool.GetFunc(ctx, even)
+	assert.ErrorIs(t, err, errQueueEmpty)
+
+	// unmatched connections stay in the pool in order
+	require.Equal(t, 2, pool.Len())
+	for _, id := range []int{1, 3} {
+		conn, err := pool.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, id, conn.connID())
+	}
+}
+
 // mockTransport implements nativeTransport for testing
 type mockTransport struct {
 	connectedAt   time.Time
 	id            int
+	address       string
 	released      bool
 	closed        bool
 	bad           bool
 	bufferFreed   bool
 	debugMessages []string
 	logger        *slog.Logger
+	tel           *connTelemetry
+	execErr       error
+	pingErr       error
+	pings         int
 	mu            sync.Mutex
 }
 
@@ -569,7 +609,10 @@ func (m *mockTransport) insertFormat(ctx context.Context, release nativeTranspor
 }
 
 func (m *mockTransport) exec(ctx context.Context, query string, args ...any) error {
-	return nil
+	if m.tel != nil {
+		m.tel.sent.Add(uint64(len(query)))
+	}
+	return m.execErr
 }
 
 func (m *mockTransport) asyncInsert(ctx context.Context, query string, wait bool, args ...any) error {
@@ -577,7 +620,10 @@ func (m *mockTransport) asyncInsert(ctx context.Context, query string, wait bool
 }
 
 func (m *mockTransport) ping(ctx context.Context) error {
-	return nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pings++
+	return m.pingErr
 }
 
 func (m *mockTransport) healthCheck() error {
@@ -593,6 +639,10 @@ func (m *mockTransport) connID() int {
 	return m.id
 }
 
+func (m *mockTransport) addr() string {
+	return m.address
+}
+
 func (m *mockTransport) connectedAtTime() time.Time {
 	return m.connectedAt
 }
@@ -616,6 +666,10 @@ func (m *mockTransport) getLogger() *slog.Logger {
 	return newNoopLogger()
 }
 
+func (m *mockTransport) telemetry() *connTelemetry {
+	return m.tel
+}
+
 func (m *mockTransport) freeBuffer() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -16,6 +16,7 @@ type onProcess struct {
 	progress      func(*Progress)
 	profileInfo   func(*ProfileInfo)
 	profileEvents func([]ProfileEvent)
+	tableColumns  func(*proto.TableColumns)
 }
 
 func (c *connect) firstBlock(ctx context.Context, on *onProcess) (*proto.Block, error) {
@@ -189,6 +190,9 @@ func (c *connect) handle(ctx context.Context, packet byte, on *onProcess) error
 			return err
 		}
 		c.logger.Debug("table columns received")
+		if on.tableColumns != nil {
+			on.tableColumns(&info)
+		}
 	case proto.ServerProfileEvents:
 		scanEvents := on.profileEvents != nil
 		events, err := c.profileEvents(ctx, scanEvents)
@@ -1,6 +1,7 @@
 package clickhouse
 
 import (
+	"cmp"
 	"log/slog"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
@@ -26,6 +27,11 @@ func (c *connect) sendQuery(body string, o *QueryOptions) error {
 		Settings:                 c.settings(o.settings),
 		Parameters:               parametersToProtoParameters(o.parameters),
 	}
+	if auth := c.opt.Auth; auth.ClusterSecret != "" {
+		q.Secondary = true
+		q.InitialUser = cmp.Or(o.initialUser, auth.Username)
+		q.InterserverHash = interserverHash(c.interserverSalt, auth.ClusterSecret, q.Body, q.ID, q.InitialUser)
+	}
 	if err := q.Encode(c.buffer, c.revision); err != nil {
 		return err
 	}
@@ -39,13 +39,22 @@ type (
 		ok   bool
 		wait bool
 	}
+	sessionOptions struct {
+		id      string
+		timeout time.Duration
+		check   bool
+	}
 	QueryOptions struct {
 		span     trace.SpanContext
 		async    AsyncOptions
+		session  sessionOptions
 		queryID  string
 		quotaKey string
 		jwt      string
-		events   struct {
+		// initialUser runs the query on behalf of another user over
+		// Auth.ClusterSecret.
+		initialUser string
+		events      struct {
 			logs          func(*Log)
 			progress      func(*Progress)
 			profileInfo   func(*ProfileInfo)
@@ -75,6 +84,38 @@ func WithQueryID(queryID string) QueryOption {
 	}
 }
 
+// WithSessionID runs the query in the HTTP session with the given id, so
+// temporary tables, SET statements and USE persist between queries that
+// share it. Requests of a session are pinned to the host that served its
+// first query. The server allows one query at a time per session.
+//
+// Sessions only apply to the HTTP protocol; native connections are already
+// stateful and ignore them.
+func WithSessionID(id string) QueryOption {
+	return func(o *QueryOptions) error {
+		o.session.id = id
+		return nil
+	}
+}
+
+// WithSessionTimeout sets how long the server keeps an idle HTTP session
+// alive (session_timeout, in whole seconds). The server default is 60s.
+func WithSessionTimeout(timeout time.Duration) QueryOption {
+	return func(o *QueryOptions) error {
+		o.session.timeout = timeout
+		return nil
+	}
+}
+
+// WithSessionCheck makes the server fail the query (session_check) if its
+// HTTP session does not exist yet or has expired, instead of creating it.
+func WithSessionCheck(check bool) QueryOption {
+	return func(o *QueryOptions) error {
+		o.session.check = check
+		return nil
+	}
+}
+
 func WithBlockBufferSize(size uint8) QueryOption {
 	return func(o *QueryOptions) error {
 		o.blockBufferSize = size
@@ -98,6 +139,15 @@ func WithJWT(jwt string) QueryOption {
 	}
 }
 
+// WithInitialUser runs the query on behalf of user instead of Auth.Username.
+// This only applies for clients authenticated with Auth.ClusterSecret.
+func WithInitialUser(user string) QueryOption {
+	return func(o *QueryOptions) error {
+		o.initialUser = user
+		return nil
+	}
+}
+
 // WithColumnNamesAndTypes is used to provide a predetermined list of
 // column names and types for HTTP inserts.
 // Without this, the HTTP implementation will parse the query and run a
@@ -252,6 +302,15 @@ func queryOptionsAsync(ctx context.Context) AsyncOptions {
 	return AsyncOptions{}
 }
 
+// queryOptionsSession returns the HTTP session options within the given context's QueryOptions.
+func queryOptionsSession(ctx context.Context) sessionOptions {
+	if opt, ok := ctx.Value(_contextOptionKey).(QueryOptions); ok {
+		return opt.session
+	}
+
+	return sessionOptions{}
+}
+
 // queryOptionsUserLocation returns the *time.Location within the given context's QueryOptions.
 func queryOptionsUserLocation(ctx context.Context) *time.Location {
 	if opt, ok := ctx.Value(_contextOptionKey).(QueryOptions); ok {
@@ -310,9 +369,11 @@ func (q *QueryOptions) clone() QueryOptions {
 	c := QueryOptions{
 		span:                q.span,
 		async:               q.async,
+		session:             q.session,
 		queryID:             q.queryID,
 		quotaKey:            q.quotaKey,
 		jwt:                 q.jwt,
+		initialUser:         q.initialUser,
 		events:              q.events,
 		settings:            nil,
 		parameters:          nil,
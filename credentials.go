@@ -0,0 +1,101 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// exceptionCodeAuthenticationFailed is the AUTHENTICATION_FAILED server error.
+const exceptionCodeAuthenticationFailed = 516
+
+// Credentials are the username and password a connection authenticates with.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialsProvider supplies the credentials of Auth.CredentialsProvider,
+// so they can be rotated without reopening the client: read from a secrets
+// manager, a file mounted by the orchestrator or exchanged for a cloud token.
+//
+// Credentials is called for each connection dialed over the native protocol
+// and for each request over HTTP, so providers fetching them remotely should
+// cache them. When the server rejects the credentials with
+// AUTHENTICATION_FAILED (516), Credentials is called again with refresh set
+// and should fetch them rather than return its cache: a native dial is then
+// retried once, as is the first request of an HTTP connection.
+//
+// Native connections authenticated with credentials that have since changed
+// are closed rather than reused, so the pool moves to the new credentials as
+// it dials connections. Implementations must be safe for concurrent use.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context, refresh bool) (Credentials, error)
+}
+
+// CredentialsFunc adapts a function to a CredentialsProvider.
+type CredentialsFunc func(ctx context.Context, refresh bool) (Credentials, error)
+
+func (f CredentialsFunc) Credentials(ctx context.Context, refresh bool) (Credentials, error) {
+	return f(ctx, refresh)
+}
+
+// PasswordFile returns a CredentialsProvider authenticating username with the
+// password read from path, such as a Kubernetes or Vault agent secret. The
+// file is read for every connection, so a rotated password is used as soon as
+// the file is replaced. Surrounding whitespace is trimmed.
+func PasswordFile(username, path string) CredentialsProvider {
+	return CredentialsFunc(func(context.Context, bool) (Credentials, error) {
+		password, err := os.ReadFile(path)
+		if err != nil {
+			return Credentials{}, err
+		}
+		return Credentials{
+			Username: username,
+			Password: strings.TrimSpace(string(password)),
+		}, nil
+	})
+}
+
+// credentialsCache tracks the credentials returned by the CredentialsProvider
+// of a pool, counting how often they changed so the connections dialed with
+// older credentials can be retired.
+type credentialsCache struct {
+	provider CredentialsProvider
+
+	mu         sync.Mutex
+	last       Credentials
+	generation uint64
+}
+
+// get returns the credentials of the provider and their generation.
+func (c *credentialsCache) get(ctx context.Context, refresh bool) (Credentials, uint64, error) {
+	credentials, err := c.provider.Credentials(ctx, refresh)
+	if err != nil {
+		return Credentials{}, 0, fmt.Errorf("clickhouse: failed to get credentials: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == 0 || credentials != c.last {
+		c.last = credentials
+		c.generation++
+	}
+	return credentials, c.generation, nil
+}
+
+// current returns the generation of the last credentials returned.
+func (c *credentialsCache) current() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// isAuthenticationFailed reports whether err is an AUTHENTICATION_FAILED
+// exception.
+func isAuthenticationFailed(err error) bool {
+	exception := new(Exception)
+	return errors.As(err, &exception) && exception.Code == exceptionCodeAuthenticationFailed
+}
@@ -0,0 +1,214 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chproto "github.com/ClickHouse/ch-go/proto"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+// rotatingCredentials caches the password of a fake secrets manager until
+// asked to refresh it.
+type rotatingCredentials struct {
+	mu       sync.Mutex
+	cached   string
+	password string
+	err      error
+	calls    []bool
+}
+
+func (r *rotatingCredentials) Credentials(_ context.Context, refresh bool) (Credentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, refresh)
+	if r.err != nil {
+		return Credentials{}, r.err
+	}
+	if refresh || r.cached == "" {
+		r.cached = r.password
+	}
+	return Credentials{Username: "user", Password: r.cached}, nil
+}
+
+func (r *rotatingCredentials) rotate(password string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.password = password
+}
+
+func (r *rotatingCredentials) takeCalls() []bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls
+	r.calls = nil
+	return calls
+}
+
+// fakeNativeConn is the server side of a connection to fakeNativeServer,
+// with the hello the client sent up to its password.
+type fakeNativeConn struct {
+	net.Conn
+	reader                   *chproto.Reader
+	database, user, password string
+}
+
+// reject fails the authentication with an exception of message.
+func (c *fakeNativeConn) reject(message string) {
+	var buffer chproto.Buffer
+	buffer.PutByte(proto.ServerException)
+	buffer.PutInt32(exceptionCodeAuthenticationFailed)
+	buffer.PutString("DB::Exception")
+	buffer.PutString(message)
+	buffer.PutString("")
+	buffer.PutBool(false)
+	_, _ = c.Write(buffer.Buf)
+}
+
+// accept ends the handshake with an end of stream, which the client takes
+// for a server hello.
+func (c *fakeNativeConn) accept() {
+	var buffer chproto.Buffer
+	buffer.PutByte(proto.ServerEndOfStream)
+	_, _ = c.Write(buffer.Buf)
+}
+
+// fakeNativeServer returns an Options.DialContext to a fake server reading
+// the hello of the client, then authenticating it with auth, which calls
+// reject or accept. The rest of the connection is discarded.
+func fakeNativeServer(auth func(c *fakeNativeConn)) func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(context.Context, string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			// the hello is the client name, version and revision, then the
+			// database, username and password
+			c := &fakeNativeConn{Conn: server, reader: chproto.NewReader(server)}
+			if _, err := c.reader.ReadByte(); err != nil {
+				return
+			}
+			_, _ = c.reader.Str()
+			for range 3 {
+				_, _ = c.reader.UVarInt()
+			}
+			c.database, _ = c.reader.Str()
+			c.user, _ = c.reader.Str()
+			var err error
+			if c.password, err = c.reader.Str(); err != nil {
+				return
+			}
+			auth(c)
+			_, _ = io.Copy(io.Discard, c.reader)
+		}()
+		return client, nil
+	}
+}
+
+// fakeNativeAuth returns an Options.DialContext to a fake server accepting
+// the hello of user with password only.
+func fakeNativeAuth(password string) func(ctx context.Context, addr string) (net.Conn, error) {
+	return fakeNativeServer(func(c *fakeNativeConn) {
+		if c.user != "user" || c.password != password {
+			c.reject("user: Authentication failed")
+			return
+		}
+		c.accept()
+	})
+}
+
+func TestCredentialsProvider(t *testing.T) {
+	var (
+		provider = &rotatingCredentials{password: "old"}
+		ctx      = context.Background()
+		opt      = (&Options{
+			Auth:        Auth{CredentialsProvider: provider},
+			DialContext: fakeNativeAuth("old"),
+		}).setDefaults()
+	)
+	conn, err := dial(ctx, "fake:9000", 1, opt)
+	require.NoError(t, err)
+	defer conn.close()
+	assert.Equal(t, []bool{false}, provider.takeCalls())
+
+	// the password is rotated: the cached one is rejected, then refreshed
+	provider.rotate("new")
+	opt.DialContext = fakeNativeAuth("new")
+	rotated, err := dial(ctx, "fake:9000", 2, opt)
+	require.NoError(t, err)
+	defer rotated.close()
+	assert.Equal(t, []bool{false, true}, provider.takeCalls())
+	assert.ErrorIs(t, conn.healthCheck(), errCredentialsRotated)
+
+	// a password rejected after a refresh fails the dial
+	opt.DialContext = fakeNativeAuth("newer")
+	_, err = dial(ctx, "fake:9000", 3, opt)
+	exception := new(Exception)
+	require.ErrorAs(t, err, &exception)
+	assert.Equal(t, int32(exceptionCodeAuthenticationFailed), exception.Code)
+	assert.Equal(t, []bool{false, true}, provider.takeCalls())
+
+	provider.err = errors.New("vault is sealed")
+	_, err = dial(ctx, "fake:9000", 4, opt)
+	assert.ErrorContains(t, err, "failed to get credentials: vault is sealed")
+}
+
+func TestCredentialsProviderHTTP(t *testing.T) {
+	password := "old"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if user, got, _ := r.BasicAuth(); user != "user" || got != password {
+			w.Header().Set(exceptionCodeHeader, "516")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("Code: 516. DB::Exception: user: Authentication failed. (AUTHENTICATION_FAILED)"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	provider := &rotatingCredentials{password: "old"}
+	h := newTestHTTPConnect(t, srv.URL)
+	h.opt = (&Options{Auth: Auth{CredentialsProvider: provider}}).setDefaults()
+	ctx := context.Background()
+	require.NoError(t, h.exec(ctx, "SELECT 1"))
+
+	// the rejected request refreshes the credentials for the next ones
+	password = "new"
+	provider.rotate("new")
+	err := h.exec(ctx, "SELECT 1")
+	exception := new(Exception)
+	require.ErrorAs(t, err, &exception)
+	assert.Equal(t, int32(exceptionCodeAuthenticationFailed), exception.Code)
+	require.NoError(t, h.exec(ctx, "SELECT 1"))
+	assert.Equal(t, []bool{false, false, true, false}, provider.takeCalls())
+}
+
+func TestPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0o600))
+	provider := PasswordFile("user", path)
+
+	credentials, err := provider.Credentials(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "user", Password: "secret"}, credentials)
+
+	require.NoError(t, os.WriteFile(path, []byte("rotated"), 0o600))
+	credentials, err = provider.Credentials(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", credentials.Password)
+
+	_, err = PasswordFile("user", filepath.Join(t.TempDir(), "missing")).Credentials(context.Background(), true)
+	assert.Error(t, err)
+}
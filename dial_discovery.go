@@ -0,0 +1,316 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ClusterDiscoveryOptions configures a ClusterDiscovery.
+type ClusterDiscoveryOptions struct {
+	// Cluster is the name of the cluster in system.clusters.
+	Cluster string
+	// RefreshInterval is how often the topology is read again in the
+	// background. Defaults to 1 minute.
+	RefreshInterval time.Duration
+	// Port is the port to dial the discovered hosts on. By default the native
+	// protocol uses the port of system.clusters and HTTP the port of the host
+	// the topology was read from, since system.clusters only lists the
+	// native ports.
+	Port int
+	// DialStrategy dials the discovered hosts, DefaultDialStrategy if nil.
+	// It may be the Dial method of a HealthAwareDialStrategy.
+	DialStrategy func(ctx context.Context, connID int, options *Options, dial Dial) (DialResult, error)
+}
+
+// ClusterReplica is a replica of a cluster as listed in system.clusters.
+type ClusterReplica struct {
+	// Shard is the number of the shard of the replica, from 1.
+	Shard int
+	// ShardWeight is the weight of the shard of the replica.
+	ShardWeight int
+	// Replica is the number of the replica in its shard, from 1.
+	Replica int
+	Host    string
+	Port    int
+	// Addr is the address the replica is dialed on.
+	Addr string
+}
+
+// ClusterTopology is the layout of a cluster read from system.clusters.
+type ClusterTopology struct {
+	Cluster  string
+	Replicas []ClusterReplica
+	// RefreshedAt is when the topology was read.
+	RefreshedAt time.Time
+}
+
+// Addr returns the addresses of all replicas.
+func (t ClusterTopology) Addr() []string {
+	addr := make([]string, 0, len(t.Replicas))
+	for _, replica := range t.Replicas {
+		addr = append(addr, replica.Addr)
+	}
+	return addr
+}
+
+// Shards returns the shards of the cluster in order, to be opened with
+// OpenSharded.
+func (t ClusterTopology) Shards() []Shard {
+	var shards []Shard
+	for i, replica := range t.Replicas {
+		if i == 0 || replica.Shard != t.Replicas[i-1].Shard {
+			shards = append(shards, Shard{Weight: replica.ShardWeight})
+		}
+		shard := &shards[len(shards)-1]
+		shard.Addr = append(shard.Addr, replica.Addr)
+	}
+	return shards
+}
+
+// ClusterDiscovery is a dial strategy that dials the replicas of a cluster
+// read from system.clusters rather than a fixed Options.Addr, so replicas
+// added to or removed from the cluster are picked up without changing the
+// configuration of the clients. Options.Addr only lists the seed hosts the
+// topology is first read from. Use its Dial method as Options.DialStrategy:
+//
+//	discovery := clickhouse.NewClusterDiscovery(clickhouse.ClusterDiscoveryOptions{Cluster: "default"})
+//	defer discovery.Close()
+//	conn, err := clickhouse.Open(&clickhouse.Options{
+//		Addr:         []string{"seed-1:9000", "seed-2:9000"},
+//		DialStrategy: discovery.Dial,
+//	})
+//
+// The topology is read by the first dial, then again in the background every
+// RefreshInterval, from one of the discovered hosts or the seeds, until Close.
+// A dial also starts a refresh if the topology is older than RefreshInterval.
+// The seeds are dialed until a topology is read; if a refresh fails the last
+// topology is kept. Connections to removed replicas stay in the pool until
+// they are closed, see Options.ConnMaxLifetime.
+//
+// The strategy is safe for concurrent use; a connection pool should have its
+// own since the topology is read with the options of the pool. Close it once
+// the pool is closed, to stop the refreshes.
+type ClusterDiscovery struct {
+	opt        ClusterDiscoveryOptions
+	mu         sync.Mutex
+	topology   ClusterTopology
+	err        error
+	checkedAt  time.Time
+	refreshing bool
+	now        func() time.Time
+	// fetch reads the replicas of cluster from system.clusters with conn.
+	fetch func(ctx context.Context, conn nativeTransport, cluster string) ([]ClusterReplica, error)
+	// dialOpt and dial are those of the last Dial, to refresh with.
+	dialOpt *Options
+	dial    Dial
+
+	// ctx is cancelled by Close, stopping the refreshes.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewClusterDiscovery(opt ClusterDiscoveryOptions) *ClusterDiscovery {
+	if opt.RefreshInterval <= 0 {
+		opt.RefreshInterval = time.Minute
+	}
+	if opt.DialStrategy == nil {
+		opt.DialStrategy = DefaultDialStrategy
+	}
+	d := &ClusterDiscovery{
+		opt:   opt,
+		now:   time.Now,
+		fetch: fetchClusterReplicas,
+		done:  make(chan struct{}),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	go d.runRefresher()
+	return d
+}
+
+// Close stops refreshing the topology. The strategy must not be used to dial
+// afterwards.
+func (d *ClusterDiscovery) Close() error {
+	d.closeOnce.Do(func() {
+		d.cancel()
+		<-d.done
+	})
+	return nil
+}
+
+func (d *ClusterDiscovery) runRefresher() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.opt.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.mu.Lock()
+			// nothing to dial with before the first Dial
+			if d.dial != nil && !d.refreshing {
+				d.startRefresh()
+			}
+			d.mu.Unlock()
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// startRefresh refreshes the topology in the background. d.mu must be held.
+func (d *ClusterDiscovery) startRefresh() {
+	d.refreshing = true
+	opt, dial := d.dialOpt, d.dial
+	go func() {
+		ctx, cancel := context.WithTimeout(d.ctx, opt.DialTimeout)
+		defer cancel()
+		d.refresh(ctx, opt, dial)
+	}()
+}
+
+// Dial implements the Options.DialStrategy signature.
+func (d *ClusterDiscovery) Dial(ctx context.Context, connID int, opt *Options, dial Dial) (DialResult, error) {
+	d.mu.Lock()
+	d.dialOpt, d.dial = opt, dial
+	switch {
+	case d.checkedAt.IsZero() && !d.refreshing:
+		d.refreshing = true
+		d.mu.Unlock()
+		d.refresh(ctx, opt, dial)
+	case !d.refreshing && d.now().Sub(d.checkedAt) >= d.opt.RefreshInterval:
+		d.startRefresh()
+		d.mu.Unlock()
+	default:
+		d.mu.Unlock()
+	}
+
+	o := *opt
+	if addr := d.addr(); len(addr) != 0 {
+		o.Addr = addr
+	}
+	return d.opt.DialStrategy(ctx, connID, &o, dial)
+}
+
+// Topology returns the last topology read, and the error of the last refresh
+// if it failed.
+func (d *ClusterDiscovery) Topology() (ClusterTopology, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	topology := d.topology
+	topology.Replicas = slices.Clone(topology.Replicas)
+	return topology, d.err
+}
+
+func (d *ClusterDiscovery) addr() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.topology.Addr()
+}
+
+// refresh reads the topology from the first discovered host or seed that
+// answers.
+func (d *ClusterDiscovery) refresh(ctx context.Context, opt *Options, dial Dial) {
+	var (
+		hosts    = append(d.addr(), opt.Addr...)
+		topology ClusterTopology
+		err      = ErrAcquireConnNoAddress
+	)
+	for i, host := range hosts {
+		if slices.Contains(hosts[:i], host) {
+			continue
+		}
+		if topology, err = d.read(ctx, host, opt, dial); err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refreshing = false
+	if d.ctx.Err() != nil {
+		// closed, keep the last topology
+		return
+	}
+	d.checkedAt = d.now()
+	if d.err = err; err == nil {
+		d.topology = topology
+	}
+}
+
+// read reads the topology from host.
+func (d *ClusterDiscovery) read(ctx context.Context, host string, opt *Options, dial Dial) (ClusterTopology, error) {
+	r, err := dial(ctx, host, opt)
+	if err != nil {
+		return ClusterTopology{}, err
+	}
+	if r.conn == nil {
+		return ClusterTopology{}, errors.New("clickhouse: dial returned no connection")
+	}
+	defer r.conn.close()
+	replicas, err := d.fetch(ctx, r.conn, d.opt.Cluster)
+	if err != nil {
+		return ClusterTopology{}, fmt.Errorf("clickhouse: read cluster %s from %s: %w", d.opt.Cluster, host, err)
+	}
+	if len(replicas) == 0 {
+		return ClusterTopology{}, fmt.Errorf("clickhouse: cluster %s is not in system.clusters of %s", d.opt.Cluster, host)
+	}
+	seedPort := 0
+	if _, port, err := net.SplitHostPort(host); err == nil {
+		seedPort, _ = strconv.Atoi(port)
+	}
+	for i := range replicas {
+		port := replicas[i].Port
+		switch {
+		case d.opt.Port != 0:
+			port = d.opt.Port
+		case opt.Protocol == HTTP && seedPort != 0:
+			port = seedPort
+		}
+		replicas[i].Addr = net.JoinHostPort(replicas[i].Host, strconv.Itoa(port))
+	}
+	return ClusterTopology{
+		Cluster:     d.opt.Cluster,
+		Replicas:    replicas,
+		RefreshedAt: d.now(),
+	}, nil
+}
+
+func fetchClusterReplicas(ctx context.Context, conn nativeTransport, cluster string) ([]ClusterReplica, error) {
+	const query = `
+		SELECT shard_num, shard_weight, replica_num, host_name, port
+		FROM system.clusters
+		WHERE cluster = ?
+		ORDER BY shard_num, replica_num
+	`
+	rows, err := conn.query(ctx, func(nativeTransport, error) {}, query, cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var replicas []ClusterReplica
+	for rows.Next() {
+		var (
+			shard, weight, replica uint32
+			host                   string
+			port                   uint16
+		)
+		if err := rows.Scan(&shard, &weight, &replica, &host, &port); err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, ClusterReplica{
+			Shard:       int(shard),
+			ShardWeight: int(weight),
+			Replica:     int(replica),
+			Host:        host,
+			Port:        int(port),
+		})
+	}
+	return replicas, rows.Err()
+}
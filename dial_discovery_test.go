@@ -0,0 +1,172 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCluster is the system.clusters of the fake hosts.
+type fakeCluster struct {
+	mu       sync.Mutex
+	replicas []ClusterReplica
+	err      error
+}
+
+func (c *fakeCluster) fetch(_ context.Context, _ nativeTransport, cluster string) ([]ClusterReplica, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cluster != "cluster" {
+		return nil, nil
+	}
+	return append([]ClusterReplica(nil), c.replicas...), c.err
+}
+
+func (c *fakeCluster) set(err error, replicas ...ClusterReplica) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replicas, c.err = replicas, err
+}
+
+func TestClusterDiscovery(t *testing.T) {
+	var (
+		now       = time.Now()
+		hosts     = &fakeHosts{down: map[string]bool{}}
+		cluster   = &fakeCluster{}
+		discovery = NewClusterDiscovery(ClusterDiscoveryOptions{Cluster: "cluster", RefreshInterval: time.Minute})
+		opt       = (&Options{Addr: []string{"seed:9000"}}).setDefaults()
+		ctx       = context.Background()
+	)
+	defer discovery.Close()
+	discovery.now = func() time.Time { return now }
+	discovery.fetch = cluster.fetch
+	cluster.set(nil,
+		ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 1, Host: "a", Port: 9000},
+		ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 2, Host: "b", Port: 9000},
+		ClusterReplica{Shard: 2, ShardWeight: 2, Replica: 1, Host: "c", Port: 9440},
+	)
+
+	// the first dial reads the topology from the seed
+	_, err := discovery.Dial(ctx, 1, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"seed:9000", "a:9000"}, hosts.takeDialed())
+	topology, err := discovery.Topology()
+	require.NoError(t, err)
+	assert.Equal(t, "cluster", topology.Cluster)
+	assert.Equal(t, now, topology.RefreshedAt)
+	assert.Equal(t, []string{"a:9000", "b:9000", "c:9440"}, topology.Addr())
+	assert.Equal(t, []Shard{
+		{Addr: []string{"a:9000", "b:9000"}, Weight: 1},
+		{Addr: []string{"c:9440"}, Weight: 2},
+	}, topology.Shards())
+
+	// the discovered hosts are dialed by the dial strategy
+	hosts.setDown("a:9000", true)
+	_, err = discovery.Dial(ctx, 2, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:9000", "b:9000"}, hosts.takeDialed())
+
+	// a replica is added, and read in the background after the interval
+	cluster.set(nil,
+		ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 1, Host: "b", Port: 9000},
+		ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 2, Host: "d", Port: 9000},
+	)
+	now = now.Add(time.Minute)
+	_, err = discovery.Dial(ctx, 3, opt, hosts.dial)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		topology, _ := discovery.Topology()
+		return topology.RefreshedAt.Equal(now)
+	}, time.Second, time.Millisecond)
+	topology, err = discovery.Topology()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b:9000", "d:9000"}, topology.Addr())
+
+	// a failed refresh keeps the topology
+	readErr := errors.New("read failed")
+	cluster.set(readErr)
+	now = now.Add(time.Minute)
+	_, err = discovery.Dial(ctx, 4, opt, hosts.dial)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := discovery.Topology()
+		return errors.Is(err, readErr)
+	}, time.Second, time.Millisecond)
+	topology, _ = discovery.Topology()
+	assert.Equal(t, []string{"b:9000", "d:9000"}, topology.Addr())
+}
+
+func TestClusterDiscoverySeeds(t *testing.T) {
+	var (
+		hosts     = &fakeHosts{down: map[string]bool{"seed-1:8123": true}}
+		cluster   = &fakeCluster{}
+		discovery = NewClusterDiscovery(ClusterDiscoveryOptions{Cluster: "unknown"})
+		opt       = (&Options{Addr: []string{"seed-1:8123", "seed-2:8123"}, Protocol: HTTP}).setDefaults()
+		ctx       = context.Background()
+	)
+	defer discovery.Close()
+	discovery.fetch = cluster.fetch
+
+	// the seeds are dialed while the cluster is unknown
+	_, err := discovery.Dial(ctx, 1, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"seed-1:8123", "seed-2:8123", "seed-1:8123", "seed-2:8123"}, hosts.takeDialed())
+	_, err = discovery.Topology()
+	assert.ErrorContains(t, err, "cluster unknown is not in system.clusters of seed-2:8123")
+
+	// over HTTP the discovered hosts are dialed on the port of the seed
+	cluster.set(nil, ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 1, Host: "a", Port: 9000})
+	discovery = NewClusterDiscovery(ClusterDiscoveryOptions{Cluster: "cluster"})
+	defer discovery.Close()
+	discovery.fetch = cluster.fetch
+	_, err = discovery.Dial(ctx, 2, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"seed-1:8123", "seed-2:8123", "a:8123"}, hosts.takeDialed())
+
+	// unless the port is set
+	discovery = NewClusterDiscovery(ClusterDiscoveryOptions{Cluster: "cluster", Port: 8443})
+	defer discovery.Close()
+	discovery.fetch = cluster.fetch
+	_, err = discovery.Dial(ctx, 3, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"seed-1:8123", "seed-2:8123", "a:8443"}, hosts.takeDialed())
+}
+
+func TestClusterDiscoveryRefresher(t *testing.T) {
+	var (
+		hosts     = &fakeHosts{down: map[string]bool{}}
+		cluster   = &fakeCluster{}
+		discovery = NewClusterDiscovery(ClusterDiscoveryOptions{Cluster: "cluster", RefreshInterval: 5 * time.Millisecond})
+		opt       = (&Options{Addr: []string{"seed:9000"}}).setDefaults()
+	)
+	discovery.fetch = cluster.fetch
+	cluster.set(nil, ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 1, Host: "a", Port: 9000})
+	_, err := discovery.Dial(context.Background(), 1, opt, hosts.dial)
+	require.NoError(t, err)
+
+	// a replica is added and read without any dial through the strategy
+	cluster.set(nil,
+		ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 1, Host: "a", Port: 9000},
+		ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 2, Host: "b", Port: 9000},
+	)
+	require.Eventually(t, func() bool {
+		topology, _ := discovery.Topology()
+		return len(topology.Replicas) == 2
+	}, time.Second, time.Millisecond)
+
+	// once closed, the topology is no longer read
+	require.NoError(t, discovery.Close())
+	cluster.set(nil, ClusterReplica{Shard: 1, ShardWeight: 1, Replica: 1, Host: "c", Port: 9000})
+	hosts.takeDialed()
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, hosts.takeDialed())
+	topology, err := discovery.Topology()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:9000", "b:9000"}, topology.Addr())
+	require.NoError(t, discovery.Close())
+}
@@ -0,0 +1,350 @@
+package clickhouse
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// HostHealthOptions configures a HealthAwareDialStrategy.
+type HostHealthOptions struct {
+	// Cooldown is how long a host is skipped after its first failure. It
+	// doubles with every consecutive failure up to MaxCooldown.
+	// Defaults to 1 second.
+	Cooldown time.Duration
+	// MaxCooldown caps the cooldown. Defaults to 1 minute.
+	MaxCooldown time.Duration
+	// ProbeInterval is how often the hosts whose cooldown expired are
+	// probed in the background. Defaults to Cooldown.
+	ProbeInterval time.Duration
+	// PreferLowLatency dials healthy hosts in order of their measured
+	// latency instead of the order given by Options.ConnOpenStrategy. Hosts
+	// without a measurement yet are tried first so they get one.
+	PreferLowLatency bool
+}
+
+// HostHealth is a snapshot of what a HealthAwareDialStrategy knows about a host.
+type HostHealth struct {
+	Addr string
+	// Down reports whether the host is skipped by new dials.
+	Down bool
+	// DownUntil is when the host becomes eligible for a probe again.
+	DownUntil time.Time
+	// Failures is the number of consecutive dials or probes that failed to
+	// reach the host.
+	Failures int
+	// LastError is the error of the last failed dial or probe.
+	LastError error
+	// Latency is a moving average of the dial and probe round trip times.
+	Latency time.Duration
+}
+
+// HealthAwareDialStrategy is a dial strategy that remembers which hosts of
+// Options.Addr failed to dial or handshake, so a dead replica doesn't cost
+// DialTimeout on every new connection. Use its Dial method as
+// Options.DialStrategy:
+//
+//	strategy := clickhouse.NewHealthAwareDialStrategy(clickhouse.HostHealthOptions{})
+//	conn, err := clickhouse.Open(&clickhouse.Options{
+//		Addr:         []string{"replica-1:9000", "replica-2:9000"},
+//		DialStrategy: strategy.Dial,
+//	})
+//
+// A host that can't be reached, because of a network error or a timeout, is
+// marked down and skipped for an exponentially growing cooldown. Server
+// exceptions, even SOCKET_TIMEOUT or NETWORK_ERROR, don't count, as they come
+// from a live host. Once the cooldown expires, the host is probed (dial and
+// Ping) in the background, every ProbeInterval or by the next dial, whichever
+// comes first, and it only takes new connections again after a probe
+// succeeds. Down hosts are still tried as a last resort when every healthy
+// host fails.
+//
+// The strategy is safe for concurrent use and may be shared by several
+// connection pools to the same hosts. Close it once they are closed, to stop
+// the probes.
+type HealthAwareDialStrategy struct {
+	opt   HostHealthOptions
+	mu    sync.Mutex
+	hosts map[string]*hostHealth
+	now   func() time.Time
+
+	// ctx is cancelled by Close, stopping the prober and the probes.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type hostHealth struct {
+	failures  int
+	downUntil time.Time
+	lastErr   error
+	latency   time.Duration
+	probing   bool
+	// opt and dial are those of the last dial of the host, to probe it with.
+	opt  *Options
+	dial Dial
+}
+
+// latencyWeight is the weight of a new sample in the latency moving average.
+const latencyWeight = 0.2
+
+func NewHealthAwareDialStrategy(opt HostHealthOptions) *HealthAwareDialStrategy {
+	if opt.Cooldown <= 0 {
+		opt.Cooldown = time.Second
+	}
+	if opt.MaxCooldown <= 0 {
+		opt.MaxCooldown = time.Minute
+	}
+	opt.MaxCooldown = max(opt.MaxCooldown, opt.Cooldown)
+	if opt.ProbeInterval <= 0 {
+		opt.ProbeInterval = opt.Cooldown
+	}
+	s := &HealthAwareDialStrategy{
+		opt:   opt,
+		hosts: make(map[string]*hostHealth),
+		now:   time.Now,
+		done:  make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go s.runProber()
+	return s
+}
+
+// Close stops probing the down hosts. The strategy must not be used to dial
+// afterwards.
+func (s *HealthAwareDialStrategy) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		<-s.done
+	})
+	return nil
+}
+
+func (s *HealthAwareDialStrategy) runProber() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opt.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.probeExpired()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// probeExpired probes the down hosts whose cooldown expired in the
+// background.
+func (s *HealthAwareDialStrategy) probeExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for addr, h := range s.hosts {
+		if h.dial != nil {
+			s.startProbe(addr, h, now)
+		}
+	}
+}
+
+// startProbe probes addr in the background if it is down, its cooldown
+// expired and it is not probed already. s.mu must be held.
+func (s *HealthAwareDialStrategy) startProbe(addr string, h *hostHealth, now time.Time) {
+	if h.downUntil.IsZero() || h.probing || now.Before(h.downUntil) {
+		return
+	}
+	h.probing = true
+	go s.probe(addr, h.opt, h.dial)
+}
+
+// Dial implements the Options.DialStrategy signature.
+func (s *HealthAwareDialStrategy) Dial(ctx context.Context, connID int, opt *Options, dial Dial) (r DialResult, err error) {
+	candidates := s.candidates(connID, opt, dial)
+	for _, addr := range candidates {
+		start := time.Now()
+		if r, err = dial(ctx, addr, opt); err == nil {
+			s.markUp(addr, time.Since(start))
+			return r, nil
+		}
+		if ctx.Err() != nil {
+			// the caller gave up, which says nothing about the host
+			return r, err
+		}
+		if hostUnreachable(err) {
+			s.markDown(addr, err)
+		}
+	}
+
+	if err == nil {
+		err = ErrAcquireConnNoAddress
+	}
+
+	return r, err
+}
+
+// Hosts returns the health of every host dialed so far.
+func (s *HealthAwareDialStrategy) Hosts() []HostHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hosts := make([]HostHealth, 0, len(s.hosts))
+	for addr, h := range s.hosts {
+		hosts = append(hosts, HostHealth{
+			Addr:      addr,
+			Down:      !h.downUntil.IsZero(),
+			DownUntil: h.downUntil,
+			Failures:  h.failures,
+			LastError: h.lastErr,
+			Latency:   h.latency,
+		})
+	}
+	slices.SortFunc(hosts, func(a, b HostHealth) int {
+		return cmp.Compare(a.Addr, b.Addr)
+	})
+	return hosts
+}
+
+// candidates orders opt.Addr for a dial: healthy hosts first, by latency or
+// ConnOpenStrategy, then down hosts by the end of their cooldown. Down hosts
+// whose cooldown expired are probed in the background.
+func (s *HealthAwareDialStrategy) candidates(connID int, opt *Options, dial Dial) []string {
+	ordered := make([]string, 0, len(opt.Addr))
+	random := rand.Int()
+	for i := range opt.Addr {
+		var num int
+		switch opt.ConnOpenStrategy {
+		case ConnOpenInOrder:
+			num = i
+		case ConnOpenRoundRobin:
+			num = (connID + i) % len(opt.Addr)
+		case ConnOpenRandom:
+			num = (random + i) % len(opt.Addr)
+		}
+		ordered = append(ordered, opt.Addr[num])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var (
+		now     = s.now()
+		healthy = make([]string, 0, len(ordered))
+		down    []string
+	)
+	for _, addr := range ordered {
+		h := s.host(addr)
+		h.opt, h.dial = opt, dial
+		if h.downUntil.IsZero() {
+			healthy = append(healthy, addr)
+			continue
+		}
+		s.startProbe(addr, h, now)
+		down = append(down, addr)
+	}
+	if s.opt.PreferLowLatency {
+		slices.SortStableFunc(healthy, func(a, b string) int {
+			return cmp.Compare(s.hosts[a].latency, s.hosts[b].latency)
+		})
+	}
+	slices.SortStableFunc(down, func(a, b string) int {
+		return s.hosts[a].downUntil.Compare(s.hosts[b].downUntil)
+	})
+	return append(healthy, down...)
+}
+
+// probe dials addr and pings it, bringing the host back on success.
+func (s *HealthAwareDialStrategy) probe(addr string, opt *Options, dial Dial) {
+	ctx, cancel := context.WithTimeout(s.ctx, opt.DialTimeout)
+	defer cancel()
+
+	start := time.Now()
+	r, err := dial(ctx, addr, opt)
+	if err == nil {
+		if r.conn == nil {
+			err = errors.New("clickhouse: dial returned no connection")
+		} else {
+			err = r.conn.ping(ctx)
+			r.conn.close()
+		}
+	}
+
+	s.mu.Lock()
+	s.host(addr).probing = false
+	s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		// closed, which says nothing about the host
+		return
+	}
+	if err != nil && hostUnreachable(err) {
+		s.markDown(addr, err)
+		return
+	}
+	// a server exception still means the host is up
+	s.markUp(addr, time.Since(start))
+}
+
+// hostUnreachable reports whether a dial or probe error is a network failure
+// or a timeout, as opposed to an answer of the server. Unlike
+// IsRetryableError, it doesn't count the exceptions SOCKET_TIMEOUT and
+// NETWORK_ERROR, which a live server returns for its own connections.
+func hostUnreachable(err error) bool {
+	var (
+		exception *Exception
+		netErr    net.Error
+	)
+	switch {
+	case errors.As(err, &exception):
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE):
+		// the host refused or dropped the connection
+		return true
+	}
+	return errors.As(err, &netErr)
+}
+
+// host returns the state of addr, creating it. s.mu must be held.
+func (s *HealthAwareDialStrategy) host(addr string) *hostHealth {
+	h, ok := s.hosts[addr]
+	if !ok {
+		h = &hostHealth{}
+		s.hosts[addr] = h
+	}
+	return h
+}
+
+func (s *HealthAwareDialStrategy) markUp(addr string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.host(addr)
+	h.failures, h.downUntil, h.lastErr = 0, time.Time{}, nil
+	if h.latency == 0 {
+		h.latency = latency
+	} else {
+		h.latency = time.Duration(float64(h.latency)*(1-latencyWeight) + float64(latency)*latencyWeight)
+	}
+}
+
+func (s *HealthAwareDialStrategy) markDown(addr string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.host(addr)
+	h.failures++
+	h.lastErr = err
+	cooldown := s.opt.Cooldown
+	for i := 1; i < h.failures && cooldown < s.opt.MaxCooldown; i++ {
+		cooldown *= 2
+	}
+	h.downUntil = s.now().Add(min(cooldown, s.opt.MaxCooldown))
+}
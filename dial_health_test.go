@@ -0,0 +1,241 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHosts is a Dial that fails for the hosts marked down and records the
+// order hosts were dialed in.
+type fakeHosts struct {
+	mu     sync.Mutex
+	down   map[string]bool
+	errs   map[string]error
+	dialed []string
+}
+
+func (f *fakeHosts) dial(ctx context.Context, addr string, opt *Options) (DialResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dialed = append(f.dialed, addr)
+	if f.down[addr] {
+		return DialResult{}, syscall.ECONNREFUSED
+	}
+	if err := f.errs[addr]; err != nil {
+		return DialResult{}, err
+	}
+	return DialResult{conn: newMockTransport(len(f.dialed))}, nil
+}
+
+func (f *fakeHosts) setDown(addr string, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down[addr] = down
+}
+
+func (f *fakeHosts) takeDialed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dialed := f.dialed
+	f.dialed = nil
+	return dialed
+}
+
+func TestHealthAwareDialStrategySkipsDownHosts(t *testing.T) {
+	var (
+		now      = time.Now()
+		hosts    = &fakeHosts{down: map[string]bool{"a:9000": true}}
+		strategy = NewHealthAwareDialStrategy(HostHealthOptions{Cooldown: time.Second, MaxCooldown: 3 * time.Second, ProbeInterval: time.Hour})
+		opt      = (&Options{Addr: []string{"a:9000", "b:9000"}}).setDefaults()
+		ctx      = context.Background()
+	)
+	defer strategy.Close()
+	strategy.now = func() time.Time { return now }
+
+	_, err := strategy.Dial(ctx, 1, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:9000", "b:9000"}, hosts.takeDialed())
+
+	// a is in cooldown and no longer costs a dial
+	_, err = strategy.Dial(ctx, 2, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b:9000"}, hosts.takeDialed())
+
+	health := strategy.Hosts()
+	require.Len(t, health, 2)
+	assert.Equal(t, "a:9000", health[0].Addr)
+	assert.True(t, health[0].Down)
+	assert.Equal(t, 1, health[0].Failures)
+	assert.Equal(t, now.Add(time.Second), health[0].DownUntil)
+	assert.EqualError(t, health[0].LastError, "connection refused")
+	assert.False(t, health[1].Down)
+
+	// the cooldown expired: a is probed in the background and stays down
+	now = now.Add(time.Second)
+	_, err = strategy.Dial(ctx, 3, opt, hosts.dial)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return strategy.Hosts()[0].Failures == 2
+	}, time.Second, time.Millisecond)
+	assert.ElementsMatch(t, []string{"a:9000", "b:9000"}, hosts.takeDialed())
+	assert.Equal(t, now.Add(2*time.Second), strategy.Hosts()[0].DownUntil)
+
+	// the cooldown is capped by MaxCooldown
+	strategy.markDown("a:9000", errors.New("refused"))
+	assert.Equal(t, now.Add(3*time.Second), strategy.Hosts()[0].DownUntil)
+
+	// a recovers: the next probe brings it back
+	hosts.setDown("a:9000", false)
+	now = now.Add(3 * time.Second)
+	_, err = strategy.Dial(ctx, 4, opt, hosts.dial)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return !strategy.Hosts()[0].Down
+	}, time.Second, time.Millisecond)
+	hosts.takeDialed()
+
+	_, err = strategy.Dial(ctx, 5, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:9000"}, hosts.takeDialed())
+}
+
+func TestHealthAwareDialStrategyLastResort(t *testing.T) {
+	var (
+		hosts    = &fakeHosts{down: map[string]bool{"a:9000": true, "b:9000": true}}
+		strategy = NewHealthAwareDialStrategy(HostHealthOptions{Cooldown: time.Hour})
+		opt      = (&Options{Addr: []string{"a:9000", "b:9000"}}).setDefaults()
+		ctx      = context.Background()
+	)
+	defer strategy.Close()
+	_, err := strategy.Dial(ctx, 1, opt, hosts.dial)
+	require.Error(t, err)
+	hosts.takeDialed()
+
+	// every host is down, so they are all tried rather than failing outright
+	hosts.setDown("b:9000", false)
+	_, err = strategy.Dial(ctx, 2, opt, hosts.dial)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:9000", "b:9000"}, hosts.takeDialed())
+	assert.False(t, strategy.Hosts()[1].Down)
+}
+
+func TestHealthAwareDialStrategyCancelledDial(t *testing.T) {
+	var (
+		strategy    = NewHealthAwareDialStrategy(HostHealthOptions{})
+		opt         = (&Options{Addr: []string{"a:9000"}}).setDefaults()
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer strategy.Close()
+	_, err := strategy.Dial(ctx, 1, opt, func(ctx context.Context, addr string, opt *Options) (DialResult, error) {
+		cancel()
+		return DialResult{}, ctx.Err()
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, strategy.Hosts()[0].Failures)
+}
+
+func TestHealthAwareDialStrategyServerException(t *testing.T) {
+	var (
+		hosts = &fakeHosts{
+			down: map[string]bool{"b:9000": true},
+			errs: map[string]error{"a:9000": &Exception{Code: 516, Name: "AUTHENTICATION_FAILED"}},
+		}
+		strategy = NewHealthAwareDialStrategy(HostHealthOptions{Cooldown: time.Hour})
+		opt      = (&Options{Addr: []string{"a:9000", "b:9000"}}).setDefaults()
+	)
+	defer strategy.Close()
+	_, err := strategy.Dial(context.Background(), 1, opt, hosts.dial)
+	require.Error(t, err)
+	assert.Equal(t, []string{"a:9000", "b:9000"}, hosts.takeDialed())
+
+	// a answered, only b is unreachable
+	health := strategy.Hosts()
+	assert.False(t, health[0].Down)
+	assert.Zero(t, health[0].Failures)
+	assert.True(t, health[1].Down)
+	assert.ErrorIs(t, health[1].LastError, syscall.ECONNREFUSED)
+
+	assert.True(t, hostUnreachable(context.DeadlineExceeded))
+	assert.True(t, hostUnreachable(&net.DNSError{Err: "no such host", IsNotFound: true}))
+	assert.True(t, hostUnreachable(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}))
+	assert.True(t, hostUnreachable(io.EOF))
+	assert.False(t, hostUnreachable(&Exception{Code: 516}))
+	// the server answered, even if about a network error of its own
+	assert.False(t, hostUnreachable(&Exception{Code: 209, Name: "SOCKET_TIMEOUT"}))
+	assert.False(t, hostUnreachable(fmt.Errorf("ping: %w", &Exception{Code: 210, Name: "NETWORK_ERROR"})))
+}
+
+func TestHealthAwareDialStrategyProber(t *testing.T) {
+	var (
+		hosts    = &fakeHosts{down: map[string]bool{"a:9000": true}}
+		strategy = NewHealthAwareDialStrategy(HostHealthOptions{Cooldown: time.Millisecond, ProbeInterval: 5 * time.Millisecond})
+		opt      = (&Options{Addr: []string{"a:9000", "b:9000"}}).setDefaults()
+	)
+	_, err := strategy.Dial(context.Background(), 1, opt, hosts.dial)
+	require.NoError(t, err)
+	require.True(t, strategy.Hosts()[0].Down)
+
+	// a recovers and is brought back without any dial through the strategy
+	hosts.setDown("a:9000", false)
+	require.Eventually(t, func() bool {
+		return !strategy.Hosts()[0].Down
+	}, time.Second, time.Millisecond)
+
+	// once closed, down hosts are no longer probed
+	require.NoError(t, strategy.Close())
+	strategy.markDown("a:9000", syscall.ECONNREFUSED)
+	hosts.takeDialed()
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, hosts.takeDialed())
+	assert.True(t, strategy.Hosts()[0].Down)
+	require.NoError(t, strategy.Close())
+}
+
+func TestHealthAwareDialStrategyPreferLowLatency(t *testing.T) {
+	var (
+		strategy = NewHealthAwareDialStrategy(HostHealthOptions{PreferLowLatency: true})
+		opt      = (&Options{Addr: []string{"a:9000", "b:9000", "c:9000"}}).setDefaults()
+	)
+	defer strategy.Close()
+	strategy.markUp("a:9000", 30*time.Millisecond)
+	strategy.markUp("b:9000", 10*time.Millisecond)
+	strategy.markUp("c:9000", 20*time.Millisecond)
+	assert.Equal(t, []string{"b:9000", "c:9000", "a:9000"}, strategy.candidates(1, opt, nil))
+
+	// a single slow sample only moves the average
+	strategy.markUp("b:9000", 85*time.Millisecond)
+	assert.Equal(t, 25*time.Millisecond, strategy.Hosts()[1].Latency)
+	assert.Equal(t, []string{"c:9000", "b:9000", "a:9000"}, strategy.candidates(1, opt, nil))
+}
+
+func TestHealthAwareDialStrategyWithPool(t *testing.T) {
+	hosts := &fakeHosts{down: map[string]bool{"a:9000": true}}
+	strategy := NewHealthAwareDialStrategy(HostHealthOptions{Cooldown: time.Hour})
+	defer strategy.Close()
+	conn, err := Open(&Options{
+		Addr: []string{"a:9000", "b:9000"},
+		DialStrategy: func(ctx context.Context, connID int, opt *Options, dial Dial) (DialResult, error) {
+			return strategy.Dial(ctx, connID, opt, hosts.dial)
+		},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ch := conn.(*clickhouse)
+	for i := 0; i < 3; i++ {
+		transport, err := ch.acquire(context.Background())
+		require.NoError(t, err)
+		defer ch.release(transport, nil)
+	}
+	assert.Equal(t, []string{"a:9000", "b:9000", "b:9000", "b:9000"}, hosts.takeDialed())
+}
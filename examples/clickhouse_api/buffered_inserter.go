@@ -0,0 +1,68 @@
+package clickhouse_api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func BufferedInserter() error {
+	conn, err := GetNativeConnection(nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	defer func() {
+		conn.Exec(ctx, "DROP TABLE example")
+	}()
+	if err := conn.Exec(ctx, `DROP TABLE IF EXISTS example`); err != nil {
+		return err
+	}
+	if err := conn.Exec(ctx, `
+		CREATE TABLE example (
+			Col1 UInt64,
+			Col2 String
+		) engine=Memory
+	`); err != nil {
+		return err
+	}
+
+	inserter := clickhouse.NewBufferedInserter(conn, "INSERT INTO example", clickhouse.BufferedInserterOptions{
+		MaxRows:       1000,
+		FlushInterval: 100 * time.Millisecond,
+		OnError: func(err error, rows int) {
+			log.Printf("failed to insert %d rows: %v", rows, err)
+		},
+	})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2500; i++ {
+				if err := inserter.Append(uint64(i), fmt.Sprintf("worker-%d", w)); err != nil {
+					log.Print(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	// sends the remaining rows
+	if err := inserter.Close(); err != nil {
+		return err
+	}
+
+	var count uint64
+	if err := conn.QueryRow(ctx, `SELECT count() FROM example`).Scan(&count); err != nil {
+		return err
+	}
+	if count != 10_000 {
+		return fmt.Errorf("expected 10000 rows, got %d", count)
+	}
+	return nil
+}
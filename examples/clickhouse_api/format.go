@@ -114,7 +114,8 @@ func FormatJSONEachRow() error {
 // FormatParquet exports a query result to a .parquet file and imports a
 // .parquet file into a table - the two halves of a typical data-lake
 // exchange. The server produces and parses the Parquet bytes; the client
-// streams them. QueryFormat/InsertFormat require the HTTP protocol.
+// streams them. InsertFormat needs the HTTP protocol for Parquet, as do
+// Parquet results unless the charrow module is imported to encode them.
 func FormatParquet() error {
 	conn, err := GetHTTPConnection("format-parquet", nil, nil, nil)
 	if err != nil {
@@ -91,6 +91,10 @@ func TestBatchWithReleaseConnection(t *testing.T) {
 	require.NoError(t, BatchWithReleaseConnection())
 }
 
+func TestBufferedInserter(t *testing.T) {
+	require.NoError(t, BufferedInserter())
+}
+
 func TestAuthConnect(t *testing.T) {
 	require.NoError(t, Auth())
 }
@@ -197,6 +201,10 @@ func TestSelectStruct(t *testing.T) {
 	require.NoError(t, SelectStruct())
 }
 
+func TestQueryIter(t *testing.T) {
+	require.NoError(t, QueryIter())
+}
+
 func TestTypeConvert(t *testing.T) {
 	require.NoError(t, ConvertedInsert())
 }
@@ -0,0 +1,38 @@
+package clickhouse_api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func QueryIter() error {
+	conn, err := GetNativeConnection(nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	type result struct {
+		Number uint64 `ch:"number"`
+		Square uint64 `ch:"square"`
+	}
+
+	for row, err := range clickhouse.QueryIter[result](ctx, conn, "SELECT number, number * number AS square FROM system.numbers LIMIT 1000000") {
+		if err != nil {
+			return err
+		}
+		if row.Number%100000 == 0 {
+			fmt.Printf("row: number=%d, square=%d\n", row.Number, row.Square)
+		}
+	}
+
+	count, err := clickhouse.QueryOne[uint64](ctx, conn, "SELECT count() FROM numbers(10)")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("count: %d\n", count)
+
+	return nil
+}
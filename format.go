@@ -52,8 +52,10 @@ func hasTrailingFormatClause(query string) bool {
 // different encoding than asked for.
 //
 // Experimental: this API is experimental and may change or be removed in a
-// future minor release. It is currently only supported over the HTTP
-// protocol; over the native protocol it returns ErrFormatNativeUnsupported.
+// future minor release. Over the native protocol, row formats (CSV, TSV,
+// JSONEachRow, RowBinary, ...), their WithNames and WithNamesAndTypes
+// variants, the JSON formats, Native and the formats of RegisterFormatEncoder
+// are supported; other formats return ErrFormatNativeUnsupported.
 func (ch *clickhouse) QueryFormat(ctx context.Context, format string, query string, args ...any) (io.ReadCloser, error) {
 	if err := validateFormatName(format); err != nil {
 		return nil, err
@@ -63,8 +65,8 @@ func (ch *clickhouse) QueryFormat(ctx context.Context, format string, query stri
 	}
 	// Checked before acquiring: a saturated pool or failed dial must not mask
 	// the actionable "use HTTP" error behind ErrAcquireConnTimeout.
-	if ch.opt.Protocol != HTTP {
-		return nil, ErrFormatNativeUnsupported
+	if ch.opt.Protocol != HTTP && !nativeFormatSupported(format) {
+		return nil, fmt.Errorf("%w: format %s", ErrFormatNativeUnsupported, format)
 	}
 	conn, err := ch.acquire(ctx)
 	if err != nil {
@@ -79,14 +81,15 @@ func (ch *clickhouse) QueryFormat(ctx context.Context, format string, query stri
 // for the full contract.
 //
 // Experimental: this API is experimental and may change or be removed in a
-// future minor release. It is currently only supported over the HTTP
-// protocol; over the native protocol it returns ErrFormatNativeUnsupported.
+// future minor release. Over the native protocol only the Native format is
+// supported, whose blocks are sent as they are read; other formats return
+// ErrFormatNativeUnsupported.
 func (ch *clickhouse) InsertFormat(ctx context.Context, format string, query string, data io.Reader) error {
 	if err := validateFormatName(format); err != nil {
 		return err
 	}
-	if ch.opt.Protocol != HTTP {
-		return ErrFormatNativeUnsupported
+	if ch.opt.Protocol != HTTP && !strings.EqualFold(format, "Native") {
+		return fmt.Errorf("%w: format %s", ErrFormatNativeUnsupported, format)
 	}
 	// Validated before acquiring: a malformed statement is a caller mistake
 	// and must not consume a pooled connection.
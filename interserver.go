@@ -0,0 +1,27 @@
+package clickhouse
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+// interserverAuthMarker is sent in place of the username in the hello of
+// connections authenticating with a cluster secret, as clickhouse-server does
+// for distributed queries.
+const interserverAuthMarker = " INTERSERVER SECRET "
+
+// newInterserverSalt returns the salt of the query hashes of a connection.
+func newInterserverSalt() (string, error) {
+	salt := make([]byte, sha256.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return string(salt), nil
+}
+
+// interserverHash signs a query with the cluster secret, so the server trusts
+// the initial user it is run on behalf of.
+func interserverHash(salt, secret, query, queryID, initialUser string) string {
+	hash := sha256.Sum256([]byte(salt + secret + query + queryID + initialUser))
+	return string(hash[:])
+}
@@ -0,0 +1,63 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interserverHello is the hello read by the fake server of
+// fakeInterserverAuth, followed by the packets sent after it.
+type interserverHello struct {
+	user, password, cluster, salt string
+	packets                       []byte
+}
+
+// fakeInterserverAuth returns an Options.DialContext to a fake server sending
+// the hello it read to hellos once the connection is closed.
+func fakeInterserverAuth(hellos chan<- interserverHello) func(ctx context.Context, addr string) (net.Conn, error) {
+	return fakeNativeServer(func(c *fakeNativeConn) {
+		hello := interserverHello{user: c.user, password: c.password}
+		hello.cluster, _ = c.reader.Str()
+		hello.salt, _ = c.reader.Str()
+		c.accept()
+		hello.packets, _ = io.ReadAll(c.reader)
+		hellos <- hello
+	})
+}
+
+func TestClusterSecret(t *testing.T) {
+	hellos := make(chan interserverHello, 1)
+	opt := (&Options{
+		Auth: Auth{
+			Username:      "default",
+			Password:      "unused",
+			Cluster:       "cluster",
+			ClusterSecret: "secret",
+		},
+		DialContext: fakeInterserverAuth(hellos),
+	}).setDefaults()
+	conn, err := dial(context.Background(), "fake:9000", 1, opt)
+	require.NoError(t, err)
+	require.NoError(t, conn.sendQuery("SELECT 1", &QueryOptions{queryID: "query-id", initialUser: "alice"}))
+	require.NoError(t, conn.sendQuery("SELECT 2", &QueryOptions{}))
+	conn.close()
+
+	hello := <-hellos
+	assert.Equal(t, interserverAuthMarker, hello.user)
+	assert.Empty(t, hello.password)
+	assert.Equal(t, "cluster", hello.cluster)
+	assert.Len(t, hello.salt, 32)
+	// the queries are signed with the salt of the connection, on behalf of
+	// the initial user
+	assert.True(t, bytes.Contains(hello.packets, []byte(interserverHash(hello.salt, "secret", "SELECT 1", "query-id", "alice"))))
+	assert.True(t, bytes.Contains(hello.packets, []byte(interserverHash(hello.salt, "secret", "SELECT 2", "", "default"))))
+
+	_, err = dialHttp(context.Background(), "fake:8123", 1, (&Options{Protocol: HTTP, Auth: Auth{ClusterSecret: "secret"}}).setDefaults())
+	assert.ErrorIs(t, err, ErrClusterSecretNativeOnly)
+}
@@ -0,0 +1,642 @@
+package column
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/ch-go/proto"
+)
+
+// AggregateFunction is an AggregateFunction(func, args...) column. Rows are
+// the opaque serialized aggregate states, exchanged as []byte, so -State
+// columns can be copied between tables and servers unchanged.
+//
+// The Native format does not length-prefix aggregate states, so the driver
+// has to know the layout of a state to find where it ends. Only functions
+// with a known layout are supported: count, sum, avg, min, max, any, anyLast,
+// argMin, argMax, uniq, uniqExact and groupArray (optionally with the -If
+// combinator), where min, max, any, anyLast, argMin and argMax take numbers,
+// decimals, dates, times and strings only. The states of count, sum, avg and
+// uniqExact can additionally be scanned into numeric destinations to read the
+// finalized value.
+type AggregateFunction struct {
+	chType   Type
+	name     string
+	function string
+	args     []Type
+	state    aggregateState
+	value    func(state []byte) (any, error)
+	buf      []byte
+	offsets  []int
+}
+
+func (col *AggregateFunction) Reset() {
+	col.buf = col.buf[:0]
+	col.offsets = col.offsets[:0]
+}
+
+func (col *AggregateFunction) Name() string {
+	return col.name
+}
+
+// Function returns the aggregate function name without parameters and
+// combinators, e.g. "uniq" for AggregateFunction(uniqIf, String, UInt8).
+func (col *AggregateFunction) Function() string {
+	return col.function
+}
+
+func (col *AggregateFunction) parse(t Type) (_ Interface, err error) {
+	col.chType = t
+	params := splitWithDelimiters(t.params())
+	for i := range params {
+		params[i] = strings.TrimSpace(params[i])
+	}
+	if len(params) != 0 {
+		// versioned states, e.g. AggregateFunction(1, sumMap, ...)
+		if _, err := strconv.ParseUint(params[0], 10, 64); err == nil {
+			params = params[1:]
+		}
+	}
+	if len(params) == 0 {
+		return nil, &UnsupportedColumnTypeError{t: t}
+	}
+	function := params[0]
+	if i := strings.Index(function, "("); i > 0 {
+		function = function[:i]
+	}
+	args := make([]Type, 0, len(params)-1)
+	for _, p := range params[1:] {
+		args = append(args, Type(p))
+	}
+	if base, ok := strings.CutSuffix(function, "If"); ok && len(args) != 0 {
+		// the -If combinator adds a trailing UInt8 condition, the state is the nested one
+		function, args = base, args[:len(args)-1]
+	}
+	col.function, col.args = function, args
+	if col.state, col.value = aggregateStateLayout(function, args); col.state == nil {
+		return nil, &UnsupportedColumnTypeError{t: t}
+	}
+	return col, nil
+}
+
+func (col *AggregateFunction) Type() Type {
+	return col.chType
+}
+
+func (col *AggregateFunction) ScanType() reflect.Type {
+	return scanTypeByte
+}
+
+func (col *AggregateFunction) Rows() int {
+	return len(col.offsets)
+}
+
+func (col *AggregateFunction) rowBytes(i int) []byte {
+	start := 0
+	if i > 0 {
+		start = col.offsets[i-1]
+	}
+	return col.buf[start:col.offsets[i]]
+}
+
+func (col *AggregateFunction) Row(i int, ptr bool) any {
+	value := bytes.Clone(col.rowBytes(i))
+	if ptr {
+		return &value
+	}
+	return value
+}
+
+func (col *AggregateFunction) ScanRow(dest any, row int) error {
+	state := col.rowBytes(row)
+	switch d := dest.(type) {
+	case *[]byte:
+		*d = bytes.Clone(state)
+		return nil
+	case *any:
+		*d = bytes.Clone(state)
+		return nil
+	case sql.Scanner:
+		return d.Scan(bytes.Clone(state))
+	case *uint64, *int64, *float64:
+		if col.value == nil {
+			break
+		}
+		v, err := col.value(state)
+		if err != nil {
+			return &Error{ColumnType: string(col.chType), Err: err}
+		}
+		return scanAggregateValue(d, v)
+	}
+	return &ColumnConverterError{
+		Op:   "ScanRow",
+		To:   fmt.Sprintf("%T", dest),
+		From: string(col.chType),
+	}
+}
+
+func scanAggregateValue(dest any, v any) error {
+	switch d := dest.(type) {
+	case *uint64:
+		switch v := v.(type) {
+		case uint64:
+			*d = v
+			return nil
+		case int64:
+			if v >= 0 {
+				*d = uint64(v)
+				return nil
+			}
+		}
+	case *int64:
+		switch v := v.(type) {
+		case int64:
+			*d = v
+			return nil
+		case uint64:
+			if v <= math.MaxInt64 {
+				*d = int64(v)
+				return nil
+			}
+		}
+	case *float64:
+		switch v := v.(type) {
+		case float64:
+			*d = v
+		case int64:
+			*d = float64(v)
+		case uint64:
+			*d = float64(v)
+		}
+		return nil
+	}
+	return &ColumnConverterError{
+		Op:   "ScanRow",
+		To:   fmt.Sprintf("%T", dest),
+		From: fmt.Sprintf("%T", v),
+	}
+}
+
+func (col *AggregateFunction) Append(v any) (nulls []uint8, err error) {
+	switch v := v.(type) {
+	case [][]byte:
+		for _, state := range v {
+			if err := col.appendState(state); err != nil {
+				return nil, err
+			}
+		}
+		return make([]uint8, len(v)), nil
+	case []string:
+		for _, state := range v {
+			if err := col.appendState([]byte(state)); err != nil {
+				return nil, err
+			}
+		}
+		return make([]uint8, len(v)), nil
+	default:
+		return nil, &ColumnConverterError{
+			Op:   "Append",
+			To:   string(col.chType),
+			From: fmt.Sprintf("%T", v),
+		}
+	}
+}
+
+func (col *AggregateFunction) AppendRow(v any) error {
+	switch v := v.(type) {
+	case []byte:
+		return col.appendState(v)
+	case *[]byte:
+		return col.appendState(*v)
+	case string:
+		return col.appendState([]byte(v))
+	default:
+		return &ColumnConverterError{
+			Op:   "AppendRow",
+			To:   string(col.chType),
+			From: fmt.Sprintf("%T", v),
+		}
+	}
+}
+
+// appendState validates that state holds exactly one serialized state of
+// the column's function before appending it, since a malformed state would
+// shift every following row of the encoded column.
+func (col *AggregateFunction) appendState(state []byte) error {
+	reader := proto.NewReader(bytes.NewReader(state))
+	parsed, err := col.state.read(reader, nil)
+	if err != nil {
+		return &Error{ColumnType: string(col.chType), Err: fmt.Errorf("invalid aggregate state: %w", err)}
+	}
+	if len(parsed) != len(state) {
+		return &Error{ColumnType: string(col.chType), Err: fmt.Errorf("invalid aggregate state: %d trailing bytes", len(state)-len(parsed))}
+	}
+	col.buf = append(col.buf, state...)
+	col.offsets = append(col.offsets, len(col.buf))
+	return nil
+}
+
+func (col *AggregateFunction) Decode(reader *proto.Reader, rows int) (err error) {
+	for i := 0; i < rows; i++ {
+		if col.buf, err = col.state.read(reader, col.buf); err != nil {
+			return fmt.Errorf("read aggregate state of row %d: %w", i, err)
+		}
+		col.offsets = append(col.offsets, len(col.buf))
+	}
+	return nil
+}
+
+func (col *AggregateFunction) Encode(buffer *proto.Buffer) {
+	buffer.PutRaw(col.buf)
+}
+
+var _ Interface = (*AggregateFunction)(nil)
+
+// aggregateState describes the binary layout of a serialized aggregate
+// state. read consumes one state from reader and appends its raw bytes to dst.
+type aggregateState interface {
+	read(reader *proto.Reader, dst []byte) ([]byte, error)
+}
+
+type (
+	// aggStateFixed is a fixed width value.
+	aggStateFixed int
+	// aggStateVarUInt is a LEB128 encoded VarUInt.
+	aggStateVarUInt struct{}
+	// aggStateOptional is a bool flag followed by the value when the flag is set.
+	aggStateOptional struct{ value aggregateState }
+	// aggStateSingleString is the Int32 size followed by size bytes of a min/max/any String.
+	aggStateSingleString struct{}
+	// aggStateString is a VarUInt length followed by the bytes.
+	aggStateString struct{}
+	// aggStateRepeated is a VarUInt count followed by count elements.
+	aggStateRepeated struct{ elem aggregateState }
+	// aggStateSequence is its parts one after another.
+	aggStateSequence []aggregateState
+)
+
+func (s aggStateFixed) read(reader *proto.Reader, dst []byte) ([]byte, error) {
+	n := int(s)
+	dst = slices.Grow(dst, n)
+	if err := reader.ReadFull(dst[len(dst) : len(dst)+n]); err != nil {
+		return nil, err
+	}
+	return dst[:len(dst)+n], nil
+}
+
+func (aggStateVarUInt) read(reader *proto.Reader, dst []byte) ([]byte, error) {
+	v, err := reader.UVarInt()
+	if err != nil {
+		return nil, err
+	}
+	return binary.AppendUvarint(dst, v), nil
+}
+
+func (s aggStateOptional) read(reader *proto.Reader, dst []byte) ([]byte, error) {
+	flag, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if dst = append(dst, flag); flag == 0 {
+		return dst, nil
+	}
+	return s.value.read(reader, dst)
+}
+
+func (aggStateSingleString) read(reader *proto.Reader, dst []byte) ([]byte, error) {
+	size, err := reader.Int32()
+	if err != nil {
+		return nil, err
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(size))
+	if size <= 0 {
+		return dst, nil
+	}
+	return aggStateFixed(size).read(reader, dst)
+}
+
+func (aggStateString) read(reader *proto.Reader, dst []byte) ([]byte, error) {
+	n, err := reader.UVarInt()
+	if err != nil {
+		return nil, err
+	}
+	dst = binary.AppendUvarint(dst, n)
+	return aggStateFixed(n).read(reader, dst)
+}
+
+func (s aggStateRepeated) read(reader *proto.Reader, dst []byte) ([]byte, error) {
+	n, err := reader.UVarInt()
+	if err != nil {
+		return nil, err
+	}
+	dst = binary.AppendUvarint(dst, n)
+	if fixed, ok := s.elem.(aggStateFixed); ok {
+		return aggStateFixed(int(n)*int(fixed)).read(reader, dst)
+	}
+	for i := uint64(0); i < n; i++ {
+		if dst, err = s.elem.read(reader, dst); err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+func (s aggStateSequence) read(reader *proto.Reader, dst []byte) (_ []byte, err error) {
+	for _, part := range s {
+		if dst, err = part.read(reader, dst); err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// aggregateStateLayout returns the state layout of function over args and,
+// for functions whose finalized value can be computed client-side, a decoder
+// for it. A nil layout means the function is not supported.
+func aggregateStateLayout(function string, args []Type) (aggregateState, func([]byte) (any, error)) {
+	var nullable bool
+	// the arguments are unwrapped in a copy, the column keeps their types
+	args = slices.Clone(args)
+	for i, arg := range args {
+		args[i] = Type(strings.TrimSpace(string(arg)))
+		if inner, ok := unwrapType(args[i], "LowCardinality"); ok {
+			args[i] = inner
+		}
+		if inner, ok := unwrapType(args[i], "Nullable"); ok {
+			args[i], nullable = inner, true
+		}
+	}
+	// Functions with a Nullable result prefix their state with a flag.
+	withNullFlag := func(state aggregateState, value func([]byte) (any, error)) (aggregateState, func([]byte) (any, error)) {
+		if !nullable {
+			return state, value
+		}
+		if value != nil {
+			inner := value
+			value = func(state []byte) (any, error) {
+				if len(state) == 0 || state[0] == 0 {
+					return nil, errors.New("aggregate state holds NULL")
+				}
+				return inner(state[1:])
+			}
+		}
+		return aggStateOptional{value: state}, value
+	}
+
+	switch function {
+	case "count":
+		return aggStateVarUInt{}, decodeCountState
+	case "uniqExact":
+		if len(args) != 1 {
+			// multiple arguments are hashed to UInt128
+			return aggStateRepeated{elem: aggStateFixed(16)}, decodeCountState
+		}
+		size, ok := fixedTypeSize(args[0])
+		if !ok {
+			// String and other variable width keys are hashed to UInt128
+			size = 16
+		}
+		return aggStateRepeated{elem: aggStateFixed(size)}, decodeCountState
+	case "uniq":
+		// skip_degree followed by the UInt32 hashes
+		return aggStateSequence{aggStateFixed(1), aggStateRepeated{elem: aggStateFixed(4)}}, nil
+	case "groupArray":
+		if len(args) != 1 {
+			return nil, nil
+		}
+		if size, ok := fixedTypeSize(args[0]); ok {
+			return aggStateRepeated{elem: aggStateFixed(size)}, nil
+		}
+		return aggStateRepeated{elem: aggStateString{}}, nil
+	case "sum":
+		if len(args) != 1 {
+			return nil, nil
+		}
+		kind, size, ok := sumStateType(args[0])
+		if !ok {
+			return nil, nil
+		}
+		return withNullFlag(aggStateFixed(size), decodeNumberState(kind, size))
+	case "avg":
+		if len(args) != 1 {
+			return nil, nil
+		}
+		kind, size, ok := sumStateType(args[0])
+		if !ok {
+			return nil, nil
+		}
+		if kind != aggNumberDecimal && size > 8 {
+			// the server sums wide integers as a Float64 for avg
+			kind, size = aggNumberFloat, 8
+		}
+		return withNullFlag(aggStateSequence{aggStateFixed(size), aggStateVarUInt{}}, decodeAvgState(kind, size))
+	case "min", "max", "any", "anyLast":
+		if len(args) != 1 {
+			return nil, nil
+		}
+		value := singleValueState(args[0])
+		if value == nil {
+			return nil, nil
+		}
+		return withNullFlag(value, nil)
+	case "argMin", "argMax":
+		if len(args) != 2 {
+			return nil, nil
+		}
+		result, value := singleValueState(args[0]), singleValueState(args[1])
+		if result == nil || value == nil {
+			return nil, nil
+		}
+		return withNullFlag(aggStateSequence{result, value}, nil)
+	}
+	return nil, nil
+}
+
+func unwrapType(t Type, wrapper string) (Type, bool) {
+	if strings.HasPrefix(string(t), wrapper+"(") {
+		return Type(t.params()), true
+	}
+	return t, false
+}
+
+// singleValueState returns the state of a min, max, any or anyLast value of
+// type t: a flag and the value for numbers, decimals, dates and times, or a
+// String. It returns nil for the other types, such as Array, Map, Tuple or
+// FixedString, whose values the server serializes as a generic Field.
+func singleValueState(t Type) aggregateState {
+	switch _, _, numeric := sumStateType(t); {
+	case t == "String":
+		return aggStateSingleString{}
+	case numeric, t == "Bool", isDateTimeType(t):
+		size, _ := fixedTypeSize(t)
+		return aggStateOptional{value: aggStateFixed(size)}
+	}
+	return nil
+}
+
+// isDateTimeType reports whether t is Date, DateTime or DateTime64.
+func isDateTimeType(t Type) bool {
+	s := string(t)
+	return s == "Date" || s == "DateTime" || strings.HasPrefix(s, "DateTime(") || strings.HasPrefix(s, "DateTime64")
+}
+
+// fixedTypeSize returns the in-memory width of a fixed width type.
+func fixedTypeSize(t Type) (int, bool) {
+	switch s := string(t); s {
+	case "Int8", "UInt8", "Bool", "Enum8":
+		return 1, true
+	case "Int16", "UInt16", "Date", "BFloat16":
+		return 2, true
+	case "Int32", "UInt32", "Float32", "Date32", "DateTime", "IPv4":
+		return 4, true
+	case "Int64", "UInt64", "Float64":
+		return 8, true
+	case "Int128", "UInt128", "UUID", "IPv6":
+		return 16, true
+	case "Int256", "UInt256":
+		return 32, true
+	default:
+		switch {
+		case strings.HasPrefix(s, "Enum8("):
+			return 1, true
+		case strings.HasPrefix(s, "Enum16("):
+			return 2, true
+		case strings.HasPrefix(s, "DateTime64"):
+			return 8, true
+		case strings.HasPrefix(s, "DateTime("):
+			return 4, true
+		case strings.HasPrefix(s, "Decimal32"):
+			return 4, true
+		case strings.HasPrefix(s, "Decimal64"):
+			return 8, true
+		case strings.HasPrefix(s, "Decimal128"):
+			return 16, true
+		case strings.HasPrefix(s, "Decimal256"):
+			return 32, true
+		case strings.HasPrefix(s, "Decimal("):
+			return decimalTypeSize(t), true
+		case strings.HasPrefix(s, "FixedString("):
+			size, err := strconv.Atoi(t.params())
+			return size, err == nil
+		}
+	}
+	return 0, false
+}
+
+func decimalTypeSize(t Type) int {
+	precision, _ := strconv.Atoi(strings.TrimSpace(strings.Split(t.params(), ",")[0]))
+	switch {
+	case precision <= 9:
+		return 4
+	case precision <= 18:
+		return 8
+	case precision <= 38:
+		return 16
+	default:
+		return 32
+	}
+}
+
+type aggNumberKind int
+
+const (
+	aggNumberSigned aggNumberKind = iota
+	aggNumberUnsigned
+	aggNumberFloat
+	aggNumberDecimal
+)
+
+// sumStateType returns the accumulator of sum and avg over t: 64 bit
+// integers and floats are widened to their 64 bit type, wide integers keep
+// their width and decimals accumulate in Decimal128 or Decimal256.
+func sumStateType(t Type) (aggNumberKind, int, bool) {
+	switch s := string(t); s {
+	case "Int8", "Int16", "Int32", "Int64":
+		return aggNumberSigned, 8, true
+	case "UInt8", "UInt16", "UInt32", "UInt64":
+		return aggNumberUnsigned, 8, true
+	case "Float32", "Float64", "BFloat16":
+		return aggNumberFloat, 8, true
+	case "Int128":
+		return aggNumberSigned, 16, true
+	case "UInt128":
+		return aggNumberUnsigned, 16, true
+	case "Int256":
+		return aggNumberSigned, 32, true
+	case "UInt256":
+		return aggNumberUnsigned, 32, true
+	default:
+		if strings.HasPrefix(s, "Decimal") {
+			if size, ok := fixedTypeSize(t); ok && size == 32 {
+				return aggNumberDecimal, 32, true
+			}
+			return aggNumberDecimal, 16, true
+		}
+	}
+	return 0, 0, false
+}
+
+func decodeCountState(state []byte) (any, error) {
+	v, n := binary.Uvarint(state)
+	if n <= 0 {
+		return nil, errors.New("invalid VarUInt in aggregate state")
+	}
+	return v, nil
+}
+
+func decodeNumberState(kind aggNumberKind, size int) func([]byte) (any, error) {
+	if size != 8 || kind == aggNumberDecimal {
+		// wide integers and decimals are only exchanged as opaque states
+		return nil
+	}
+	return func(state []byte) (any, error) {
+		if len(state) < 8 {
+			return nil, errors.New("truncated aggregate state")
+		}
+		v := binary.LittleEndian.Uint64(state)
+		switch kind {
+		case aggNumberSigned:
+			return int64(v), nil
+		case aggNumberUnsigned:
+			return v, nil
+		default:
+			return math.Float64frombits(v), nil
+		}
+	}
+}
+
+func decodeAvgState(kind aggNumberKind, size int) func([]byte) (any, error) {
+	numerator := decodeNumberState(kind, size)
+	if numerator == nil {
+		return nil
+	}
+	return func(state []byte) (any, error) {
+		num, err := numerator(state)
+		if err != nil {
+			return nil, err
+		}
+		den, err := decodeCountState(state[size:])
+		if err != nil {
+			return nil, err
+		}
+		var sum float64
+		switch num := num.(type) {
+		case int64:
+			sum = float64(num)
+		case uint64:
+			sum = float64(num)
+		case float64:
+			sum = num
+		}
+		// 0/0 is NaN, which is also what the server returns for an empty avg
+		return sum / float64(den.(uint64)), nil
+	}
+}
@@ -0,0 +1,154 @@
+package column
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/ClickHouse/ch-go/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateFunctionParse(t *testing.T) {
+	tests := []struct {
+		chType   Type
+		function string
+	}{
+		{"AggregateFunction(count)", "count"},
+		{"AggregateFunction(sum, UInt64)", "sum"},
+		{"AggregateFunction(avg, Nullable(Float64))", "avg"},
+		{"AggregateFunction(uniqExact, LowCardinality(String))", "uniqExact"},
+		{"AggregateFunction(uniqIf, String, UInt8)", "uniq"},
+		{"AggregateFunction(1, argMax, String, DateTime)", "argMax"},
+		{"AggregateFunction(groupArray(10), Decimal(18, 4))", "groupArray"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.chType), func(t *testing.T) {
+			col, err := Type(tt.chType).Column("agg", nil)
+			require.NoError(t, err)
+			agg, ok := col.(*AggregateFunction)
+			require.True(t, ok)
+			assert.Equal(t, tt.function, agg.Function())
+			assert.Equal(t, tt.chType, agg.Type())
+		})
+	}
+
+	for _, chType := range []Type{
+		"AggregateFunction(quantiles(0.5), Float64)", "AggregateFunction(sum, String)", "AggregateFunction()",
+		// generic Field states
+		"AggregateFunction(max, Array(UInt8))", "AggregateFunction(any, Map(String, UInt64))",
+		"AggregateFunction(min, Tuple(UInt8, String))", "AggregateFunction(anyLast, FixedString(4))",
+		"AggregateFunction(argMax, String, Nullable(Array(String)))",
+	} {
+		_, err := chType.Column("agg", nil)
+		var unsupported *UnsupportedColumnTypeError
+		assert.ErrorAs(t, err, &unsupported, chType)
+	}
+
+	// the column keeps the wrappers of its arguments
+	col, err := Type("AggregateFunction(argMin, LowCardinality(String), Nullable(DateTime))").Column("agg", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Type{"LowCardinality(String)", "Nullable(DateTime)"}, col.(*AggregateFunction).args)
+}
+
+func aggregateStates(states ...[]byte) [][]byte {
+	return states
+}
+
+func TestAggregateFunctionRoundTrip(t *testing.T) {
+	uvarint := func(v uint64) []byte { return binary.AppendUvarint(nil, v) }
+	tests := []struct {
+		chType Type
+		states [][]byte
+	}{
+		{"AggregateFunction(count)", aggregateStates(uvarint(0), uvarint(300))},
+		{"AggregateFunction(sum, Int32)", aggregateStates(binary.LittleEndian.AppendUint64(nil, 42))},
+		{"AggregateFunction(sum, Nullable(Int32))", aggregateStates([]byte{0}, append([]byte{1}, binary.LittleEndian.AppendUint64(nil, 7)...))},
+		{"AggregateFunction(avg, UInt8)", aggregateStates(append(binary.LittleEndian.AppendUint64(nil, 10), uvarint(4)...))},
+		// SELECT hex(avgState(toInt256(number))) FROM numbers(3), a Float64 sum and the count
+		{"AggregateFunction(avg, Int256)", aggregateStates([]byte{0, 0, 0, 0, 0, 0, 0x08, 0x40, 0x03}, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0})},
+		{"AggregateFunction(uniqExact, UInt32)", aggregateStates(append(uvarint(2), 1, 0, 0, 0, 2, 0, 0, 0))},
+		{"AggregateFunction(uniq, String)", aggregateStates(append([]byte{0}, append(uvarint(1), 9, 9, 9, 9)...))},
+		{"AggregateFunction(max, String)", aggregateStates([]byte{0xff, 0xff, 0xff, 0xff}, []byte{3, 0, 0, 0, 'a', 'b', 0})},
+		{"AggregateFunction(min, Int16)", aggregateStates([]byte{0}, []byte{1, 5, 0})},
+		{"AggregateFunction(argMax, String, DateTime)", aggregateStates([]byte{2, 0, 0, 0, 'a', 0, 1, 1, 2, 3, 4})},
+		{"AggregateFunction(groupArray, String)", aggregateStates(append(uvarint(2), 1, 'a', 2, 'b', 'c'))},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.chType), func(t *testing.T) {
+			col, err := tt.chType.Column("agg", nil)
+			require.NoError(t, err)
+			_, err = col.Append(tt.states)
+			require.NoError(t, err)
+			require.Equal(t, len(tt.states), col.Rows())
+
+			var buffer proto.Buffer
+			col.Encode(&buffer)
+			assert.Equal(t, bytes.Join(tt.states, nil), buffer.Buf)
+
+			decoded, err := tt.chType.Column("agg", nil)
+			require.NoError(t, err)
+			require.NoError(t, decoded.Decode(proto.NewReader(bytes.NewReader(buffer.Buf)), len(tt.states)))
+			for i, state := range tt.states {
+				assert.Equal(t, state, decoded.Row(i, false))
+				var scanned []byte
+				require.NoError(t, decoded.ScanRow(&scanned, i))
+				assert.Equal(t, state, scanned)
+			}
+		})
+	}
+}
+
+func TestAggregateFunctionAppendInvalidState(t *testing.T) {
+	col, err := Type("AggregateFunction(sum, UInt64)").Column("agg", nil)
+	require.NoError(t, err)
+	assert.Error(t, col.AppendRow([]byte{1, 2, 3}))
+	assert.Error(t, col.AppendRow(make([]byte, 9)))
+	assert.Error(t, col.AppendRow(42))
+	assert.Equal(t, 0, col.Rows())
+}
+
+func TestAggregateFunctionScanValue(t *testing.T) {
+	scan := func(chType Type, state []byte, dest any) error {
+		col, err := chType.Column("agg", nil)
+		require.NoError(t, err)
+		require.NoError(t, col.AppendRow(state))
+		return col.ScanRow(dest, 0)
+	}
+
+	var count uint64
+	require.NoError(t, scan("AggregateFunction(count)", binary.AppendUvarint(nil, 300), &count))
+	assert.Equal(t, uint64(300), count)
+
+	var cardinality int64
+	require.NoError(t, scan("AggregateFunction(uniqExact, String)", append(binary.AppendUvarint(nil, 1), make([]byte, 16)...), &cardinality))
+	assert.Equal(t, int64(1), cardinality)
+
+	var sum int64
+	minusTwo := int64(-2)
+	require.NoError(t, scan("AggregateFunction(sum, Int8)", binary.LittleEndian.AppendUint64(nil, uint64(minusTwo)), &sum))
+	assert.Equal(t, int64(-2), sum)
+
+	var fsum float64
+	require.NoError(t, scan("AggregateFunction(sum, Float32)", binary.LittleEndian.AppendUint64(nil, math.Float64bits(1.5)), &fsum))
+	assert.Equal(t, 1.5, fsum)
+
+	var avg float64
+	require.NoError(t, scan("AggregateFunction(avg, UInt64)", append(binary.LittleEndian.AppendUint64(nil, 10), 4), &avg))
+	assert.Equal(t, 2.5, avg)
+
+	require.NoError(t, scan("AggregateFunction(avg, Nullable(Int64))", append(append([]byte{1}, binary.LittleEndian.AppendUint64(nil, 9)...), 3), &avg))
+	assert.Equal(t, 3.0, avg)
+	assert.Error(t, scan("AggregateFunction(avg, Nullable(Int64))", []byte{0}, &avg))
+
+	// SELECT hex(avgState(toUInt128(number + 1))) FROM numbers(3)
+	require.NoError(t, scan("AggregateFunction(avg, UInt128)", []byte{0, 0, 0, 0, 0, 0, 0x18, 0x40, 0x03}, &avg))
+	assert.Equal(t, 2.0, avg)
+
+	// negative sums don't fit unsigned destinations
+	assert.Error(t, scan("AggregateFunction(sum, Int8)", binary.LittleEndian.AppendUint64(nil, uint64(minusTwo)), &count))
+	// opaque-only functions can't be finalized client-side
+	assert.Error(t, scan("AggregateFunction(min, UInt8)", []byte{1, 5}, &count))
+}
@@ -161,6 +161,8 @@ func (t Type) Column(name string, sc *ServerContext) (Interface, error) {
 		return (&LowCardinality{name: name}).parse(t, sc)
 	case strings.HasPrefix(string(t), "SimpleAggregateFunction"):
 		return (&SimpleAggregateFunction{name: name}).parse(t, sc)
+	case strings.HasPrefix(string(t), "AggregateFunction"):
+		return (&AggregateFunction{name: name}).parse(t)
 	case strings.HasPrefix(string(t), "Enum8") || strings.HasPrefix(string(t), "Enum16"):
 		return Enum(t, name)
 	case strings.HasPrefix(string(t), "DateTime64"):
@@ -240,6 +242,14 @@ func (col *{{ .ChType }}) Rows() int {
 func (col *{{ .ChType }}) Reset() {
     col.col.Reset()
 }
+{{- if ne .ChType "BFloat16" }}
+
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *{{ .ChType }}) Data() []{{ .GoType }} {
+	return col.col
+}
+{{- end }}
 
 func (col *{{ .ChType }}) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
@@ -178,6 +178,8 @@ func (t Type) Column(name string, sc *ServerContext) (Interface, error) {
 		return (&LowCardinality{name: name}).parse(t, sc)
 	case strings.HasPrefix(string(t), "SimpleAggregateFunction"):
 		return (&SimpleAggregateFunction{name: name}).parse(t, sc)
+	case strings.HasPrefix(string(t), "AggregateFunction"):
+		return (&AggregateFunction{name: name}).parse(t)
 	case strings.HasPrefix(string(t), "Enum8") || strings.HasPrefix(string(t), "Enum16"):
 		return Enum(t, name)
 	case strings.HasPrefix(string(t), "DateTime64"):
@@ -451,6 +453,12 @@ func (col *Float32) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *Float32) Data() []float32 {
+	return col.col
+}
+
 func (col *Float32) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -592,6 +600,12 @@ func (col *Float64) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *Float64) Data() []float64 {
+	return col.col
+}
+
 func (col *Float64) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -762,6 +776,12 @@ func (col *Int8) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *Int8) Data() []int8 {
+	return col.col
+}
+
 func (col *Int8) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -942,6 +962,12 @@ func (col *Int16) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *Int16) Data() []int16 {
+	return col.col
+}
+
 func (col *Int16) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -1112,6 +1138,12 @@ func (col *Int32) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *Int32) Data() []int32 {
+	return col.col
+}
+
 func (col *Int32) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -1282,6 +1314,12 @@ func (col *Int64) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *Int64) Data() []int64 {
+	return col.col
+}
+
 func (col *Int64) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -1458,6 +1496,12 @@ func (col *UInt8) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *UInt8) Data() []uint8 {
+	return col.col
+}
+
 func (col *UInt8) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -1612,6 +1656,12 @@ func (col *UInt16) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *UInt16) Data() []uint16 {
+	return col.col
+}
+
 func (col *UInt16) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -1753,6 +1803,12 @@ func (col *UInt32) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *UInt32) Data() []uint32 {
+	return col.col
+}
+
 func (col *UInt32) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
@@ -1894,6 +1950,12 @@ func (col *UInt64) Reset() {
 	col.col.Reset()
 }
 
+// Data returns the values of the column. The slice shares memory with the
+// column and is only valid until the column is reset or appended to.
+func (col *UInt64) Data() []uint64 {
+	return col.col
+}
+
 func (col *UInt64) ScanRow(dest any, row int) error {
 	value := col.col.Row(row)
 	switch d := dest.(type) {
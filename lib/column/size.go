@@ -0,0 +1,119 @@
+package column
+
+import "math"
+
+// EncodedSize returns the approximate number of bytes the rows of col take
+// when encoded in a block. It is computed from the lengths of the buffers of
+// the column, which grow with each appended value, so it costs the same
+// whatever the number of rows. Columns of types from outside this package
+// are counted as 8 bytes a row rather than encoded to be measured.
+func EncodedSize(col Interface) int {
+	rows := col.Rows()
+	switch col := col.(type) {
+	case *Int8, *UInt8, *Bool, *Enum8, *Nothing:
+		return rows
+	case *Int16, *UInt16, *BFloat16, *Enum16, *Date:
+		return 2 * rows
+	case *Int32, *UInt32, *Float32, *Date32, *DateTime, *Time, *IPv4:
+		return 4 * rows
+	case *Int64, *UInt64, *Float64, *DateTime64, *Time64, *Interval:
+		return 8 * rows
+	case *UUID, *IPv6, *Point:
+		return 16 * rows
+	case *Decimal:
+		switch {
+		case col.precision <= 9:
+			return 4 * rows
+		case col.precision <= 18:
+			return 8 * rows
+		case col.precision <= 38:
+			return 16 * rows
+		default:
+			return 32 * rows
+		}
+	case *BigInt:
+		return col.size * rows
+	case *QBit:
+		bits := 64
+		switch col.elementType {
+		case "BFloat16":
+			bits = 16
+		case "Float32":
+			bits = 32
+		}
+		return bits * ((col.dimension + 7) / 8) * rows
+	case *String:
+		// the length of each value is a varint, most often of one byte
+		return len(col.col.Buf) + rows
+	case *FixedString:
+		return len(col.col.Buf)
+	case *AggregateFunction:
+		return len(col.buf)
+	case *Nullable:
+		return rows + EncodedSize(col.base)
+	case *Array:
+		size := EncodedSize(col.values)
+		for _, offsets := range col.offsets {
+			size += 8 * offsets.values.Rows()
+		}
+		return size
+	case *Map:
+		return 8*rows + EncodedSize(col.keys) + EncodedSize(col.values)
+	case *Tuple:
+		size := 0
+		for _, c := range col.columns {
+			size += EncodedSize(c)
+		}
+		return size
+	case *LowCardinality:
+		size := EncodedSize(col.index) + EncodedSize(col.keys())
+		switch n := len(col.append.index); {
+		case n < math.MaxUint8:
+			return size + len(col.append.keys)
+		case n < math.MaxUint16:
+			return size + 2*len(col.append.keys)
+		case n < math.MaxUint32:
+			return size + 4*len(col.append.keys)
+		default:
+			return size + 8*len(col.append.keys)
+		}
+	case *Variant:
+		size := len(col.discriminators)
+		for _, c := range col.columns {
+			size += EncodedSize(c)
+		}
+		return size
+	case *Dynamic:
+		size := len(col.discriminators)
+		for _, c := range col.columns {
+			size += EncodedSize(c)
+		}
+		return size
+	case *SharedVariant:
+		return EncodedSize(&col.stringData)
+	case *JSON:
+		size := EncodedSize(&col.jsonStrings) + col.pendingNullRows
+		for _, c := range col.typedColumns {
+			size += EncodedSize(c)
+		}
+		for _, c := range col.dynamicColumns {
+			size += EncodedSize(c)
+		}
+		return size
+	case *Nested:
+		return EncodedSize(col.Interface)
+	case *SimpleAggregateFunction:
+		return EncodedSize(col.base)
+	case *LineString:
+		return EncodedSize(col.set)
+	case *MultiLineString:
+		return EncodedSize(col.set)
+	case *Ring:
+		return EncodedSize(col.set)
+	case *Polygon:
+		return EncodedSize(col.set)
+	case *MultiPolygon:
+		return EncodedSize(col.set)
+	}
+	return 8 * rows
+}
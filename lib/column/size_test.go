@@ -0,0 +1,103 @@
+package column
+
+import (
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/ch-go/proto"
+	"github.com/google/uuid"
+	"github.com/paulmach/orb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodedSize(t *testing.T) {
+	str := "value"
+	for _, tc := range []struct {
+		chType Type
+		rows   []any
+	}{
+		{"UInt8", []any{uint8(1), uint8(2)}},
+		{"Int16", []any{int16(1)}},
+		{"Float32", []any{float32(1)}},
+		{"UInt64", []any{uint64(1), uint64(2), uint64(3)}},
+		{"Bool", []any{true}},
+		{"Date", []any{time.Now()}},
+		{"DateTime", []any{time.Now()}},
+		{"DateTime64(3)", []any{time.Now()}},
+		{"UUID", []any{uuid.New()}},
+		{"IPv4", []any{net.ParseIP("127.0.0.1")}},
+		{"IPv6", []any{net.ParseIP("::1")}},
+		{"Decimal(9, 2)", []any{"1.5"}},
+		{"Decimal(40, 2)", []any{"1.5"}},
+		{"Int128", []any{big.NewInt(1)}},
+		{"String", []any{"", "a", "hello world"}},
+		{"FixedString(4)", []any{"abcd", "ab"}},
+		{"Enum8('a' = 1)", []any{"a"}},
+		{"Nullable(String)", []any{nil, &str}},
+		{"Array(String)", []any{[]string{"a", "b"}, []string{}}},
+		{"Array(Array(UInt32))", []any{[][]uint32{{1}, {2, 3}}}},
+		{"Map(String, UInt64)", []any{map[string]uint64{"a": 1, "b": 2}}},
+		{"Tuple(String, Int64)", []any{[]any{"a", int64(1)}}},
+		{"Point", []any{orb.Point{1, 2}}},
+		{"Ring", []any{orb.Ring{{1, 2}, {3, 4}}}},
+		{"SimpleAggregateFunction(sum, UInt64)", []any{uint64(1)}},
+	} {
+		t.Run(string(tc.chType), func(t *testing.T) {
+			col, err := tc.chType.Column("test", &ServerContext{})
+			require.NoError(t, err)
+			assert.Equal(t, 0, EncodedSize(col))
+			for _, row := range tc.rows {
+				require.NoError(t, col.AppendRow(row))
+			}
+			var buffer proto.Buffer
+			col.Encode(&buffer)
+			assert.Equal(t, len(buffer.Buf), EncodedSize(col))
+		})
+	}
+
+	t.Run("LowCardinality(String)", func(t *testing.T) {
+		col, err := Type("LowCardinality(String)").Column("test", &ServerContext{})
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, col.AppendRow("value"))
+		}
+		size := EncodedSize(col)
+		var buffer proto.Buffer
+		col.Encode(&buffer)
+		// the encoding starts with the key type and the lengths of the index and keys
+		assert.Equal(t, len(buffer.Buf)-24, size)
+	})
+
+	t.Run("Variant(String, UInt64)", func(t *testing.T) {
+		col, err := Type("Variant(String, UInt64)").Column("test", &ServerContext{})
+		require.NoError(t, err)
+		require.NoError(t, col.AppendRow("value"))
+		require.NoError(t, col.AppendRow(uint64(1)))
+		require.NoError(t, col.AppendRow(nil))
+		// a discriminator for each row, then the values
+		assert.Equal(t, 3+6+8, EncodedSize(col))
+	})
+	t.Run("external", func(t *testing.T) {
+		col := &encodeCounter{Interface: &String{}}
+		require.NoError(t, col.AppendRow("value"))
+		require.NoError(t, col.AppendRow("other value"))
+		// columns of other packages are estimated rather than encoded
+		assert.Equal(t, 16, EncodedSize(col))
+		assert.Zero(t, col.encodes)
+	})
+}
+
+// encodeCounter is a column of a type from outside the package that counts
+// its encodings.
+type encodeCounter struct {
+	Interface
+	encodes int
+}
+
+func (c *encodeCounter) Encode(buffer *proto.Buffer) {
+	c.encodes++
+	c.Interface.Encode(buffer)
+}
@@ -38,6 +38,16 @@ func (col *String) Rows() int {
 	return col.col.Rows()
 }
 
+// Data returns the values of the column. Unlike the numeric columns it
+// copies every value into a new string.
+func (col *String) Data() []string {
+	values := make([]string, col.col.Rows())
+	for i := range values {
+		values[i] = col.col.Row(i)
+	}
+	return values
+}
+
 func (col *String) Row(i int, ptr bool) any {
 	val := col.col.Row(i)
 	if ptr {
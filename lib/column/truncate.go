@@ -0,0 +1,177 @@
+package column
+
+import "github.com/ClickHouse/ch-go/proto"
+
+// Truncate removes the values of col after its first rows, e.g. to take back
+// a row whose AppendRow failed part way. A column may then hold rows+1 values
+// in some of its buffers and rows in the others. It reports false, possibly
+// after truncating some of the nested columns, if col is of a type whose
+// values cannot be taken back: LowCardinality, Variant, Dynamic, JSON, QBit
+// and types from outside this package.
+func Truncate(col Interface, rows int) bool {
+	switch col := col.(type) {
+	case *Int8:
+		return truncate(&col.col, rows)
+	case *Int16:
+		return truncate(&col.col, rows)
+	case *Int32:
+		return truncate(&col.col, rows)
+	case *Int64:
+		return truncate(&col.col, rows)
+	case *UInt8:
+		return truncate(&col.col, rows)
+	case *UInt16:
+		return truncate(&col.col, rows)
+	case *UInt32:
+		return truncate(&col.col, rows)
+	case *UInt64:
+		return truncate(&col.col, rows)
+	case *BFloat16:
+		return truncate(&col.col, rows)
+	case *Float32:
+		return truncate(&col.col, rows)
+	case *Float64:
+		return truncate(&col.col, rows)
+	case *Bool:
+		return truncate(&col.col, rows)
+	case *Enum8:
+		return truncate(&col.col, rows)
+	case *Enum16:
+		return truncate(&col.col, rows)
+	case *Date:
+		return truncate(&col.col, rows)
+	case *Date32:
+		return truncate(&col.col, rows)
+	case *DateTime:
+		return truncate(&col.col.Data, rows)
+	case *DateTime64:
+		return truncate(&col.col.Data, rows)
+	case *Time:
+		return truncate(&col.col.Data, rows)
+	case *Time64:
+		return truncate(&col.col.Data, rows)
+	case *Interval:
+		return truncate(&col.col, rows)
+	case *UUID:
+		return truncate(&col.col, rows)
+	case *IPv4:
+		return truncate(&col.col, rows)
+	case *IPv6:
+		return truncate(&col.col, rows)
+	case *Point:
+		return truncate(&col.col.X, rows) && truncate(&col.col.Y, rows)
+	case *Nothing:
+		if rows > int(col.col) {
+			return false
+		}
+		col.col = proto.ColNothing(rows)
+		return true
+	case *Decimal:
+		return truncateProto(col.col, rows)
+	case *BigInt:
+		return truncateProto(col.col, rows)
+	case *String:
+		if rows > len(col.col.Pos) {
+			return false
+		}
+		end := 0
+		if rows > 0 {
+			end = col.col.Pos[rows-1].End
+		}
+		col.col.Buf, col.col.Pos = col.col.Buf[:end], col.col.Pos[:rows]
+		return true
+	case *FixedString:
+		if size := rows * col.col.Size; size <= len(col.col.Buf) {
+			col.col.Buf = col.col.Buf[:size]
+			return true
+		}
+		return false
+	case *AggregateFunction:
+		if rows > len(col.offsets) {
+			return false
+		}
+		end := 0
+		if rows > 0 {
+			end = col.offsets[rows-1]
+		}
+		col.buf, col.offsets = col.buf[:end], col.offsets[:rows]
+		return true
+	case *Nullable:
+		return truncate(&col.nulls, rows) && Truncate(col.base, rows)
+	case *Array:
+		// the offsets of each level are appended before the level below, so
+		// the values kept at a level are counted by the offsets kept above it
+		for _, offsets := range col.offsets {
+			if !truncate(&offsets.values.col, rows) {
+				return false
+			}
+			if rows > 0 {
+				rows = int(offsets.values.col[rows-1])
+			}
+		}
+		return Truncate(col.values, rows)
+	case *Map:
+		// the offset of a row is appended after its keys and values
+		if !truncate(&col.offsets.col, rows) {
+			return false
+		}
+		if rows > 0 {
+			rows = int(col.offsets.col[rows-1])
+		}
+		return Truncate(col.keys, rows) && Truncate(col.values, rows)
+	case *Tuple:
+		for _, c := range col.columns {
+			if !Truncate(c, rows) {
+				return false
+			}
+		}
+		return true
+	case *Nested:
+		return Truncate(col.Interface, rows)
+	case *SimpleAggregateFunction:
+		return Truncate(col.base, rows)
+	case *LineString:
+		return Truncate(col.set, rows)
+	case *MultiLineString:
+		return Truncate(col.set, rows)
+	case *Ring:
+		return Truncate(col.set, rows)
+	case *Polygon:
+		return Truncate(col.set, rows)
+	case *MultiPolygon:
+		return Truncate(col.set, rows)
+	}
+	return false
+}
+
+// truncateProto truncates the columns Decimal and BigInt keep as a
+// proto.Column.
+func truncateProto(col proto.Column, rows int) bool {
+	switch col := col.(type) {
+	case *proto.ColDecimal32:
+		return truncate(col, rows)
+	case *proto.ColDecimal64:
+		return truncate(col, rows)
+	case *proto.ColDecimal128:
+		return truncate(col, rows)
+	case *proto.ColDecimal256:
+		return truncate(col, rows)
+	case *proto.ColInt128:
+		return truncate(col, rows)
+	case *proto.ColUInt128:
+		return truncate(col, rows)
+	case *proto.ColInt256:
+		return truncate(col, rows)
+	case *proto.ColUInt256:
+		return truncate(col, rows)
+	}
+	return false
+}
+
+func truncate[S ~[]E, E any](s *S, rows int) bool {
+	if rows > len(*s) {
+		return false
+	}
+	*s = (*s)[:rows]
+	return true
+}
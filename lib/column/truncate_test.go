@@ -0,0 +1,81 @@
+package column
+
+import (
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/ch-go/proto"
+	"github.com/google/uuid"
+	"github.com/paulmach/orb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncate(t *testing.T) {
+	str := "value"
+	for _, tc := range []struct {
+		chType Type
+		row    any
+		// taken is appended after row and taken back; it may fail to append
+		// part way
+		taken any
+	}{
+		{"UInt8", uint8(1), uint8(2)},
+		{"Float64", float64(1), float64(2)},
+		{"Bool", true, false},
+		{"Date", time.Now(), time.Now()},
+		{"DateTime", time.Now(), time.Now()},
+		{"DateTime64(3)", time.Now(), time.Now()},
+		{"UUID", uuid.New(), uuid.New()},
+		{"IPv4", net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")},
+		{"IPv6", net.ParseIP("::1"), net.ParseIP("::2")},
+		{"Decimal(9, 2)", "1.5", "2.5"},
+		{"Decimal(40, 2)", "1.5", "2.5"},
+		{"Int128", big.NewInt(1), big.NewInt(2)},
+		{"String", "a", "hello world"},
+		{"FixedString(4)", "abcd", "ab"},
+		{"Enum8('a' = 1, 'b' = 2)", "a", "b"},
+		{"Nullable(String)", &str, nil},
+		{"Array(String)", []string{"a", "b"}, []string{"c"}},
+		{"Array(Array(UInt32))", [][]uint32{{1}, {2, 3}}, [][]uint32{{4, 5}}},
+		{"Array(UInt8)", []any{uint8(1)}, []any{uint8(2), "x"}},
+		{"Map(String, UInt64)", map[string]uint64{"a": 1}, map[string]uint64{"b": 2, "c": 3}},
+		{"Tuple(String, Int64)", []any{"a", int64(1)}, []any{"b", "x"}},
+		{"Point", orb.Point{1, 2}, orb.Point{3, 4}},
+		{"Ring", orb.Ring{{1, 2}, {3, 4}}, orb.Ring{{5, 6}}},
+		{"SimpleAggregateFunction(sum, UInt64)", uint64(1), uint64(2)},
+		{"AggregateFunction(sum, UInt64)", []byte{1, 0, 0, 0, 0, 0, 0, 0}, []byte{2, 0, 0, 0, 0, 0, 0, 0}},
+	} {
+		t.Run(string(tc.chType), func(t *testing.T) {
+			col, err := tc.chType.Column("test", &ServerContext{})
+			require.NoError(t, err)
+			want, err := tc.chType.Column("test", &ServerContext{})
+			require.NoError(t, err)
+			require.NoError(t, col.AppendRow(tc.row))
+			require.NoError(t, want.AppendRow(tc.row))
+			_ = col.AppendRow(tc.taken)
+
+			require.True(t, Truncate(col, 1))
+			assert.Equal(t, 1, col.Rows())
+			var got, expected proto.Buffer
+			col.Encode(&got)
+			want.Encode(&expected)
+			assert.Equal(t, expected.Buf, got.Buf)
+
+			// the column stays usable
+			require.NoError(t, col.AppendRow(tc.row))
+			assert.Equal(t, 2, col.Rows())
+		})
+	}
+
+	for _, chType := range []Type{"LowCardinality(String)", "Variant(String, UInt64)"} {
+		t.Run(string(chType), func(t *testing.T) {
+			col, err := chType.Column("test", &ServerContext{})
+			require.NoError(t, err)
+			require.NoError(t, col.AppendRow("value"))
+			assert.False(t, Truncate(col, 0))
+		})
+	}
+}
@@ -34,6 +34,27 @@ type (
 		MaxIdleConns int
 		Open         int
 		Idle         int
+
+		// WaitCount is the number of connections waited for because
+		// MaxOpenConns were in use, and WaitDuration the total time waited.
+		WaitCount    int64
+		WaitDuration time.Duration
+		// Dials is the number of connections dialed, and DialErrors the
+		// number of failed dials by host address.
+		Dials      int64
+		DialErrors map[string]int64
+		// MaxIdleClosed is the number of connections closed because
+		// MaxIdleConns were idle.
+		MaxIdleClosed int64
+		// MaxIdleTimeClosed is the number of connections closed because they
+		// were idle for ConnMaxIdleTime.
+		MaxIdleTimeClosed int64
+		// MaxLifetimeClosed is the number of connections closed because they
+		// reached ConnMaxLifetime.
+		MaxLifetimeClosed int64
+		// BadConnClosed is the number of connections closed because they
+		// were broken or released after an error.
+		BadConnClosed int64
 	}
 )
 
@@ -94,11 +115,20 @@ type (
 		// XML, ...) would embed it in a valid payload and end the stream
 		// cleanly. An explicit caller setting takes precedence over the pin.
 		//
+		// Over the native protocol the server renders each row with
+		// formatRow(), so row formats whose output is a plain sequence of
+		// rows (CSV, TSV, JSONEachRow, RowBinary, ...) are available, as are
+		// their WithNames and WithNamesAndTypes variants and the JSON,
+		// JSONStrings, JSONCompact and JSONCompactStrings documents, whose
+		// header or envelope is written client-side. Native is encoded
+		// client-side from the result blocks, as are the block formats of
+		// clickhouse.RegisterFormatEncoder (Parquet, Arrow, ...); other
+		// formats return clickhouse.ErrFormatNativeUnsupported. A mid-stream
+		// failure surfaces as the server exception from Read.
+		//
 		// Experimental: this API is experimental and may change or be removed
-		// in a future minor release. It is currently only supported over the
-		// HTTP protocol, where the server encodes the stream and every
-		// server-supported format works; over the native protocol it returns
-		// clickhouse.ErrFormatNativeUnsupported.
+		// in a future minor release. Over the HTTP protocol the server encodes
+		// the stream and every server-supported format works.
 		QueryFormat(ctx context.Context, format string, query string, args ...any) (io.ReadCloser, error)
 
 		// InsertFormat executes the INSERT statement query, streaming
@@ -115,10 +145,11 @@ type (
 		// server rejects the once-decoded payload as malformed format data.
 		//
 		// Experimental: this API is experimental and may change or be removed
-		// in a future minor release. It is currently only supported over the
-		// HTTP protocol, where the server parses the payload and every
-		// server-supported format works; over the native protocol it returns
-		// clickhouse.ErrFormatNativeUnsupported.
+		// in a future minor release. Over the HTTP protocol the server parses
+		// the payload and every server-supported format works. Over the
+		// native protocol only Native is supported: its blocks are sent as
+		// they are read and must have the columns of the INSERT. Other
+		// formats return clickhouse.ErrFormatNativeUnsupported.
 		InsertFormat(ctx context.Context, format string, query string, data io.Reader) error
 
 		// Deprecated: use context aware `WithAsync()` for any async operations
@@ -144,6 +175,49 @@ type (
 		HasData() bool
 	}
 
+	// BlockRows is implemented by the Rows returned by Conn.Query, for
+	// reading a result column by column instead of row by row:
+	//
+	//	blocks, ok := rows.(driver.BlockRows)
+	BlockRows interface {
+		Rows
+		// NextBlock advances to the next non-empty block of the result.
+		// A block partially read with Next is skipped, and Next continues
+		// after the last block returned by NextBlock. Like Next, it closes
+		// the rows once the result is exhausted.
+		NextBlock() bool
+		// Block returns the block NextBlock advanced to, or nil.
+		Block() Block
+	}
+
+	// ExtremesRows is implemented by the Rows returned by Conn.Query, for
+	// reading the extremes of a result:
+	//
+	//	extremes, ok := rows.(driver.ExtremesRows)
+	ExtremesRows interface {
+		Rows
+		// Extremes scans the minimum and maximum values of the result
+		// columns, sent by the server with the extremes setting, into min
+		// and max. Like Totals, it can be called once Next returns false,
+		// and returns sql.ErrNoRows if the result has no extremes. Over
+		// HTTP, which doesn't carry extremes in the Native format, it
+		// returns clickhouse.ErrExtremesHTTPUnsupported.
+		Extremes(min, max []any) error
+	}
+
+	// Block is a decoded block of a query result. Its columns can be read
+	// in bulk, e.g. with clickhouse.ColumnValues. The block is not reused,
+	// so it stays valid after the rows advance.
+	Block interface {
+		Rows() int
+		// Columns returns the names of the columns.
+		Columns() []string
+		// Column returns the column at index i.
+		Column(i int) column.Interface
+		// ColumnByName returns the column with the given name, or nil.
+		ColumnByName(name string) column.Interface
+	}
+
 	// Batch represents a prepared INSERT that buffers rows client-side and sends them to ClickHouse.
 	//
 	// Typical usage:
@@ -154,24 +228,38 @@ type (
 	//
 	//	for ... {
 	//		_ = batch.Append(...)
-	//		// Optionally flush periodically for native protocol.
+	//		// Optionally flush periodically to bound memory.
 	//		// _ = batch.Flush()
 	//	}
 	//	_ = batch.Send()
 	//
 	// Notes:
 	// - After Send(), the batch is considered finalized (IsSent() becomes true). Create a new batch to send more rows.
-	// - For HTTP protocol, Flush() is currently a no-op. Use Send() to transmit buffered rows.
+	// - For HTTP protocol, Flush() streams the buffered rows into a single INSERT request that Send() completes.
+	// - Columns with a DEFAULT or EPHEMERAL expression (see DefaultsBatch) may be left out of the first
+	//   Append or AppendStruct of a batch prepared with WithOmitDefaultColumns, the server then fills
+	//   them. See Append and AppendStruct.
 	Batch interface {
 		Abort() error
+		// Append appends a row with a value for each column of the batch.
+		// With WithOmitDefaultColumns, if the first row has as many values as
+		// there are columns without a DEFAULT or EPHEMERAL expression, the
+		// batch only inserts those columns and the server fills the others.
 		Append(v ...any) error
+		// AppendStruct appends a row from the fields of a struct. With
+		// WithOmitDefaultColumns, if the struct of the first row has no field
+		// for some columns and they all have a DEFAULT or EPHEMERAL
+		// expression, the batch only inserts the other columns and the server
+		// fills them.
 		AppendStruct(v any) error
 		Column(int) BatchColumn
 
 		// Flush sends the currently buffered rows but keeps the batch usable.
 		//
 		// For native protocol this transmits the buffered block to the server and clears the local buffer.
-		// For HTTP protocol this is currently a no-op.
+		// For HTTP protocol the first Flush starts a streaming INSERT request, each Flush writes the
+		// buffered block into its body and Send ends it. With WithCloseOnFlush or
+		// WithInsertDeduplicationToken, each Flush is an INSERT request of its own instead.
 		Flush() error
 
 		// Send flushes any buffered rows and finalizes the INSERT.
@@ -189,6 +277,39 @@ type (
 		// Close does not guarantee that buffered rows are sent; call Send() to finalize the INSERT.
 		Close() error
 	}
+	// SizedBatch is implemented by the Batch returned by Conn.PrepareBatch,
+	// for bounding the memory of a batch:
+	//
+	//	sized, ok := batch.(driver.SizedBatch)
+	SizedBatch interface {
+		Batch
+		// Size returns the approximate number of bytes the rows buffered
+		// since the batch was prepared or last flushed take when encoded.
+		// It is cheap enough to call after every Append.
+		Size() int
+	}
+	// DefaultsBatch is implemented by the Batch returned by
+	// Conn.PrepareBatch, for the columns the server can fill:
+	//
+	//	defaults, ok := batch.(driver.DefaultsBatch)
+	DefaultsBatch interface {
+		Batch
+		// ColumnDefaults returns the columns of the table with a default
+		// expression, in table order. The native protocol gets them from the
+		// server with the INSERT, HTTP from DESCRIBE TABLE; it is empty when
+		// the columns were given with WithColumnNamesAndTypes.
+		ColumnDefaults() []ColumnDefault
+	}
+	// ColumnDefault is a column of the table a batch inserts into that has a
+	// default expression.
+	ColumnDefault struct {
+		Name string
+		Type string
+		// Kind is DEFAULT, MATERIALIZED, ALIAS or EPHEMERAL. Only DEFAULT and
+		// EPHEMERAL columns can be inserted into.
+		Kind       string
+		Expression string
+	}
 	BatchColumn interface {
 		// Append appends a value to the underlying column buffer.
 		Append(any) error
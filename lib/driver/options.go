@@ -3,6 +3,14 @@ package driver
 type PrepareBatchOptions struct {
 	ReleaseConnection bool
 	CloseOnFlush      bool
+	// InsertDeduplicationToken is the batch ID the deduplication token of each block is derived from.
+	InsertDeduplicationToken string
+	// MaxBytes limits the approximate size of the rows the batch buffers, see SizedBatch.
+	MaxBytes int
+	// FlushOnMaxBytes flushes the batch at MaxBytes instead of rejecting further rows.
+	FlushOnMaxBytes bool
+	// OmitDefaultColumns lets the first row passed to Append or AppendStruct leave out the columns with a default.
+	OmitDefaultColumns bool
 }
 
 type PrepareBatchOption func(options *PrepareBatchOptions)
@@ -25,3 +33,45 @@ func WithCloseOnFlush() PrepareBatchOption {
 		options.CloseOnFlush = true
 	}
 }
+
+// WithInsertDeduplicationToken makes the batch idempotent: each block it sends is inserted
+// with the insert_deduplication_token "<batchID>:<n>", where n counts the blocks of the batch.
+// Sending a block again, or the same rows in a new batch with the same ID, is then deduplicated
+// by tables that deduplicate inserts (e.g. ReplicatedMergeTree).
+//
+// Every Flush ends the INSERT of its block as with WithCloseOnFlush, and a Send that failed
+// after a Flush may be retried by Options.RetryPolicy or called again.
+func WithInsertDeduplicationToken(batchID string) PrepareBatchOption {
+	return func(options *PrepareBatchOptions) {
+		options.InsertDeduplicationToken = batchID
+	}
+}
+
+// WithMaxBytes limits the rows a batch buffers to an approximate encoded size (see SizedBatch):
+// once it reaches maxBytes, Append and AppendStruct return clickhouse.ErrBatchFull until the batch is
+// flushed or sent. The row that reaches the limit is still appended.
+func WithMaxBytes(maxBytes int) PrepareBatchOption {
+	return func(options *PrepareBatchOptions) {
+		options.MaxBytes = maxBytes
+		options.FlushOnMaxBytes = false
+	}
+}
+
+// WithOmitDefaultColumns lets Append and AppendStruct leave out the columns with a DEFAULT or
+// EPHEMERAL expression (see DefaultsBatch): if the first row has a value for each of the
+// other columns only, the batch inserts just those columns and the server fills the rest. Without
+// it, such a row is rejected like any row with too few values or a struct missing a field.
+func WithOmitDefaultColumns() PrepareBatchOption {
+	return func(options *PrepareBatchOptions) {
+		options.OmitDefaultColumns = true
+	}
+}
+
+// WithFlushOnMaxBytes flushes a batch whenever the rows it buffers reach an approximate
+// encoded size of maxBytes (see SizedBatch), before appending the next row.
+func WithFlushOnMaxBytes(maxBytes int) PrepareBatchOption {
+	return func(options *PrepareBatchOptions) {
+		options.MaxBytes = maxBytes
+		options.FlushOnMaxBytes = true
+	}
+}
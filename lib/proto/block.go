@@ -30,6 +30,16 @@ func (b *Block) Rows() int {
 	return b.Columns[0].Rows()
 }
 
+// Size returns the approximate number of bytes the columns of the block take
+// when encoded, see column.EncodedSize.
+func (b *Block) Size() int {
+	size := 0
+	for _, c := range b.Columns {
+		size += column.EncodedSize(c)
+	}
+	return size
+}
+
 func (b *Block) AddColumn(name string, ct column.Type) error {
 	col, err := ct.Column(name, b.ServerContext)
 	if err != nil {
@@ -59,6 +69,18 @@ func (b *Block) Append(v ...any) (err error) {
 	return nil
 }
 
+// Truncate keeps the first rows of the block, e.g. to take back a row that
+// failed to Append. It reports false if a column cannot be truncated (see
+// column.Truncate), in which case the block should not be used any more.
+func (b *Block) Truncate(rows int) bool {
+	for _, col := range b.Columns {
+		if !column.Truncate(col, rows) {
+			return false
+		}
+	}
+	return true
+}
+
 func (b *Block) ColumnsNames() []string {
 	return b.names
 }
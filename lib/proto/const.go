@@ -29,6 +29,9 @@ const (
 	ClientData   = 2
 	ClientCancel = 3
 	ClientPing   = 4
+
+	ClientSSHChallengeRequest  = 11
+	ClientSSHChallengeResponse = 12
 )
 
 const (
@@ -63,4 +66,5 @@ const (
 	ServerReadTaskRequest     = 13
 	ServerProfileEvents       = 14
 	ServerTreeReadTaskRequest = 15
+	ServerSSHChallenge        = 18
 )
@@ -28,6 +28,10 @@ type Query struct {
 	Compression              bool
 	InitialUser              string
 	InitialAddress           string
+	// Secondary marks a query sent on behalf of InitialUser by a server of
+	// the cluster, authenticated by InterserverHash.
+	Secondary       bool
+	InterserverHash string
 }
 
 func (q *Query) Encode(buffer *chproto.Buffer, revision uint64) error {
@@ -43,7 +47,7 @@ func (q *Query) Encode(buffer *chproto.Buffer, revision uint64) error {
 	buffer.PutString("") /* empty string is a marker of the end of setting */
 
 	if revision >= DBMS_MIN_REVISION_WITH_INTERSERVER_SECRET {
-		buffer.PutString("")
+		buffer.PutString(q.InterserverHash)
 	}
 	{
 		buffer.PutByte(StateComplete)
@@ -69,9 +73,15 @@ func swap64(b []byte) {
 }
 
 func (q *Query) encodeClientInfo(buffer *chproto.Buffer, revision uint64) error {
-	buffer.PutByte(ClientQueryInitial)
-	buffer.PutString(q.InitialUser)    // initial_user
-	buffer.PutString("")               // initial_query_id
+	if q.Secondary {
+		buffer.PutByte(ClientQuerySecondary)
+		buffer.PutString(q.InitialUser) // initial_user
+		buffer.PutString(q.ID)          // initial_query_id
+	} else {
+		buffer.PutByte(ClientQueryInitial)
+		buffer.PutString(q.InitialUser) // initial_user
+		buffer.PutString("")            // initial_query_id
+	}
 	buffer.PutString(q.InitialAddress) // initial_address
 	if revision >= DBMS_MIN_PROTOCOL_VERSION_WITH_INITIAL_QUERY_START_TIME {
 		buffer.PutInt64(0) // initial_query_start_time_microseconds
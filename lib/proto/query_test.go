@@ -1,8 +1,10 @@
 package proto
 
 import (
+	"bytes"
 	"testing"
 
+	chproto "github.com/ClickHouse/ch-go/proto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -36,3 +38,43 @@ func TestEncodeFieldDump(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestQuerySecondary(t *testing.T) {
+	query := Query{
+		ID:              "query-id",
+		ClientName:      "client",
+		Body:            "SELECT 1",
+		InitialUser:     "alice",
+		InitialAddress:  "127.0.0.1:9000",
+		Secondary:       true,
+		InterserverHash: "hash",
+	}
+	var buffer chproto.Buffer
+	require.NoError(t, query.Encode(&buffer, DBMS_MIN_REVISION_WITH_INTERSERVER_SECRET))
+
+	reader := chproto.NewReader(bytes.NewReader(buffer.Buf))
+	str := func() string {
+		v, err := reader.Str()
+		require.NoError(t, err)
+		return v
+	}
+	assert.Equal(t, "query-id", str())
+	kind, err := reader.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte(ClientQuerySecondary), kind)
+	assert.Equal(t, "alice", str())
+	assert.Equal(t, "query-id", str(), "initial_query_id")
+	assert.Equal(t, "127.0.0.1:9000", str())
+	// interface, os user, hostname, client name and version, quota key, patch
+	_, _ = reader.ReadByte()
+	str()
+	str()
+	assert.Equal(t, "client", str())
+	for range 3 {
+		_, _ = reader.UVarInt()
+	}
+	str()
+	_, _ = reader.UVarInt()
+	assert.Empty(t, str(), "end of settings")
+	assert.Equal(t, "hash", str())
+}
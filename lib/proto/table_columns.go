@@ -2,6 +2,8 @@ package proto
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	chproto "github.com/ClickHouse/ch-go/proto"
 )
@@ -24,3 +26,115 @@ func (t *TableColumns) Decode(reader *chproto.Reader, revision uint64) (err erro
 func (t *TableColumns) String() string {
 	return fmt.Sprintf("first=%s, second=%s", t.First, t.Second)
 }
+
+// ColumnDescription is a column of the table description sent in a
+// ServerTableColumns packet.
+type ColumnDescription struct {
+	Name string
+	Type string
+	// DefaultKind is DEFAULT, MATERIALIZED, ALIAS or EPHEMERAL, or empty if
+	// the column has no default.
+	DefaultKind       string
+	DefaultExpression string
+}
+
+const tableColumnsVersion = "columns format version: 1"
+
+// Columns parses the table description in Second, written by the server as
+//
+//	columns format version: 1
+//	2 columns:
+//	`id` UInt64
+//	`created` DateTime	DEFAULT	now()
+//
+// with the default, comment, codec and TTL of a column separated by tabs.
+func (t *TableColumns) Columns() ([]ColumnDescription, error) {
+	lines := strings.Split(strings.TrimSuffix(t.Second, "\n"), "\n")
+	if len(lines) < 2 || lines[0] != tableColumnsVersion {
+		return nil, fmt.Errorf("table columns: unexpected header %q", lines[0])
+	}
+	count, ok := strings.CutSuffix(lines[1], " columns:")
+	if !ok {
+		return nil, fmt.Errorf("table columns: unexpected column count %q", lines[1])
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n != len(lines)-2 {
+		return nil, fmt.Errorf("table columns: expected %s columns, got %d", count, len(lines)-2)
+	}
+	columns := make([]ColumnDescription, 0, n)
+	for _, line := range lines[2:] {
+		col, err := parseColumnDescription(line)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+func parseColumnDescription(line string) (ColumnDescription, error) {
+	var col ColumnDescription
+	fields := strings.Split(line, "\t")
+	name, typ, ok := cutBackQuoted(fields[0])
+	if !ok || !strings.HasPrefix(typ, " ") {
+		return col, fmt.Errorf("table columns: malformed column %q", line)
+	}
+	col.Name, col.Type = name, unescape(typ[1:])
+	if len(fields) > 1 {
+		switch kind := fields[1]; kind {
+		case "DEFAULT", "MATERIALIZED", "ALIAS", "EPHEMERAL":
+			col.DefaultKind = kind
+			if len(fields) > 2 {
+				col.DefaultExpression = unescape(fields[2])
+			}
+		}
+	}
+	return col, nil
+}
+
+// cutBackQuoted unquotes the back quoted identifier s starts with and
+// returns it with the rest of s.
+func cutBackQuoted(s string) (name, rest string, ok bool) {
+	if !strings.HasPrefix(s, "`") {
+		return "", "", false
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '`':
+			return unescape(s[1:i]), s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+var unescapes = map[byte]byte{
+	'b': '\b',
+	'f': '\f',
+	'n': '\n',
+	'r': '\r',
+	't': '\t',
+	'0': 0,
+}
+
+// unescape reverses the backslash escaping the server applies to names,
+// types and expressions.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			c = s[i]
+			if u, ok := unescapes[c]; ok {
+				c = u
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableColumns(t *testing.T) {
+	info := TableColumns{Second: "columns format version: 1\n" +
+		"6 columns:\n" +
+		"`id` UInt64\n" +
+		"`created` DateTime\tDEFAULT\tnow()\n" +
+		"`name` String\tDEFAULT\t\\'a\\\\tb\\'\tCOMMENT \\'the name\\'\n" +
+		"`doubled` UInt64\tMATERIALIZED\tid * 2\tCODEC(ZSTD(1))\n" +
+		"`we\\`ird` Map(String, UInt8)\tALIAS\tmap(\\'a\\', 1)\n" +
+		"`raw` String\tEPHEMERAL\t\\'\\'\n",
+	}
+	columns, err := info.Columns()
+	require.NoError(t, err)
+	assert.Equal(t, []ColumnDescription{
+		{Name: "id", Type: "UInt64"},
+		{Name: "created", Type: "DateTime", DefaultKind: "DEFAULT", DefaultExpression: "now()"},
+		{Name: "name", Type: "String", DefaultKind: "DEFAULT", DefaultExpression: `'a\tb'`},
+		{Name: "doubled", Type: "UInt64", DefaultKind: "MATERIALIZED", DefaultExpression: "id * 2"},
+		{Name: "we`ird", Type: "Map(String, UInt8)", DefaultKind: "ALIAS", DefaultExpression: "map('a', 1)"},
+		{Name: "raw", Type: "String", DefaultKind: "EPHEMERAL", DefaultExpression: "''"},
+	}, columns)
+
+	for _, malformed := range []string{
+		"",
+		"columns format version: 2\n0 columns:\n",
+		"columns format version: 1\n2 columns:\n`id` UInt64\n",
+		"columns format version: 1\n1 columns:\nid UInt64\n",
+	} {
+		_, err := (&TableColumns{Second: malformed}).Columns()
+		assert.Error(t, err, malformed)
+	}
+}
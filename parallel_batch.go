@@ -0,0 +1,208 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// ParallelBatch spreads the rows of an INSERT over several batches, its
+// shards, each prepared on its own connection from the pool. Rows are
+// appended to the shards in turn and the shards encode, compress and send
+// their blocks concurrently, so a bulk load isn't limited to one stream.
+//
+// Append and AppendStruct are safe for concurrent use; each shard is locked
+// only while a row is appended to it.
+type ParallelBatch struct {
+	shards []*batchShard
+	next   atomic.Uint64
+}
+
+type batchShard struct {
+	mu    sync.Mutex
+	batch driver.Batch
+	rows  int // rows appended to the shard, flushed or not
+}
+
+// ShardResult is the outcome of sending a shard of a ParallelBatch.
+type ShardResult struct {
+	// Shard is the index of the shard, see ParallelBatch.Shard.
+	Shard int
+	// Rows is the number of rows appended to the shard.
+	Rows int
+	Err  error
+}
+
+// PrepareParallelBatch prepares an INSERT split into shards batches, each
+// holding a connection of conn until it is sent (unless opts include
+// driver.WithReleaseConnection), so Options.MaxOpenConns should allow for
+// them. The connections are opened following Options.ConnOpenStrategy, which
+// spreads them over the replicas with ConnOpenRoundRobin.
+//
+// With driver.WithInsertDeduplicationToken(batchID), shard i uses the batch
+// ID "<batchID>/<i>". A retried load is only deduplicated if it appends the
+// same rows in the same order from a single goroutine.
+func PrepareParallelBatch(ctx context.Context, conn driver.Conn, query string, shards int, opts ...driver.PrepareBatchOption) (*ParallelBatch, error) {
+	if shards < 1 {
+		return nil, fmt.Errorf("clickhouse: a parallel batch needs at least one shard, got %d", shards)
+	}
+	return prepareParallelBatch(shards, func(i int) (driver.Batch, error) {
+		return conn.PrepareBatch(ctx, query, shardBatchOptions(i, opts)...)
+	})
+}
+
+// prepareParallelBatch prepares the batches of n shards concurrently with
+// prepare, aborting them all if one fails. ShardedConn.PrepareBatch uses it
+// too.
+func prepareParallelBatch(n int, prepare func(i int) (driver.Batch, error)) (*ParallelBatch, error) {
+	b := &ParallelBatch{shards: make([]*batchShard, n)}
+	for i := range b.shards {
+		b.shards[i] = &batchShard{}
+	}
+	err := b.each(func(i int, shard *batchShard) (err error) {
+		shard.batch, err = prepare(i)
+		return err
+	})
+	if err != nil {
+		b.Abort()
+		return nil, err
+	}
+	return b, nil
+}
+
+// shardBatchOptions returns the options to prepare the batch of shard i with,
+// suffixing the insert deduplication token of opts with "/<i>".
+func shardBatchOptions(i int, opts []driver.PrepareBatchOption) []driver.PrepareBatchOption {
+	if token := getPrepareBatchOptions(opts...).InsertDeduplicationToken; token != "" {
+		return append(slices.Clone(opts), driver.WithInsertDeduplicationToken(fmt.Sprintf("%s/%d", token, i)))
+	}
+	return opts
+}
+
+// each runs fn for all shards concurrently and joins their errors.
+func (b *ParallelBatch) each(fn func(i int, shard *batchShard) error) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(b.shards))
+	)
+	for i, shard := range b.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(i, shard); err != nil {
+				errs[i] = fmt.Errorf("clickhouse: shard %d: %w", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// appendTo appends a row to shard i with fn. ShardedBatch routes its rows
+// with it.
+func (b *ParallelBatch) appendTo(i int, fn func(driver.Batch) error) error {
+	shard := b.shards[i]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if err := fn(shard.batch); err != nil {
+		return err
+	}
+	shard.rows++
+	return nil
+}
+
+// Append appends a row to the next shard.
+func (b *ParallelBatch) Append(v ...any) error {
+	return b.append(func(batch driver.Batch) error { return batch.Append(v...) })
+}
+
+// AppendStruct appends a row from the fields of a struct to the next shard.
+func (b *ParallelBatch) AppendStruct(v any) error {
+	return b.append(func(batch driver.Batch) error { return batch.AppendStruct(v) })
+}
+
+func (b *ParallelBatch) append(fn func(driver.Batch) error) error {
+	return b.appendTo(int((b.next.Add(1)-1)%uint64(len(b.shards))), fn)
+}
+
+// Flush flushes all shards concurrently.
+func (b *ParallelBatch) Flush() error {
+	return b.each(func(_ int, shard *batchShard) error {
+		shard.mu.Lock()
+		defer shard.mu.Unlock()
+		return shard.batch.Flush()
+	})
+}
+
+// Send sends all shards concurrently and returns the result of each. The
+// error joins the errors of the shards that failed; they can be sent again
+// with Shard(i).Send().
+func (b *ParallelBatch) Send() ([]ShardResult, error) {
+	results := make([]ShardResult, len(b.shards))
+	err := b.each(func(i int, shard *batchShard) error {
+		shard.mu.Lock()
+		defer shard.mu.Unlock()
+		err := shard.batch.Send()
+		results[i] = ShardResult{Shard: i, Rows: shard.rows, Err: err}
+		return err
+	})
+	return results, err
+}
+
+// Abort aborts all shards.
+func (b *ParallelBatch) Abort() error {
+	return b.each(func(_ int, shard *batchShard) error {
+		if shard.batch == nil || shard.batch.IsSent() {
+			return nil
+		}
+		return shard.batch.Abort()
+	})
+}
+
+// Close releases the connections of the shards that were not sent.
+func (b *ParallelBatch) Close() error {
+	return b.each(func(_ int, shard *batchShard) error {
+		return shard.batch.Close()
+	})
+}
+
+// Shards returns the number of shards.
+func (b *ParallelBatch) Shards() int {
+	return len(b.shards)
+}
+
+// Shard returns the batch of shard i. It must not be used concurrently with
+// the ParallelBatch.
+func (b *ParallelBatch) Shard(i int) driver.Batch {
+	return b.shards[i].batch
+}
+
+// Rows returns the number of rows buffered by the shards.
+func (b *ParallelBatch) Rows() int {
+	rows := 0
+	for _, shard := range b.shards {
+		shard.mu.Lock()
+		rows += shard.batch.Rows()
+		shard.mu.Unlock()
+	}
+	return rows
+}
+
+// Size returns the approximate encoded size of the rows buffered by the
+// shards, see driver.SizedBatch.
+func (b *ParallelBatch) Size() int {
+	size := 0
+	for _, shard := range b.shards {
+		shard.mu.Lock()
+		if sized, ok := shard.batch.(driver.SizedBatch); ok {
+			size += sized.Size()
+		}
+		shard.mu.Unlock()
+	}
+	return size
+}
@@ -0,0 +1,96 @@
+package clickhouse
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func TestParallelBatch(t *testing.T) {
+	_, err := PrepareParallelBatch(t.Context(), &fakeBatchConn{}, "INSERT INTO t", 0)
+	assert.Error(t, err)
+
+	conn := &fakeBatchConn{}
+	batch, err := PrepareParallelBatch(t.Context(), conn, "INSERT INTO t", 3, driver.WithInsertDeduplicationToken("load"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, batch.Shards())
+	var tokens []string
+	for _, options := range conn.prepared() {
+		tokens = append(tokens, options.InsertDeduplicationToken)
+	}
+	assert.ElementsMatch(t, []string{"load/0", "load/1", "load/2"}, tokens)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				assert.NoError(t, batch.Append(g*25+i))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, batch.Rows())
+	assert.Equal(t, 100, batch.Size())
+	require.NoError(t, batch.Flush())
+	assert.Equal(t, 0, batch.Rows())
+	require.NoError(t, batch.AppendStruct(100))
+
+	results, err := batch.Send()
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	rows := 0
+	for i, result := range results {
+		assert.Equal(t, i, result.Shard)
+		assert.NoError(t, result.Err)
+		// the rows are spread evenly
+		assert.InDelta(t, 101/3, result.Rows, 1)
+		rows += result.Rows
+	}
+	assert.Equal(t, 101, rows)
+
+	var values []int
+	for _, sent := range conn.batches() {
+		for _, v := range sent {
+			values = append(values, v.(int))
+		}
+	}
+	sort.Ints(values)
+	require.Len(t, values, 101)
+	for i, v := range values {
+		assert.Equal(t, i, v)
+	}
+	for i := 0; i < batch.Shards(); i++ {
+		assert.True(t, batch.Shard(i).IsSent())
+	}
+}
+
+func TestParallelBatchSendError(t *testing.T) {
+	sendErr := errors.New("send failed")
+	conn := &fakeBatchConn{sendErr: sendErr}
+	batch, err := PrepareParallelBatch(t.Context(), conn, "INSERT INTO t", 2)
+	require.NoError(t, err)
+	require.NoError(t, batch.Append(1))
+
+	results, err := batch.Send()
+	assert.ErrorIs(t, err, sendErr)
+	assert.ErrorContains(t, err, "shard 0")
+	require.Len(t, results, 2)
+	assert.Equal(t, ShardResult{Shard: 0, Rows: 1, Err: sendErr}, results[0])
+	assert.Equal(t, ShardResult{Shard: 1, Rows: 0, Err: sendErr}, results[1])
+
+	// a failed shard can be sent again
+	conn.mu.Lock()
+	conn.sendErr = nil
+	conn.mu.Unlock()
+	require.NoError(t, batch.Shard(0).Send())
+	assert.Equal(t, [][]any{{1}}, conn.batches())
+	require.NoError(t, batch.Close())
+}
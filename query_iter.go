@@ -0,0 +1,106 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"reflect"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// QueryIter runs query on conn and returns an iterator over its rows, each
+// scanned into a T. Rows are streamed block by block, so only the rows of
+// the current block are held in memory:
+//
+//	for event, err := range clickhouse.QueryIter[Event](ctx, conn, "SELECT * FROM events") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// Struct types are scanned with ScanStruct, mapping columns to fields by the
+// `ch` tag or field name. Any other T, including time.Time and types
+// implementing sql.Scanner, is scanned from a single column.
+//
+// The query is sent when the iteration starts, and each iteration runs it
+// again. An error ends the iteration after it has been yielded. Breaking out
+// of the loop early cancels the rest of the query.
+func QueryIter[T any](ctx context.Context, conn driver.Conn, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		rows, err := conn.Query(ctx, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		scanStruct := scanAsStruct[T]()
+		for rows.Next() {
+			var (
+				value T
+				err   error
+			)
+			if scanStruct {
+				err = rows.ScanStruct(&value)
+			} else {
+				err = rows.Scan(&value)
+			}
+			if err != nil {
+				cancel()
+				rows.Close()
+				yield(zero, err)
+				return
+			}
+			if !yield(value, nil) {
+				// cancel rather than drain the remaining blocks
+				cancel()
+				rows.Close()
+				return
+			}
+		}
+		if err := rows.Close(); err != nil {
+			yield(zero, err)
+			return
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// QueryOne runs query on conn and scans its first row into a T, following
+// the same rules as QueryIter. It returns sql.ErrNoRows if the query
+// returns no rows.
+func QueryOne[T any](ctx context.Context, conn driver.Conn, query string, args ...any) (T, error) {
+	var (
+		value T
+		row   = conn.QueryRow(ctx, query, args...)
+		err   error
+	)
+	if scanAsStruct[T]() {
+		err = row.ScanStruct(&value)
+	} else {
+		err = row.Scan(&value)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
+
+var (
+	scannerType = reflect.TypeFor[sql.Scanner]()
+	timeType    = reflect.TypeFor[time.Time]()
+)
+
+// scanAsStruct reports whether T is scanned with ScanStruct rather than as
+// a single column value.
+func scanAsStruct[T any]() bool {
+	t := reflect.TypeFor[T]()
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PointerTo(t).Implements(scannerType)
+}
@@ -0,0 +1,195 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+// blockConn is a driver.Conn whose queries return fixed blocks of
+// (id Int64, name String), or of id alone with idOnly.
+type blockConn struct {
+	driver.Conn
+	blocks   [][]int64
+	idOnly   bool
+	err      error
+	queryErr error
+	queries  int
+	ctx      context.Context
+}
+
+func (c *blockConn) newRows(ctx context.Context) *rows {
+	c.queries++
+	c.ctx = ctx
+	newBlock := func(ids []int64) *proto.Block {
+		block := &proto.Block{ServerContext: &column.ServerContext{}}
+		block.AddColumn("id", "Int64")
+		if c.idOnly {
+			for _, id := range ids {
+				block.Append(id)
+			}
+			return block
+		}
+		block.AddColumn("name", "String")
+		for _, id := range ids {
+			block.Append(id, "row")
+		}
+		return block
+	}
+	var (
+		stream = make(chan *proto.Block)
+		errs   = make(chan error, 1)
+		first  = newBlock(nil)
+	)
+	if len(c.blocks) > 0 {
+		first = newBlock(c.blocks[0])
+	}
+	go func() {
+		defer close(errs)
+		defer close(stream)
+		for i := 1; i < len(c.blocks); i++ {
+			select {
+			case stream <- newBlock(c.blocks[i]):
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+		if c.err != nil {
+			errs <- c.err
+		}
+	}()
+	return &rows{block: first, stream: stream, errors: errs, columns: first.ColumnsNames(), structMap: &structMap{}}
+}
+
+func (c *blockConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	if c.queryErr != nil {
+		return nil, c.queryErr
+	}
+	return c.newRows(ctx), nil
+}
+
+func (c *blockConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	if c.queryErr != nil {
+		return &row{err: c.queryErr}
+	}
+	return &row{rows: c.newRows(ctx)}
+}
+
+type iterRecord struct {
+	ID   int64  `ch:"id"`
+	Name string `ch:"name"`
+}
+
+func TestQueryIter(t *testing.T) {
+	conn := &blockConn{blocks: [][]int64{{1, 2}, {}, {3}, {4, 5}}}
+	var ids []int64
+	for record, err := range QueryIter[iterRecord](context.Background(), conn, "SELECT id, name FROM t") {
+		require.NoError(t, err)
+		assert.Equal(t, "row", record.Name)
+		ids = append(ids, record.ID)
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+
+	// the iterator can be ranged again, which runs the query again
+	count := 0
+	for _, err := range QueryIter[iterRecord](context.Background(), conn, "SELECT id, name FROM t") {
+		require.NoError(t, err)
+		count++
+	}
+	assert.Equal(t, 5, count)
+	assert.Equal(t, 2, conn.queries)
+}
+
+func TestQueryIterBreak(t *testing.T) {
+	conn := &blockConn{blocks: [][]int64{{1, 2}, {3}, {4}, {5}}}
+	var ids []int64
+	for record, err := range QueryIter[iterRecord](context.Background(), conn, "SELECT id, name FROM t") {
+		require.NoError(t, err)
+		ids = append(ids, record.ID)
+		if record.ID == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+	// the remaining blocks were cancelled rather than read
+	assert.ErrorIs(t, conn.ctx.Err(), context.Canceled)
+}
+
+func TestQueryIterErrors(t *testing.T) {
+	boom := errors.New("boom")
+
+	conn := &blockConn{queryErr: boom}
+	var errs []error
+	for _, err := range QueryIter[iterRecord](context.Background(), conn, "SELECT id, name FROM t") {
+		errs = append(errs, err)
+	}
+	assert.Equal(t, []error{boom}, errs)
+
+	conn = &blockConn{blocks: [][]int64{{1}, {2}}, err: boom}
+	var ids []int64
+	errs = nil
+	for record, err := range QueryIter[iterRecord](context.Background(), conn, "SELECT id, name FROM t") {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ids = append(ids, record.ID)
+	}
+	assert.Equal(t, []int64{1, 2}, ids)
+	assert.Equal(t, []error{boom}, errs)
+
+	// a scan error ends the iteration
+	errs = nil
+	conn = &blockConn{blocks: [][]int64{{1, 2}}}
+	for _, err := range QueryIter[struct{ Missing string }](context.Background(), conn, "SELECT id, name FROM t") {
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	assert.Error(t, errs[0])
+}
+
+func TestQueryIterScalar(t *testing.T) {
+	conn := &blockConn{blocks: [][]int64{{7, 8}, {9}}, idOnly: true}
+	var ids []int64
+	for id, err := range QueryIter[int64](context.Background(), conn, "SELECT id FROM t") {
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int64{7, 8, 9}, ids)
+
+	id, err := QueryOne[int64](context.Background(), conn, "SELECT id FROM t")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), id)
+
+	assert.True(t, scanAsStruct[iterRecord]())
+	assert.False(t, scanAsStruct[int64]())
+	assert.False(t, scanAsStruct[time.Time]())
+	assert.False(t, scanAsStruct[sql.NullString]())
+	assert.False(t, scanAsStruct[*iterRecord]())
+}
+
+func TestQueryOne(t *testing.T) {
+	conn := &blockConn{blocks: [][]int64{{42, 43}}}
+	record, err := QueryOne[iterRecord](context.Background(), conn, "SELECT id, name FROM t")
+	require.NoError(t, err)
+	assert.Equal(t, iterRecord{ID: 42, Name: "row"}, record)
+
+	conn = &blockConn{}
+	_, err = QueryOne[iterRecord](context.Background(), conn, "SELECT id, name FROM t")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	boom := errors.New("boom")
+	conn = &blockConn{queryErr: boom}
+	_, err = QueryOne[iterRecord](context.Background(), conn, "SELECT id, name FROM t")
+	assert.ErrorIs(t, err, boom)
+}
@@ -0,0 +1,157 @@
+package clickhouse
+
+import (
+	"context"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy makes Query, Exec, Select and Batch.Send retry failed attempts
+// on transient errors such as connection resets or server timeouts. Each
+// attempt acquires a fresh connection from the pool.
+//
+// Retrying re-executes the statement, so only enable it when the statements
+// issued through the connection are idempotent, or when the target tables
+// deduplicate repeated inserts. A batch is only retried if none of its rows
+// were sent by an earlier Flush, unless it was prepared with
+// driver.WithInsertDeduplicationToken.
+//
+// Once a policy is set, failed calls return a *RetryError carrying the number
+// of attempts made; the final cause remains reachable with errors.Is/As.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one.
+	// Values below 2 disable retrying.
+	MaxAttempts int
+	// Backoff returns the delay before the given retry, counted from 1.
+	// Defaults to ExponentialBackoff(100*time.Millisecond, 5*time.Second).
+	Backoff func(retry int) time.Duration
+	// Retryable classifies errors as transient. Defaults to IsRetryableError.
+	Retryable func(err error) bool
+}
+
+// ExponentialBackoff returns a RetryPolicy.Backoff doubling the delay from
+// initial up to max, with up to 50% random jitter to spread out retries of
+// concurrent callers.
+func ExponentialBackoff(initial, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		delay := initial
+		for i := 1; i < retry && delay < max; i++ {
+			delay *= 2
+		}
+		delay = min(delay, max)
+		if delay <= 0 {
+			return 0
+		}
+		return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+}
+
+var defaultRetryBackoff = ExponentialBackoff(100*time.Millisecond, 5*time.Second)
+
+// Server error codes that are worth retrying.
+const (
+	exceptionCodeSocketTimeout = 209
+	exceptionCodeNetworkError  = 210
+)
+
+// IsRetryableError reports whether err is a transient failure: a broken or
+// reset connection, a network timeout, a SOCKET_TIMEOUT (209) or
+// NETWORK_ERROR (210) server exception, or an HTTP 503 response. Context
+// cancellation and deadline errors are never retryable.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if exception := new(Exception); errors.As(err, &exception) {
+		return exception.Code == exceptionCodeSocketTimeout || exception.Code == exceptionCodeNetworkError
+	}
+	if httpErr := new(HTTPError); errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusServiceUnavailable
+	}
+	switch {
+	case errors.Is(err, sqldriver.ErrBadConn),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, net.ErrClosed),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// RetryError is returned by operations covered by Options.RetryPolicy once
+// they fail for good. Err is the error of the last attempt.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	if e.Attempts == 1 {
+		return fmt.Sprintf("clickhouse [retry]: failed after 1 attempt: %s", e.Err)
+	}
+	return fmt.Sprintf("clickhouse [retry]: failed after %d attempts: %s", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error { return e.Err }
+
+func (p *RetryPolicy) enabled() bool {
+	return p != nil && p.MaxAttempts > 1
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	if p.Backoff != nil {
+		return p.Backoff(retry)
+	}
+	return defaultRetryBackoff(retry)
+}
+
+// do runs fn until it succeeds, fails with a non-retryable error, or the
+// attempts are exhausted. fn is called once, unwrapped, when retries are
+// disabled.
+func (p *RetryPolicy) do(ctx context.Context, logger *slog.Logger, op string, fn func() error) error {
+	if !p.enabled() {
+		return fn()
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.MaxAttempts || !p.retryable(err) {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+		delay := p.backoff(attempt)
+		logger.Debug("retrying after transient error",
+			slog.String("op", op),
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", delay),
+			slog.Any("error", err))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &RetryError{Attempts: attempt, Err: fmt.Errorf("%w (retry aborted: %w)", err, context.Cause(ctx))}
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package clickhouse
+
+import (
+	"context"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	retryable := []error{
+		sqldriver.ErrBadConn,
+		io.EOF,
+		fmt.Errorf("read: %w", syscall.ECONNRESET),
+		&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+		&Exception{Code: 209, Message: "Timeout exceeded while reading from socket"},
+		fmt.Errorf("wrapped: %w", &Exception{Code: 210, Message: "Connection reset by peer"}),
+		&HTTPError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("overloaded")},
+	}
+	for _, err := range retryable {
+		assert.True(t, IsRetryableError(err), err.Error())
+	}
+	notRetryable := []error{
+		nil,
+		errors.New("boom"),
+		context.Canceled,
+		fmt.Errorf("%w: %w", context.DeadlineExceeded, io.EOF),
+		&Exception{Code: 60, Message: "Table doesn't exist"},
+		&HTTPError{StatusCode: http.StatusNotFound, Err: errors.New("not found")},
+		ErrAcquireConnTimeout,
+	}
+	for _, err := range notRetryable {
+		assert.False(t, IsRetryableError(err), fmt.Sprint(err))
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second)
+	for retry, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		delay := backoff(retry)
+		assert.GreaterOrEqual(t, delay, limit/2, retry)
+		assert.LessOrEqual(t, delay, limit, retry)
+	}
+	assert.Zero(t, ExponentialBackoff(0, time.Second)(3))
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		logger    = newNoopLogger()
+		transient = fmt.Errorf("read: %w", syscall.ECONNRESET)
+		noBackoff = func(int) time.Duration { return 0 }
+	)
+
+	t.Run("disabled", func(t *testing.T) {
+		var policy *RetryPolicy
+		calls := 0
+		err := policy.do(ctx, logger, "test", func() error { calls++; return transient })
+		assert.Same(t, transient, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		policy := &RetryPolicy{MaxAttempts: 3, Backoff: noBackoff}
+		calls := 0
+		err := policy.do(ctx, logger, "test", func() error {
+			if calls++; calls < 3 {
+				return transient
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		policy := &RetryPolicy{MaxAttempts: 4, Backoff: noBackoff}
+		calls := 0
+		err := policy.do(ctx, logger, "test", func() error { calls++; return transient })
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, 4, retryErr.Attempts)
+		assert.Equal(t, 4, calls)
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Contains(t, err.Error(), "failed after 4 attempts")
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		policy := &RetryPolicy{MaxAttempts: 4, Backoff: noBackoff}
+		calls := 0
+		boom := errors.New("boom")
+		err := policy.do(ctx, logger, "test", func() error { calls++; return boom })
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, 1, retryErr.Attempts)
+		assert.Equal(t, 1, calls)
+		assert.ErrorIs(t, err, boom)
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		boom := errors.New("boom")
+		policy := &RetryPolicy{
+			MaxAttempts: 2,
+			Backoff:     noBackoff,
+			Retryable:   func(err error) bool { return errors.Is(err, boom) },
+		}
+		calls := 0
+		err := policy.do(ctx, logger, "test", func() error { calls++; return boom })
+		assert.ErrorIs(t, err, boom)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("context cancelled during backoff", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		policy := &RetryPolicy{MaxAttempts: 5, Backoff: func(int) time.Duration { return time.Hour }}
+		calls := 0
+		err := policy.do(ctx, logger, "test", func() error { calls++; cancel(); return transient })
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, 1, retryErr.Attempts)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+	})
+}
+
+func TestRetryPolicyRedialsConnection(t *testing.T) {
+	var dials atomic.Int32
+	conn, err := Open(&Options{
+		Addr: []string{"127.0.0.1:9000"},
+		DialContext: func(ctx context.Context, addr string) (net.Conn, error) {
+			dials.Add(1)
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		},
+		RetryPolicy: &RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     func(int) time.Duration { return 0 },
+		},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = conn.Exec(context.Background(), "SELECT 1")
+	var retryErr *RetryError
+	require.ErrorAs(t, err, &retryErr)
+	assert.Equal(t, 3, retryErr.Attempts)
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.Equal(t, int32(3), dials.Load())
+
+	dials.Store(0)
+	var dest []struct{ N uint8 }
+	err = conn.Select(context.Background(), &dest, "SELECT 1 AS N")
+	require.ErrorAs(t, err, &retryErr)
+	assert.Equal(t, 3, retryErr.Attempts)
+	assert.Equal(t, int32(3), dials.Load())
+}
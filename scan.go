@@ -59,7 +59,13 @@ func scanSelect(queryFunc scanSelectQueryFunc, ctx context.Context, dest any, qu
 }
 
 func (ch *clickhouse) Select(ctx context.Context, dest any, query string, args ...any) error {
-	return scanSelect(ch.Query, ctx, dest, query, args...)
+	ctx, op := ch.opt.instrumentation.start(ctx, "select", query)
+	// scanSelect empties dest first, so a retried attempt never sees rows of a failed one
+	err := ch.opt.RetryPolicy.do(ctx, ch.opt.logger(), "select", func() error {
+		return scanSelect(ch.query, ctx, dest, query, args...)
+	})
+	op.end(err)
+	return err
 }
 
 func scan(block *proto.Block, row int, dest ...any) error {
@@ -0,0 +1,343 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ClickHouse/ch-go/proto"
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/cityhash102"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Shard is a shard of a cluster, as in the remote_servers configuration of
+// the server.
+type Shard struct {
+	// Addr holds the addresses of the replicas of the shard.
+	Addr []string
+	// Weight is the share of the rows written to the shard, 1 by default.
+	Weight int
+}
+
+// ShardedConn holds a connection pool for each shard of a cluster, to insert
+// into the local tables of the shards rather than through a Distributed
+// table, which saves the server from splitting and forwarding the blocks.
+type ShardedConn struct {
+	shards []driver.Conn
+	// slots maps the remainder of the sharding key divided by the total
+	// weight of the shards to a shard, like the Distributed engine does.
+	slots []int
+}
+
+// OpenSharded opens a connection pool for each shard with opt, its Addr
+// replaced by the addresses of the shard.
+func OpenSharded(opt *Options, shards []Shard) (*ShardedConn, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("clickhouse: a sharded connection needs at least one shard")
+	}
+	if opt == nil {
+		opt = &Options{}
+	}
+	c := &ShardedConn{shards: make([]driver.Conn, 0, len(shards))}
+	for i, shard := range shards {
+		weight := shard.Weight
+		switch {
+		case len(shard.Addr) == 0:
+			err := fmt.Errorf("clickhouse: shard %d has no address", i)
+			return nil, errors.Join(err, c.Close())
+		case weight < 0:
+			err := fmt.Errorf("clickhouse: shard %d has a negative weight %d", i, weight)
+			return nil, errors.Join(err, c.Close())
+		case weight == 0:
+			weight = 1
+		}
+		o := *opt
+		o.Addr = shard.Addr
+		conn, err := Open(&o)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("clickhouse: shard %d: %w", i, err), c.Close())
+		}
+		c.shards = append(c.shards, conn)
+		for range weight {
+			c.slots = append(c.slots, i)
+		}
+	}
+	return c, nil
+}
+
+// Shards returns the number of shards.
+func (c *ShardedConn) Shards() int {
+	return len(c.shards)
+}
+
+// Shard returns the connection pool of shard i.
+func (c *ShardedConn) Shard(i int) driver.Conn {
+	return c.shards[i]
+}
+
+// Close closes the connection pools of all shards.
+func (c *ShardedConn) Close() error {
+	var errs []error
+	for i, conn := range c.shards {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("clickhouse: shard %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ShardingHash is the function of the sharding key of a Distributed table
+// applied to a column.
+type ShardingHash int
+
+const (
+	// CityHash64 computes cityHash64(column).
+	CityHash64 ShardingHash = iota
+	// XXHash64 computes xxHash64(column).
+	XXHash64
+	// NoHash uses the value of an integer column as the sharding key.
+	NoHash
+)
+
+func (h ShardingHash) String() string {
+	switch h {
+	case CityHash64:
+		return "cityHash64"
+	case XXHash64:
+		return "xxHash64"
+	case NoHash:
+		return "identity"
+	}
+	return fmt.Sprintf("ShardingHash(%d)", int(h))
+}
+
+// ShardingKey is the sharding key of a Distributed table, such as
+// cityHash64(user_id), for which Column is "user_id" and Hash CityHash64.
+//
+// The key column can be a string, a fixed string or a number, date, enum, IP
+// or UUID, possibly Nullable or LowCardinality; rows with a NULL key are
+// rejected.
+type ShardingKey struct {
+	Column string
+	Hash   ShardingHash
+}
+
+// PrepareBatch prepares an INSERT on each shard and returns a batch routing
+// the rows to the shards by key. The query should insert into the local
+// table of the shards, the Distributed table being defined with the same
+// sharding key and shard weights so it reads the rows where they belong.
+// The shard batches are prepared with opts as by PrepareParallelBatch.
+func (c *ShardedConn) PrepareBatch(ctx context.Context, query string, key ShardingKey, opts ...driver.PrepareBatchOption) (*ShardedBatch, error) {
+	batch, err := prepareParallelBatch(len(c.shards), func(i int) (driver.Batch, error) {
+		return c.shards[i].PrepareBatch(ctx, query, shardBatchOptions(i, opts)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b, err := newShardedBatch(batch, c.slots, key, getPrepareBatchOptions(opts...).OmitDefaultColumns)
+	if err != nil {
+		return nil, errors.Join(err, batch.Abort())
+	}
+	return b, nil
+}
+
+// ShardedBatch is a ParallelBatch with a shard for each shard of a cluster,
+// its rows being appended to the shard of their sharding key.
+type ShardedBatch struct {
+	*ParallelBatch
+	key      ShardingKey
+	slots    []int
+	columns  []string
+	defaults []driver.ColumnDefault
+	// omitDefaults lets the first row leave out the columns with a default (WithOmitDefaultColumns).
+	omitDefaults bool
+	structs      structMap
+
+	mu     sync.Mutex
+	value  column.Interface // holds the key of the row being routed
+	buffer proto.Buffer
+}
+
+func newShardedBatch(batch *ParallelBatch, slots []int, key ShardingKey, omitDefaults bool) (*ShardedBatch, error) {
+	b := &ShardedBatch{
+		ParallelBatch: batch,
+		key:           key,
+		slots:         slots,
+		omitDefaults:  omitDefaults,
+	}
+	if defaults, ok := batch.Shard(0).(driver.DefaultsBatch); ok {
+		b.defaults = defaults.ColumnDefaults()
+	}
+	if key.Hash < CityHash64 || key.Hash > NoHash {
+		return nil, fmt.Errorf("clickhouse: unknown sharding hash %s", key.Hash)
+	}
+	for _, col := range batch.Shard(0).Columns() {
+		b.columns = append(b.columns, col.Name())
+		if col.Name() != key.Column {
+			continue
+		}
+		chType := col.Type()
+		for {
+			if base, ok := strings.CutPrefix(string(chType), "LowCardinality("); ok {
+				chType = column.Type(strings.TrimSuffix(base, ")"))
+				continue
+			}
+			if base, ok := strings.CutPrefix(string(chType), "Nullable("); ok {
+				chType = column.Type(strings.TrimSuffix(base, ")"))
+				continue
+			}
+			break
+		}
+		var err error
+		if b.value, err = chType.Column(key.Column, &column.ServerContext{}); err != nil {
+			return nil, err
+		}
+		switch b.value.(type) {
+		case *column.String, *column.FixedString,
+			*column.Int8, *column.Int16, *column.Int32, *column.Int64,
+			*column.UInt8, *column.UInt16, *column.UInt32, *column.UInt64,
+			*column.BigInt, *column.Float32, *column.Float64, *column.Bool, *column.Decimal,
+			*column.Date, *column.Date32, *column.DateTime, *column.DateTime64,
+			*column.Enum8, *column.Enum16, *column.IPv4, *column.IPv6, *column.UUID:
+		default:
+			return nil, fmt.Errorf("clickhouse: sharding key column %s of type %s is not supported", key.Column, col.Type())
+		}
+		if key.Hash == NoHash {
+			switch b.value.(type) {
+			case *column.Int8, *column.Int16, *column.Int32, *column.Int64,
+				*column.UInt8, *column.UInt16, *column.UInt32, *column.UInt64:
+			default:
+				return nil, fmt.Errorf("clickhouse: sharding key column %s of type %s is not an integer", key.Column, col.Type())
+			}
+		}
+	}
+	if b.value == nil {
+		return nil, fmt.Errorf("clickhouse: sharding key column %s is not inserted", key.Column)
+	}
+	return b, nil
+}
+
+// Append appends a row to the shard of its sharding key.
+func (b *ShardedBatch) Append(v ...any) error {
+	columns := b.columns
+	if b.omitDefaults && len(v) < len(columns) {
+		// the first row may leave out the columns with a default
+		if required := insertColumnsForValues(columns, b.defaults, len(v)); required != nil {
+			columns = required
+		}
+	}
+	i := slices.Index(columns, b.key.Column)
+	if i < 0 || i >= len(v) {
+		return fmt.Errorf("clickhouse: the row has no value for the sharding key column %s", b.key.Column)
+	}
+	shard, err := b.shardOf(v[i])
+	if err != nil {
+		return err
+	}
+	return b.appendTo(shard, func(batch driver.Batch) error { return batch.Append(v...) })
+}
+
+// AppendStruct appends a row from the fields of a struct to the shard of its
+// sharding key.
+func (b *ShardedBatch) AppendStruct(v any) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr {
+		return &OpError{
+			Op:  "AppendStruct",
+			Err: errors.New("must pass a pointer, not a value, to AppendStruct destination"),
+		}
+	}
+	if value.IsNil() {
+		return &OpError{
+			Op:  "AppendStruct",
+			Err: errors.New("nil pointer passed to AppendStruct destination"),
+		}
+	}
+	index, found := b.structs.fields(v)[b.key.Column]
+	if !found {
+		return fmt.Errorf("clickhouse: %T has no field for the sharding key column %s", v, b.key.Column)
+	}
+	// the field is behind a nil embedded struct pointer
+	field, err := value.Elem().FieldByIndexErr(index)
+	if err != nil {
+		return &OpError{
+			Op:  "AppendStruct",
+			Err: fmt.Errorf("sharding key column %s: %w", b.key.Column, err),
+		}
+	}
+	shard, err := b.shardOf(field.Interface())
+	if err != nil {
+		return err
+	}
+	return b.appendTo(shard, func(batch driver.Batch) error { return batch.AppendStruct(v) })
+}
+
+// shardOf returns the shard of a row from the value of its sharding key
+// column.
+func (b *ShardedBatch) shardOf(v any) (int, error) {
+	key, err := b.keyOf(v)
+	if err != nil {
+		return 0, err
+	}
+	return b.slots[key%uint64(len(b.slots))], nil
+}
+
+// keyOf returns the sharding key of a row from the value of its sharding key
+// column, which is hashed as encoded in a block, so the same way as by the
+// server.
+func (b *ShardedBatch) keyOf(v any) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if rv := reflect.ValueOf(v); v == nil || rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return 0, fmt.Errorf("clickhouse: sharding key column %s is NULL", b.key.Column)
+	}
+	b.value.Reset()
+	b.buffer.Reset()
+	if err := b.value.AppendRow(v); err != nil {
+		return 0, fmt.Errorf("clickhouse: sharding key column %s: %w", b.key.Column, err)
+	}
+	b.value.Encode(&b.buffer)
+	data, bytes := b.buffer.Buf, false
+	switch b.value.(type) {
+	case *column.String:
+		// skip the length of the string
+		_, n := binary.Uvarint(data)
+		data, bytes = data[n:], true
+	case *column.FixedString:
+		bytes = true
+	}
+	var key uint64
+	switch {
+	case b.key.Hash == XXHash64:
+		key = xxhash.Sum64(data)
+	case bytes, len(data) > 8:
+		key = cityhash102.CityHash64(data, uint32(len(data)))
+	default:
+		// the value is zero-extended to 64 bits
+		var value [8]byte
+		copy(value[:], data)
+		key = binary.LittleEndian.Uint64(value[:])
+		if b.key.Hash == CityHash64 {
+			key = intHash64(key)
+		}
+	}
+	return key, nil
+}
+
+// intHash64 is the hash the server applies to numbers with cityHash64.
+func intHash64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,124 @@
+package clickhouse
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/cityhash102"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func testShardedConn(t *testing.T, columns ...string) (*ShardedConn, []*fakeBatchConn) {
+	fakes := []*fakeBatchConn{newFakeBatchConn(t, columns...), newFakeBatchConn(t, columns...)}
+	// the second shard has a weight of 2
+	return &ShardedConn{shards: []driver.Conn{fakes[0], fakes[1]}, slots: []int{0, 1, 1}}, fakes
+}
+
+func TestShardedBatch(t *testing.T) {
+	conn, fakes := testShardedConn(t, "id", "Int32", "name", "LowCardinality(Nullable(String))")
+	batch, err := conn.PrepareBatch(t.Context(), "INSERT INTO t", ShardingKey{Column: "name"}, driver.WithInsertDeduplicationToken("load"))
+	require.NoError(t, err)
+	assert.Equal(t, "load/1", fakes[1].prepared()[0].InsertDeduplicationToken)
+
+	shardOf := func(name string) int {
+		return []int{0, 1, 1}[cityhash102.CityHash64([]byte(name), uint32(len(name)))%3]
+	}
+	expected := make([][]any, 2)
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("name_%d", i)
+		require.NoError(t, batch.Append(int32(i), name))
+		expected[shardOf(name)] = append(expected[shardOf(name)], []any{int32(i), name})
+	}
+	row := &struct {
+		ID   int32   `ch:"id"`
+		Name *string `ch:"name"`
+	}{ID: 100, Name: new(string)}
+	*row.Name = "name_100"
+	require.NoError(t, batch.AppendStruct(row))
+	expected[shardOf("name_100")] = append(expected[shardOf("name_100")], row)
+	// the shards get about a third and two thirds of the rows
+	assert.InDelta(t, 34, len(expected[0]), 10)
+
+	assert.ErrorContains(t, batch.Append(int32(101), nil), "NULL")
+	assert.ErrorContains(t, batch.Append(int32(101)), "no value")
+	assert.ErrorContains(t, batch.AppendStruct(&struct{ ID int32 }{}), "no field")
+	assert.ErrorContains(t, batch.AppendStruct(*row), "must pass a pointer")
+	assert.ErrorContains(t, batch.AppendStruct((*struct {
+		Name string `ch:"name"`
+	})(nil)), "nil pointer")
+	type named struct {
+		Name string `ch:"name"`
+	}
+	assert.ErrorContains(t, batch.AppendStruct(&struct {
+		ID int32 `ch:"id"`
+		*named
+	}{ID: 101}), "sharding key column name")
+
+	results, err := batch.Send()
+	require.NoError(t, err)
+	for i, fake := range fakes {
+		assert.Equal(t, [][]any{expected[i]}, fake.batches())
+		assert.Equal(t, len(expected[i]), results[i].Rows)
+	}
+}
+
+func TestShardedBatchErrors(t *testing.T) {
+	conn, _ := testShardedConn(t, "id", "Int32", "tags", "Array(String)", "value", "Float64")
+	for key, err := range map[ShardingKey]string{
+		{Column: "missing"}:              "is not inserted",
+		{Column: "tags"}:                 "is not supported",
+		{Column: "value", Hash: NoHash}:  "is not an integer",
+		{Column: "id", Hash: NoHash + 1}: "unknown sharding hash",
+	} {
+		_, prepareErr := conn.PrepareBatch(t.Context(), "INSERT INTO t", key)
+		assert.ErrorContains(t, prepareErr, err)
+	}
+
+	_, err := OpenSharded(nil, nil)
+	assert.Error(t, err)
+	_, err = OpenSharded(nil, []Shard{{Addr: []string{"127.0.0.1:9000"}}, {}})
+	assert.ErrorContains(t, err, "shard 1 has no address")
+}
+
+func TestShardingKey(t *testing.T) {
+	id := uuid.New()
+	uuidBytes := make([]byte, 16)
+	// a UUID is encoded as its two halves in little endian
+	binary.LittleEndian.PutUint64(uuidBytes, binary.BigEndian.Uint64(id[:8]))
+	binary.LittleEndian.PutUint64(uuidBytes[8:], binary.BigEndian.Uint64(id[8:]))
+	for _, tc := range []struct {
+		chType string
+		hash   ShardingHash
+		value  any
+		key    uint64
+	}{
+		{"String", CityHash64, "", 11160318154034397263},
+		{"String", XXHash64, "", 17241709254077376921},
+		{"String", CityHash64, "abc", cityhash102.CityHash64([]byte("abc"), 3)},
+		{"String", XXHash64, "abc", xxhash.Sum64String("abc")},
+		{"FixedString(4)", CityHash64, "ab", cityhash102.CityHash64([]byte("ab\x00\x00"), 4)},
+		{"Int8", NoHash, int8(-1), 255},
+		{"Int64", NoHash, int64(-1), 1<<64 - 1},
+		{"UInt32", NoHash, 42, 42},
+		{"UInt16", CityHash64, uint16(7), intHash64(7)},
+		{"Int16", CityHash64, int16(-1), intHash64(0xffff)},
+		{"UInt16", XXHash64, uint16(1), xxhash.Sum64([]byte{1, 0})},
+		{"Enum8('a' = 1, 'b' = 2)", CityHash64, "b", intHash64(2)},
+		{"UUID", CityHash64, id, cityhash102.CityHash64(uuidBytes, 16)},
+	} {
+		t.Run(fmt.Sprintf("%s(%s)", tc.hash, tc.chType), func(t *testing.T) {
+			conn, _ := testShardedConn(t, "key", tc.chType)
+			batch, err := conn.PrepareBatch(t.Context(), "INSERT INTO t", ShardingKey{Column: "key", Hash: tc.hash})
+			require.NoError(t, err)
+			key, err := batch.keyOf(tc.value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.key, key)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package clickhouse
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+// sshAuthMarker is prepended to the username in the hello of connections
+// authenticating with an SSH key, as the server expects.
+const sshAuthMarker = " SSH KEY AUTHENTICATION "
+
+// sshChallenge performs the challenge-response of SSH key authentication
+// after the hello: the server sends a challenge, which is signed along with
+// the protocol version, database and username.
+func (c *connect) sshChallenge(auth Auth) error {
+	c.buffer.PutByte(proto.ClientSSHChallengeRequest)
+	if err := c.flush(); err != nil {
+		return fmt.Errorf("handshake: failed to request SSH challenge from %s (conn_id=%d): %w",
+			c.conn.RemoteAddr(), c.id, err)
+	}
+	packet, err := c.reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("handshake: failed to read SSH challenge from %s (conn_id=%d): %w",
+			c.conn.RemoteAddr(), c.id, err)
+	}
+	switch packet {
+	case proto.ServerSSHChallenge:
+	case proto.ServerException:
+		return c.exception()
+	default:
+		return fmt.Errorf("[handshake] unexpected packet [%d] from server, expected SSH challenge", packet)
+	}
+	challenge, err := c.reader.Str()
+	if err != nil {
+		return fmt.Errorf("handshake: failed to read SSH challenge from %s (conn_id=%d): %w",
+			c.conn.RemoteAddr(), c.id, err)
+	}
+
+	message := strconv.Itoa(ClientTCPProtocolVersion) + auth.Database + auth.Username + challenge
+	signature, err := signSSH(auth.SSHSigner, []byte(message))
+	if err != nil {
+		return fmt.Errorf("handshake: failed to sign SSH challenge: %w", err)
+	}
+	c.buffer.PutByte(proto.ClientSSHChallengeResponse)
+	c.buffer.PutString(string(signature))
+	if err := c.flush(); err != nil {
+		return fmt.Errorf("handshake: failed to send SSH signature to %s (conn_id=%d): %w",
+			c.conn.RemoteAddr(), c.id, err)
+	}
+	return nil
+}
+
+// signSSH signs message with signer, returning the signature in the SSH wire
+// format.
+func signSSH(signer ssh.Signer, message []byte) ([]byte, error) {
+	var (
+		signature *ssh.Signature
+		err       error
+	)
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// RSA keys sign with SHA-1 by default, which is deprecated
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, message, ssh.KeyAlgoRSASHA512)
+	} else {
+		signature, err = signer.Sign(rand.Reader, message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ssh.Marshal(signature), nil
+}
@@ -0,0 +1,106 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	chproto "github.com/ClickHouse/ch-go/proto"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+// fakeSSHAuth returns an Options.DialContext to a fake server accepting the
+// users signing its challenge with key. The signature algorithms used are
+// sent to algorithms.
+func fakeSSHAuth(key ssh.PublicKey, algorithms chan<- string) func(ctx context.Context, addr string) (net.Conn, error) {
+	return fakeNativeServer(func(c *fakeNativeConn) {
+		if c.user != sshAuthMarker+"user" {
+			c.reject("not an SSH key user")
+			return
+		}
+		if packet, err := c.reader.ReadByte(); err != nil || packet != proto.ClientSSHChallengeRequest {
+			return
+		}
+		var buffer chproto.Buffer
+		buffer.PutByte(proto.ServerSSHChallenge)
+		buffer.PutString("challenge")
+		_, _ = c.Write(buffer.Buf)
+		if packet, err := c.reader.ReadByte(); err != nil || packet != proto.ClientSSHChallengeResponse {
+			return
+		}
+		blob, err := c.reader.Str()
+		if err != nil {
+			return
+		}
+		var signature ssh.Signature
+		if err := ssh.Unmarshal([]byte(blob), &signature); err != nil {
+			c.reject(err.Error())
+			return
+		}
+		algorithms <- signature.Format
+		message := strconv.Itoa(ClientTCPProtocolVersion) + c.database + "user" + "challenge"
+		if err := key.Verify([]byte(message), &signature); err != nil {
+			c.reject(err.Error())
+			return
+		}
+		c.accept()
+	})
+}
+
+func TestSSHAuth(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		key       any
+		algorithm string
+	}{
+		{"ed25519", edKey, ssh.KeyAlgoED25519},
+		{"rsa", rsaKey, ssh.KeyAlgoRSASHA512},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			signer, err := ssh.NewSignerFromKey(tc.key)
+			require.NoError(t, err)
+			algorithms := make(chan string, 1)
+			opt := (&Options{
+				Auth:        Auth{Database: "db", Username: "user", SSHSigner: signer},
+				DialContext: fakeSSHAuth(signer.PublicKey(), algorithms),
+			}).setDefaults()
+			conn, err := dial(context.Background(), "fake:9000", 1, opt)
+			require.NoError(t, err)
+			conn.close()
+			assert.Equal(t, tc.algorithm, <-algorithms)
+		})
+	}
+
+	// a key the user is not identified with is rejected
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(edKey)
+	require.NoError(t, err)
+	other, err := ssh.NewSignerFromKey(otherKey)
+	require.NoError(t, err)
+	opt := (&Options{
+		Auth:        Auth{Username: "user", SSHSigner: other},
+		DialContext: fakeSSHAuth(signer.PublicKey(), make(chan string, 1)),
+	}).setDefaults()
+	_, err = dial(context.Background(), "fake:9000", 1, opt)
+	exception := new(Exception)
+	require.ErrorAs(t, err, &exception)
+	assert.Equal(t, int32(exceptionCodeAuthenticationFailed), exception.Code)
+
+	_, err = dialHttp(context.Background(), "fake:8123", 1, (&Options{Protocol: HTTP, Auth: Auth{SSHSigner: signer}}).setDefaults())
+	assert.ErrorIs(t, err, ErrSSHAuthNativeOnly)
+}
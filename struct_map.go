@@ -65,6 +65,22 @@ func (m *structMap) Map(op string, columns []string, s any, ptr bool) ([]any, er
 	return values, nil
 }
 
+// fields returns the field indexes of the columns of the struct s points
+// to, or nil if s is not a pointer to a struct.
+func (m *structMap) fields(s any) map[string][]int {
+	t := reflect.TypeOf(s)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	t = t.Elem()
+	if idx, found := m.cache.Load(t); found {
+		return idx.(map[string][]int)
+	}
+	index := structIdx(t)
+	m.cache.Store(t, index)
+	return index
+}
+
 func structIdx(t reflect.Type) map[string][]int {
 	fields := make(map[string][]int)
 	for i := 0; i < t.NumField(); i++ {
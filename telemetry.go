@@ -0,0 +1,341 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Telemetry enables client-side OpenTelemetry instrumentation. Either
+// provider may be nil to skip that signal.
+//
+// With a TracerProvider, Query, Exec, Select, PrepareBatch and Batch.Send
+// create client spans carrying db.system, db.operation.name, db.statement,
+// server.address and the rows and bytes read and written as reported by the
+// server. Unless the context already carries a span set with WithSpan, the
+// client span is also forwarded to the server so that server-side spans join
+// the same trace. Query spans end when the returned Rows are closed.
+//
+// With a MeterProvider the driver records:
+//
+//   - db.client.operation.duration: histogram of operation latency in seconds
+//   - clickhouse.client.network.io: bytes sent and received by the operations
+//   - db.client.connection.count: pooled connections by state (idle, used)
+//   - db.client.connection.max: the MaxOpenConns limit
+type Telemetry struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+}
+
+const instrumentationName = "github.com/ClickHouse/clickhouse-go/v2"
+
+// instrumentation holds the tracer and instruments created from Telemetry.
+// A nil *instrumentation disables telemetry.
+type instrumentation struct {
+	tracer          trace.Tracer
+	meter           metric.Meter
+	duration        metric.Float64Histogram
+	networkIO       metric.Int64Counter
+	connectionCount metric.Int64ObservableUpDownCounter
+	connectionMax   metric.Int64ObservableUpDownCounter
+}
+
+var (
+	attrDBSystem          = attribute.String("db.system", "clickhouse")
+	attrDirectionTransmit = attribute.String("network.io.direction", "transmit")
+	attrDirectionReceive  = attribute.String("network.io.direction", "receive")
+)
+
+func newInstrumentation(t *Telemetry) (*instrumentation, error) {
+	if t == nil || (t.TracerProvider == nil && t.MeterProvider == nil) {
+		return nil, nil
+	}
+	version := fmt.Sprintf("%d.%d.%d", ClientVersionMajor, ClientVersionMinor, ClientVersionPatch)
+	inst := &instrumentation{}
+	if t.TracerProvider != nil {
+		inst.tracer = t.TracerProvider.Tracer(instrumentationName, trace.WithInstrumentationVersion(version))
+	}
+	if t.MeterProvider == nil {
+		return inst, nil
+	}
+	inst.meter = t.MeterProvider.Meter(instrumentationName, metric.WithInstrumentationVersion(version))
+	var err error
+	if inst.duration, err = inst.meter.Float64Histogram("db.client.operation.duration",
+		metric.WithDescription("Duration of database client operations."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 60),
+	); err != nil {
+		return nil, fmt.Errorf("clickhouse [telemetry]: %w", err)
+	}
+	if inst.networkIO, err = inst.meter.Int64Counter("clickhouse.client.network.io",
+		metric.WithDescription("Bytes sent to and received from the server by client operations."),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, fmt.Errorf("clickhouse [telemetry]: %w", err)
+	}
+	if inst.connectionCount, err = inst.meter.Int64ObservableUpDownCounter("db.client.connection.count",
+		metric.WithDescription("The number of connections that are currently in the state described by the state attribute."),
+		metric.WithUnit("{connection}"),
+	); err != nil {
+		return nil, fmt.Errorf("clickhouse [telemetry]: %w", err)
+	}
+	if inst.connectionMax, err = inst.meter.Int64ObservableUpDownCounter("db.client.connection.max",
+		metric.WithDescription("The maximum number of open connections allowed."),
+		metric.WithUnit("{connection}"),
+	); err != nil {
+		return nil, fmt.Errorf("clickhouse [telemetry]: %w", err)
+	}
+	return inst, nil
+}
+
+// registerPool reports the connection counts of ch on every collection.
+// The returned registration must be unregistered when the pool is closed.
+func (i *instrumentation) registerPool(ch *clickhouse) (metric.Registration, error) {
+	if i == nil || i.meter == nil {
+		return nil, nil
+	}
+	pool := attribute.String("db.client.connection.pool.name", strings.Join(ch.opt.Addr, ","))
+	var (
+		idle  = metric.WithAttributes(pool, attribute.String("db.client.connection.state", "idle"))
+		used  = metric.WithAttributes(pool, attribute.String("db.client.connection.state", "used"))
+		limit = metric.WithAttributes(pool)
+	)
+	return i.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(i.connectionCount, int64(ch.idle.Len()), idle)
+		o.ObserveInt64(i.connectionCount, int64(len(ch.open)), used)
+		o.ObserveInt64(i.connectionMax, int64(cap(ch.open)), limit)
+		return nil
+	}, i.connectionCount, i.connectionMax)
+}
+
+// connTelemetry is the per-connection state read by operations: the server
+// address and the bytes transferred over the connection so far.
+type connTelemetry struct {
+	addr     string
+	sent     atomic.Uint64
+	received atomic.Uint64
+}
+
+// countingReader counts the bytes read from r into n.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Uint64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(uint64(n))
+	return n, err
+}
+
+// countingReadCloser is a countingReader for request and response bodies.
+type countingReadCloser struct {
+	countingReader
+	io.Closer
+}
+
+type operationKey struct{}
+
+// operation is a single instrumented client call. All methods are no-ops on
+// a nil *operation, which is what start returns when telemetry is disabled.
+type operation struct {
+	inst  *instrumentation
+	name  string
+	span  trace.Span
+	start time.Time
+
+	mu       sync.Mutex
+	conn     *connTelemetry
+	sent     uint64 // conn.sent when the connection was attached
+	received uint64 // conn.received when the connection was attached
+	ended    bool
+
+	rowsRead     atomic.Uint64
+	bytesRead    atomic.Uint64
+	rowsWritten  atomic.Uint64
+	bytesWritten atomic.Uint64
+	resultRows   atomic.Uint64
+}
+
+// start begins an operation. The returned context carries it to acquire,
+// which attaches the connection the operation runs on.
+func (i *instrumentation) start(ctx context.Context, name string, query string) (context.Context, *operation) {
+	if i == nil {
+		return ctx, nil
+	}
+	op := &operation{inst: i, name: name, start: time.Now()}
+	if i.tracer != nil {
+		ctx, op.span = i.tracer.Start(ctx, "clickhouse."+name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attrDBSystem,
+				attribute.String("db.operation.name", name),
+				attribute.String("db.statement", query),
+			),
+		)
+		ctx = op.hookEvents(ctx)
+	}
+	return context.WithValue(ctx, operationKey{}, op), op
+}
+
+// hookEvents chains the operation's Progress and ProfileInfo handlers in
+// front of the caller's, and forwards the span to the server.
+func (op *operation) hookEvents(ctx context.Context) context.Context {
+	opt, _ := ctx.Value(_contextOptionKey).(QueryOptions)
+	options := []QueryOption{
+		WithProgress(op.progress(opt.events.progress)),
+		WithProfileInfo(op.profileInfo(opt.events.profileInfo)),
+	}
+	if !opt.span.IsValid() {
+		options = append(options, WithSpan(op.span.SpanContext()))
+	}
+	return Context(ctx, options...)
+}
+
+// hookProcess is hookEvents for a batch whose handlers were fixed when it
+// was prepared.
+func (op *operation) hookProcess(on *onProcess) *onProcess {
+	if op == nil || op.span == nil {
+		return on
+	}
+	hooked := *on
+	hooked.progress = op.progress(on.progress)
+	hooked.profileInfo = op.profileInfo(on.profileInfo)
+	return &hooked
+}
+
+func (op *operation) progress(next func(*Progress)) func(*Progress) {
+	return func(p *Progress) {
+		op.rowsRead.Add(p.Rows)
+		op.bytesRead.Add(p.Bytes)
+		op.rowsWritten.Add(p.WroteRows)
+		op.bytesWritten.Add(p.WroteBytes)
+		if next != nil {
+			next(p)
+		}
+	}
+}
+
+func (op *operation) profileInfo(next func(*ProfileInfo)) func(*ProfileInfo) {
+	return func(p *ProfileInfo) {
+		op.resultRows.Add(p.Rows)
+		if next != nil {
+			next(p)
+		}
+	}
+}
+
+func operationFromContext(ctx context.Context) *operation {
+	op, _ := ctx.Value(operationKey{}).(*operation)
+	return op
+}
+
+// attach records the connection the operation runs on. Traffic of a
+// previously attached connection, e.g. of a failed attempt, is kept.
+func (op *operation) attach(conn nativeTransport) {
+	if op == nil {
+		return
+	}
+	tel := conn.telemetry()
+	if tel == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.ended {
+		return
+	}
+	op.recordTraffic()
+	op.conn, op.sent, op.received = tel, tel.sent.Load(), tel.received.Load()
+	if op.span != nil {
+		host, port, err := net.SplitHostPort(tel.addr)
+		if err != nil {
+			host = tel.addr
+		}
+		op.span.SetAttributes(attribute.String("server.address", host))
+		if port, err := strconv.Atoi(port); err == nil {
+			op.span.SetAttributes(attribute.Int("server.port", port))
+		}
+	}
+}
+
+// recordTraffic adds the bytes transferred since the connection was
+// attached to the network.io counter. op.mu must be held.
+func (op *operation) recordTraffic() {
+	if op.conn == nil || op.inst.networkIO == nil {
+		return
+	}
+	var (
+		sent     = op.conn.sent.Load()
+		received = op.conn.received.Load()
+		server   = attribute.String("server.address", op.conn.addr)
+		ctx      = context.Background()
+	)
+	op.inst.networkIO.Add(ctx, int64(sent-op.sent), metric.WithAttributes(attrDBSystem, server, attrDirectionTransmit))
+	op.inst.networkIO.Add(ctx, int64(received-op.received), metric.WithAttributes(attrDBSystem, server, attrDirectionReceive))
+	op.sent, op.received = sent, received
+}
+
+// end finishes the operation with its final error. Only the first call counts.
+func (op *operation) end(err error) {
+	if op == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.ended {
+		return
+	}
+	op.ended = true
+	op.recordTraffic()
+
+	if op.inst.duration != nil {
+		attrs := []attribute.KeyValue{attrDBSystem, attribute.String("db.operation.name", op.name)}
+		if op.conn != nil {
+			attrs = append(attrs, attribute.String("server.address", op.conn.addr))
+		}
+		if err != nil {
+			attrs = append(attrs, attribute.String("error.type", errorType(err)))
+		}
+		op.inst.duration.Record(context.Background(), time.Since(op.start).Seconds(), metric.WithAttributes(attrs...))
+	}
+
+	if op.span == nil {
+		return
+	}
+	op.span.SetAttributes(
+		attribute.Int64("clickhouse.rows_read", int64(op.rowsRead.Load())),
+		attribute.Int64("clickhouse.bytes_read", int64(op.bytesRead.Load())),
+		attribute.Int64("clickhouse.rows_written", int64(op.rowsWritten.Load())),
+		attribute.Int64("clickhouse.bytes_written", int64(op.bytesWritten.Load())),
+	)
+	if rows := op.resultRows.Load(); rows != 0 {
+		op.span.SetAttributes(attribute.Int64("db.response.returned_rows", int64(rows)))
+	}
+	if err != nil {
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	}
+	op.span.End()
+}
+
+// errorType is the error.type attribute of err: the server exception code
+// when there is one, otherwise the Go type of the error.
+func errorType(err error) string {
+	if exception := new(Exception); errors.As(err, &exception) {
+		return strconv.Itoa(int(exception.Code))
+	}
+	return fmt.Sprintf("%T", err)
+}
@@ -0,0 +1,359 @@
+package clickhouse
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricembedded "go.opentelemetry.io/otel/metric/embedded"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	traceembedded "go.opentelemetry.io/otel/trace/embedded"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// fakeTracer records the spans it starts.
+type fakeTracer struct {
+	traceembedded.Tracer
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+type fakeTracerProvider struct {
+	traceembedded.TracerProvider
+	tracer *fakeTracer
+}
+
+func (p fakeTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p.tracer
+}
+
+func (f *fakeTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	config := trace.NewSpanStartConfig(opts...)
+	span := &fakeSpan{
+		name:  name,
+		kind:  config.SpanKind(),
+		attrs: make(map[attribute.Key]attribute.Value),
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{byte(len(f.spans) + 1)},
+			TraceFlags: trace.FlagsSampled,
+		}),
+	}
+	span.SetAttributes(config.Attributes()...)
+	f.spans = append(f.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (f *fakeTracer) lastSpan() *fakeSpan {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.spans) == 0 {
+		return nil
+	}
+	return f.spans[len(f.spans)-1]
+}
+
+type fakeSpan struct {
+	tracenoop.Span
+	name   string
+	kind   trace.SpanKind
+	sc     trace.SpanContext
+	mu     sync.Mutex
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	errs   []error
+	ended  int
+}
+
+func (s *fakeSpan) SpanContext() trace.SpanContext { return s.sc }
+
+func (s *fakeSpan) SetAttributes(attrs ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *fakeSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+
+func (s *fakeSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+
+func (s *fakeSpan) End(...trace.SpanEndOption) { s.ended++ }
+
+func (s *fakeSpan) attr(key string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attrs[attribute.Key(key)].AsInterface()
+}
+
+// fakeMeter records measurements by instrument name.
+type fakeMeter struct {
+	metricnoop.Meter
+	mu        sync.Mutex
+	records   map[string][]attribute.Set
+	sums      map[attribute.Set]int64
+	callbacks []metric.Callback
+}
+
+func newFakeMeter() *fakeMeter {
+	return &fakeMeter{records: make(map[string][]attribute.Set), sums: make(map[attribute.Set]int64)}
+}
+
+type fakeMeterProvider struct {
+	metricnoop.MeterProvider
+	meter *fakeMeter
+}
+
+func (p fakeMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return p.meter
+}
+
+func (f *fakeMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return &fakeHistogram{name: name, meter: f}, nil
+}
+
+func (f *fakeMeter) Int64Counter(string, ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &fakeCounter{meter: f}, nil
+}
+
+func (f *fakeMeter) Int64ObservableUpDownCounter(name string, _ ...metric.Int64ObservableUpDownCounterOption) (metric.Int64ObservableUpDownCounter, error) {
+	return &fakeObservable{name: name}, nil
+}
+
+func (f *fakeMeter) RegisterCallback(callback metric.Callback, _ ...metric.Observable) (metric.Registration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.callbacks = append(f.callbacks, callback)
+	return &fakeRegistration{meter: f, index: len(f.callbacks) - 1}, nil
+}
+
+// collect runs the registered callbacks and returns the observed values
+// keyed by instrument name and connection state.
+func (f *fakeMeter) collect() map[string]int64 {
+	f.mu.Lock()
+	callbacks := f.callbacks
+	f.mu.Unlock()
+	observer := &fakeObserver{values: make(map[string]int64)}
+	for _, callback := range callbacks {
+		if callback != nil {
+			_ = callback(context.Background(), observer)
+		}
+	}
+	return observer.values
+}
+
+func (f *fakeMeter) sum(attrs ...attribute.KeyValue) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sums[attribute.NewSet(attrs...)]
+}
+
+func (f *fakeMeter) recorded(name string) []attribute.Set {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.records[name]
+}
+
+type fakeHistogram struct {
+	metricnoop.Float64Histogram
+	name  string
+	meter *fakeMeter
+}
+
+func (h *fakeHistogram) Record(_ context.Context, _ float64, opts ...metric.RecordOption) {
+	h.meter.mu.Lock()
+	defer h.meter.mu.Unlock()
+	h.meter.records[h.name] = append(h.meter.records[h.name], metric.NewRecordConfig(opts).Attributes())
+}
+
+type fakeCounter struct {
+	metricnoop.Int64Counter
+	meter *fakeMeter
+}
+
+func (c *fakeCounter) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	c.meter.mu.Lock()
+	defer c.meter.mu.Unlock()
+	c.meter.sums[metric.NewAddConfig(opts).Attributes()] += incr
+}
+
+type fakeObservable struct {
+	metricnoop.Int64ObservableUpDownCounter
+	name string
+}
+
+type fakeObserver struct {
+	metricembedded.Observer
+	values map[string]int64
+}
+
+func (o *fakeObserver) ObserveFloat64(metric.Float64Observable, float64, ...metric.ObserveOption) {}
+
+func (o *fakeObserver) ObserveInt64(obsrv metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	key := obsrv.(*fakeObservable).name
+	attrs := metric.NewObserveConfig(opts).Attributes()
+	if state, ok := attrs.Value("db.client.connection.state"); ok {
+		key += "/" + state.AsString()
+	}
+	o.values[key] = value
+}
+
+type fakeRegistration struct {
+	metricembedded.Registration
+	meter *fakeMeter
+	index int
+}
+
+func (r *fakeRegistration) Unregister() error {
+	r.meter.mu.Lock()
+	defer r.meter.mu.Unlock()
+	r.meter.callbacks[r.index] = nil
+	return nil
+}
+
+func openTelemetryMock(t *testing.T, telemetry *Telemetry, transport *mockTransport) *clickhouse {
+	conn, err := Open(&Options{
+		Addr:         []string{"ch-1:9000"},
+		MaxOpenConns: 4,
+		Telemetry:    telemetry,
+		DialStrategy: func(ctx context.Context, connID int, opt *Options, dial Dial) (DialResult, error) {
+			return DialResult{conn: transport}, nil
+		},
+	})
+	require.NoError(t, err)
+	return conn.(*clickhouse)
+}
+
+func TestTelemetryExec(t *testing.T) {
+	var (
+		tracer    = &fakeTracer{}
+		meter     = newFakeMeter()
+		transport = &mockTransport{id: 1, tel: &connTelemetry{addr: "ch-1:9000"}}
+		conn      = openTelemetryMock(t, &Telemetry{TracerProvider: fakeTracerProvider{tracer: tracer}, MeterProvider: fakeMeterProvider{meter: meter}}, transport)
+		query     = "INSERT INTO t VALUES (1)"
+	)
+	defer conn.Close()
+
+	require.NoError(t, conn.Exec(context.Background(), query))
+	span := tracer.lastSpan()
+	require.NotNil(t, span)
+	assert.Equal(t, "clickhouse.exec", span.name)
+	assert.Equal(t, trace.SpanKindClient, span.kind)
+	assert.Equal(t, 1, span.ended)
+	assert.Equal(t, "clickhouse", span.attr("db.system"))
+	assert.Equal(t, query, span.attr("db.statement"))
+	assert.Equal(t, "ch-1", span.attr("server.address"))
+	assert.Equal(t, int64(9000), span.attr("server.port"))
+	assert.Equal(t, codes.Unset, span.status)
+
+	require.Len(t, meter.recorded("db.client.operation.duration"), 1)
+	assert.Equal(t, int64(len(query)), meter.sum(attrDBSystem, attribute.String("server.address", "ch-1:9000"), attrDirectionTransmit))
+
+	transport.execErr = &Exception{Code: 60, Message: "Table doesn't exist"}
+	require.Error(t, conn.Exec(context.Background(), query))
+	span = tracer.lastSpan()
+	assert.Equal(t, 1, span.ended)
+	assert.Equal(t, codes.Error, span.status)
+	require.Len(t, span.errs, 1)
+
+	durations := meter.recorded("db.client.operation.duration")
+	require.Len(t, durations, 2)
+	errorType, ok := durations[1].Value("error.type")
+	require.True(t, ok)
+	assert.Equal(t, "60", errorType.AsString())
+	assert.Equal(t, 2*int64(len(query)), meter.sum(attrDBSystem, attribute.String("server.address", "ch-1:9000"), attrDirectionTransmit))
+}
+
+func TestTelemetryOperationEvents(t *testing.T) {
+	var (
+		tracer      = &fakeTracer{}
+		inst, err   = newInstrumentation(&Telemetry{TracerProvider: fakeTracerProvider{tracer: tracer}})
+		progressed  []*Progress
+		callerCtx   = Context(context.Background(), WithProgress(func(p *Progress) { progressed = append(progressed, p) }))
+		ctx, op     = inst.start(callerCtx, "query", "SELECT 1")
+		options     = queryOptions(ctx)
+		span        = tracer.lastSpan()
+		progressOne = &Progress{Rows: 10, Bytes: 80}
+	)
+	require.NoError(t, err)
+
+	// the client span is forwarded to the server
+	assert.Equal(t, span.SpanContext(), options.span)
+	assert.Same(t, op, operationFromContext(ctx))
+
+	options.events.progress(progressOne)
+	options.events.progress(&Progress{Rows: 5, Bytes: 40, WroteRows: 2, WroteBytes: 16})
+	options.events.profileInfo(&ProfileInfo{Rows: 15})
+	assert.Equal(t, []*Progress{progressOne, {Rows: 5, Bytes: 40, WroteRows: 2, WroteBytes: 16}}, progressed)
+
+	op.end(nil)
+	op.end(assert.AnError)
+	assert.Equal(t, 1, span.ended)
+	assert.Equal(t, codes.Unset, span.status)
+	assert.Equal(t, int64(15), span.attr("clickhouse.rows_read"))
+	assert.Equal(t, int64(120), span.attr("clickhouse.bytes_read"))
+	assert.Equal(t, int64(2), span.attr("clickhouse.rows_written"))
+	assert.Equal(t, int64(16), span.attr("clickhouse.bytes_written"))
+	assert.Equal(t, int64(15), span.attr("db.response.returned_rows"))
+
+	// a span set by the caller is kept
+	callerSpan := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{2}, SpanID: trace.SpanID{2}})
+	ctx, _ = inst.start(Context(context.Background(), WithSpan(callerSpan)), "query", "SELECT 1")
+	assert.Equal(t, callerSpan, queryOptions(ctx).span)
+}
+
+func TestTelemetryDisabled(t *testing.T) {
+	inst, err := newInstrumentation(&Telemetry{})
+	require.NoError(t, err)
+	assert.Nil(t, inst)
+
+	ctx := context.Background()
+	startCtx, op := inst.start(ctx, "query", "SELECT 1")
+	assert.Equal(t, ctx, startCtx)
+	assert.Nil(t, op)
+	op.attach(newMockTransport(1))
+	op.end(nil)
+}
+
+func TestTelemetryRowsClose(t *testing.T) {
+	var ended []error
+	r := &rows{onClose: func(err error) { ended = append(ended, err) }}
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Close())
+	assert.Equal(t, []error{nil}, ended)
+}
+
+func TestTelemetryPoolMetrics(t *testing.T) {
+	var (
+		meter     = newFakeMeter()
+		transport = &mockTransport{id: 1, connectedAt: time.Now()}
+		conn      = openTelemetryMock(t, &Telemetry{MeterProvider: fakeMeterProvider{meter: meter}}, transport)
+	)
+	assert.Equal(t, map[string]int64{
+		"db.client.connection.count/idle": 0,
+		"db.client.connection.count/used": 0,
+		"db.client.connection.max":        4,
+	}, meter.collect())
+
+	acquired, err := conn.acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), meter.collect()["db.client.connection.count/used"])
+
+	conn.release(acquired, nil)
+	values := meter.collect()
+	assert.Equal(t, int64(0), values["db.client.connection.count/used"])
+	assert.Equal(t, int64(1), values["db.client.connection.count/idle"])
+
+	require.NoError(t, conn.Close())
+	assert.Empty(t, meter.collect())
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestAggregateFunction(t *testing.T) {
+	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
+		conn, err := GetNativeConnection(t, protocol, nil, nil, &clickhouse.Compression{
+			Method: clickhouse.CompressionLZ4,
+		})
+		require.NoError(t, err)
+		ctx := context.Background()
+		const ddl = `
+		CREATE TABLE test_aggregate_function (
+			  Col1 UInt64
+			, Col2 AggregateFunction(count)
+			, Col3 AggregateFunction(sum, Int32)
+			, Col4 AggregateFunction(avg, Float64)
+			, Col5 AggregateFunction(uniqExact, String)
+			, Col6 AggregateFunction(argMax, String, UInt32)
+		) Engine AggregatingMergeTree() ORDER BY Col1
+		`
+		defer func() {
+			conn.Exec(ctx, "DROP TABLE IF EXISTS test_aggregate_function")
+		}()
+		require.NoError(t, conn.Exec(ctx, ddl))
+		require.NoError(t, conn.Exec(ctx, `
+		INSERT INTO test_aggregate_function
+		SELECT
+			  number % 2
+			, countState()
+			, sumState(toInt32(number))
+			, avgState(toFloat64(number))
+			, uniqExactState(toString(number % 3))
+			, argMaxState(toString(number), toUInt32(number))
+		FROM numbers(10)
+		GROUP BY number % 2
+		`))
+
+		type stateRow struct {
+			Col1 uint64
+			Col2 []byte
+			Col3 []byte
+			Col4 []byte
+			Col5 []byte
+			Col6 []byte
+		}
+		rows, err := conn.Query(ctx, "SELECT * FROM test_aggregate_function ORDER BY Col1")
+		require.NoError(t, err)
+		var states []stateRow
+		for rows.Next() {
+			var row stateRow
+			require.NoError(t, rows.ScanStruct(&row))
+			states = append(states, row)
+		}
+		require.NoError(t, rows.Close())
+		require.NoError(t, rows.Err())
+		require.Len(t, states, 2)
+
+		// copy the opaque states into a second key and merge them server-side
+		batch, err := conn.PrepareBatch(ctx, "INSERT INTO test_aggregate_function")
+		require.NoError(t, err)
+		for _, row := range states {
+			require.NoError(t, batch.Append(uint64(2), row.Col2, row.Col3, row.Col4, row.Col5, row.Col6))
+		}
+		require.NoError(t, batch.Send())
+
+		var (
+			count    uint64
+			sum      int64
+			avg      float64
+			distinct uint64
+			argMax   string
+		)
+		require.NoError(t, conn.QueryRow(ctx, `
+		SELECT countMerge(Col2), sumMerge(Col3), avgMerge(Col4), uniqExactMerge(Col5), argMaxMerge(Col6)
+		FROM test_aggregate_function WHERE Col1 = 2
+		`).Scan(&count, &sum, &avg, &distinct, &argMax))
+		assert.Equal(t, uint64(10), count)
+		assert.Equal(t, int64(45), sum)
+		assert.Equal(t, 4.5, avg)
+		assert.Equal(t, uint64(3), distinct)
+		assert.Equal(t, "9", argMax)
+
+		// the states of count, sum, avg and uniqExact can be finalized client-side
+		var (
+			clientCount    uint64
+			clientSum      int64
+			clientAvg      float64
+			clientDistinct uint64
+		)
+		require.NoError(t, conn.QueryRow(ctx, `
+		SELECT countState(), sumState(toInt32(number)), avgState(toFloat64(number)), uniqExactState(toString(number % 3))
+		FROM numbers(10)
+		`).Scan(&clientCount, &clientSum, &clientAvg, &clientDistinct))
+		assert.Equal(t, uint64(10), clientCount)
+		assert.Equal(t, int64(45), clientSum)
+		assert.Equal(t, 4.5, clientAvg)
+		assert.Equal(t, uint64(3), clientDistinct)
+	})
+}
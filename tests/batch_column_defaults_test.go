@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func TestBatchColumnDefaults(t *testing.T) {
+	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
+		conn, err := GetNativeConnection(t, protocol, nil, nil, nil)
+		require.NoError(t, err)
+		ctx := context.Background()
+		const ddl = `
+			CREATE TABLE test_batch_column_defaults (
+				  id      UInt64
+				, name    String DEFAULT concat('name-', toString(id))
+				, raw     String EPHEMERAL
+				, hexed   String DEFAULT hex(raw)
+				, doubled UInt64 MATERIALIZED id * 2
+			) Engine MergeTree() ORDER BY id
+		`
+		require.NoError(t, conn.Exec(ctx, "DROP TABLE IF EXISTS test_batch_column_defaults"))
+		require.NoError(t, conn.Exec(ctx, ddl))
+		defer conn.Exec(ctx, "DROP TABLE IF EXISTS test_batch_column_defaults")
+
+		batch, err := conn.PrepareBatch(ctx, "INSERT INTO test_batch_column_defaults", driver.WithOmitDefaultColumns())
+		require.NoError(t, err)
+		defaults, ok := batch.(driver.DefaultsBatch)
+		require.True(t, ok)
+		var kinds []string
+		for _, d := range defaults.ColumnDefaults() {
+			kinds = append(kinds, d.Name+" "+d.Kind)
+		}
+		assert.Equal(t, []string{"name DEFAULT", "raw EPHEMERAL", "hexed DEFAULT", "doubled MATERIALIZED"}, kinds)
+		assert.Equal(t, driver.ColumnDefault{Name: "hexed", Type: "String", Kind: "DEFAULT", Expression: "hex(raw)"}, defaults.ColumnDefaults()[2])
+		// only id has no default
+		require.NoError(t, batch.Append(uint64(1)))
+		require.NoError(t, batch.Append(uint64(2)))
+		require.NoError(t, batch.Send())
+
+		type record struct {
+			ID  uint64 `ch:"id"`
+			Raw string `ch:"raw"`
+		}
+		batch, err = conn.PrepareBatch(ctx, "INSERT INTO test_batch_column_defaults", driver.WithOmitDefaultColumns())
+		require.NoError(t, err)
+		require.NoError(t, batch.AppendStruct(&record{ID: 3, Raw: "abc"}))
+		require.NoError(t, batch.Send())
+
+		type result struct {
+			ID      uint64 `ch:"id"`
+			Name    string `ch:"name"`
+			Hexed   string `ch:"hexed"`
+			Doubled uint64 `ch:"doubled"`
+		}
+		var results []result
+		require.NoError(t, conn.Select(ctx, &results, "SELECT id, name, hexed, doubled FROM test_batch_column_defaults ORDER BY id"))
+		assert.Equal(t, []result{
+			{ID: 1, Name: "name-1", Doubled: 2},
+			{ID: 2, Name: "name-2", Doubled: 4},
+			{ID: 3, Name: "name-3", Hexed: "616263", Doubled: 6},
+		}, results)
+	})
+}
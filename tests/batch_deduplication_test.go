@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func TestBatchInsertDeduplicationToken(t *testing.T) {
+	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
+		conn, err := GetNativeConnection(t, protocol, nil, nil, nil)
+		require.NoError(t, err)
+		ctx := context.Background()
+		const ddl = `
+			CREATE TABLE test_batch_deduplication (
+				Col1 UInt64
+			) Engine MergeTree() ORDER BY Col1
+			SETTINGS non_replicated_deduplication_window = 100
+		`
+		require.NoError(t, conn.Exec(ctx, "DROP TABLE IF EXISTS test_batch_deduplication"))
+		require.NoError(t, conn.Exec(ctx, ddl))
+		defer conn.Exec(ctx, "DROP TABLE IF EXISTS test_batch_deduplication")
+
+		insert := func(batchID string) {
+			batch, err := conn.PrepareBatch(ctx, "INSERT INTO test_batch_deduplication", driver.WithInsertDeduplicationToken(batchID))
+			require.NoError(t, err)
+			for i := 0; i < 10; i++ {
+				require.NoError(t, batch.Append(uint64(i)))
+			}
+			require.NoError(t, batch.Flush())
+			for i := 10; i < 20; i++ {
+				require.NoError(t, batch.Append(uint64(i)))
+			}
+			require.NoError(t, batch.Send())
+		}
+		count := func() uint64 {
+			var count uint64
+			require.NoError(t, conn.QueryRow(ctx, "SELECT count() FROM test_batch_deduplication").Scan(&count))
+			return count
+		}
+
+		insert("batch-1")
+		assert.Equal(t, uint64(20), count())
+		// sending the same batch again is deduplicated
+		insert("batch-1")
+		assert.Equal(t, uint64(20), count())
+		insert("batch-2")
+		assert.Equal(t, uint64(40), count())
+	})
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func TestBatchMaxBytes(t *testing.T) {
+	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
+		conn, err := GetNativeConnection(t, protocol, nil, nil, nil)
+		require.NoError(t, err)
+		ctx := context.Background()
+		const ddl = `
+			CREATE TABLE test_batch_max_bytes (
+				  Col1 UInt64
+				, Col2 String
+			) Engine MergeTree() ORDER BY Col1
+		`
+		require.NoError(t, conn.Exec(ctx, "DROP TABLE IF EXISTS test_batch_max_bytes"))
+		require.NoError(t, conn.Exec(ctx, ddl))
+		defer conn.Exec(ctx, "DROP TABLE IF EXISTS test_batch_max_bytes")
+
+		value := strings.Repeat("x", 1000)
+		batch, err := conn.PrepareBatch(ctx, "INSERT INTO test_batch_max_bytes", driver.WithFlushOnMaxBytes(10_000))
+		require.NoError(t, err)
+		sized, ok := batch.(driver.SizedBatch)
+		require.True(t, ok)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, batch.Append(uint64(i), value))
+			assert.Less(t, sized.Size(), 10_000+1009)
+		}
+		require.NoError(t, batch.Send())
+		var count uint64
+		require.NoError(t, conn.QueryRow(ctx, "SELECT count() FROM test_batch_max_bytes").Scan(&count))
+		assert.Equal(t, uint64(100), count)
+
+		batch, err = conn.PrepareBatch(ctx, "INSERT INTO test_batch_max_bytes", driver.WithMaxBytes(10_000))
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, batch.Append(uint64(i), value))
+		}
+		assert.ErrorIs(t, batch.Append(uint64(10), value), clickhouse.ErrBatchFull)
+		require.NoError(t, batch.Flush())
+		require.NoError(t, batch.Append(uint64(10), value))
+		require.NoError(t, batch.Send())
+		require.NoError(t, conn.QueryRow(ctx, "SELECT count() FROM test_batch_max_bytes").Scan(&count))
+		assert.Equal(t, uint64(111), count)
+	})
+}
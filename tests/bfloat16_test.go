@@ -102,7 +102,6 @@ func TestCustomBFloat16(t *testing.T) {
 
 func TestBFloat16Flush(t *testing.T) {
 	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
-		SkipOnHTTP(t, protocol, "Flush")
 		conn, err := GetNativeConnection(t, protocol, nil, nil, nil)
 		ctx := context.Background()
 		require.NoError(t, err)
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestClusterDiscovery(t *testing.T) {
+	te, err := GetTestEnvironment(testSet)
+	require.NoError(t, err)
+	opts := ClientOptionsFromEnv(te, clickhouse.Settings{}, false)
+	conn, err := GetConnectionWithOptions(&opts)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var cluster string
+	err = conn.QueryRow(ctx, "SELECT cluster FROM system.clusters WHERE is_local ORDER BY cluster LIMIT 1").Scan(&cluster)
+	if err != nil {
+		t.Skip("the server has no local cluster")
+	}
+	require.NoError(t, conn.Close())
+
+	discovery := clickhouse.NewClusterDiscovery(clickhouse.ClusterDiscoveryOptions{
+		Cluster: cluster,
+		// the cluster may name the server differently than the tests reach it
+		DialStrategy: func(ctx context.Context, connID int, options *clickhouse.Options, dial clickhouse.Dial) (clickhouse.DialResult, error) {
+			return dial(ctx, opts.Addr[0], options)
+		},
+	})
+	opts.DialStrategy = discovery.Dial
+	conn, err = GetConnectionWithOptions(&opts)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.Ping(ctx))
+
+	topology, err := discovery.Topology()
+	require.NoError(t, err)
+	assert.Equal(t, cluster, topology.Cluster)
+	require.NotEmpty(t, topology.Replicas)
+	assert.NotEmpty(t, topology.Shards())
+	for _, replica := range topology.Replicas {
+		assert.NotEmpty(t, replica.Addr)
+		assert.Positive(t, replica.Shard)
+	}
+}
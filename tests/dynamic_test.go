@@ -367,8 +367,6 @@ func TestDynamic_ScanWithType(t *testing.T) {
 
 func TestDynamic_BatchFlush(t *testing.T) {
 	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
-		SkipOnHTTP(t, protocol, "Flush")
-
 		conn := setupDynamicTest(t, protocol)
 		ctx := context.Background()
 
@@ -3,6 +3,7 @@ package tests
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -148,17 +149,140 @@ func TestFormatInsertStripsFormatClause(t *testing.T) {
 	verifyFormatTestTable(t, conn, table)
 }
 
-// TestFormatNativeProtocolUnsupported verifies the sentinel error over the
+// TestFormatNativeRoundTrip streams a table out over the native protocol,
+// where the server renders each row with formatRow() or the client encodes
+// the blocks, and feeds the bytes back in over HTTP.
+func TestFormatNativeRoundTrip(t *testing.T) {
+	for _, format := range []string{"CSV", "CSVWithNames", "TSVWithNamesAndTypes", "JSONEachRow", "JSON", "JSONCompact", "RowBinaryWithNamesAndTypes", "Native"} {
+		t.Run(format, func(t *testing.T) {
+			conn, err := GetNativeConnection(t, clickhouse.Native, nil, nil, nil)
+			require.NoError(t, err)
+			httpConn, err := GetNativeConnection(t, clickhouse.HTTP, nil, nil, nil)
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			source := createFormatTestTable(t, conn, true)
+			dest := createFormatTestTable(t, httpConn, false)
+
+			stream, err := conn.QueryFormat(ctx, format,
+				fmt.Sprintf("SELECT id, name, score, ok, created_at, comment FROM %s ORDER BY id", source))
+			require.NoError(t, err)
+			payload, err := io.ReadAll(stream)
+			require.NoError(t, err)
+			require.NoError(t, stream.Close())
+			require.NotEmpty(t, payload)
+
+			require.NoError(t, httpConn.InsertFormat(ctx, format,
+				fmt.Sprintf("INSERT INTO %s", dest), bytes.NewReader(payload)))
+			verifyFormatTestTable(t, httpConn, dest)
+		})
+	}
+}
+
+// TestFormatNativeInsert streams a table out and back in over the native
+// protocol in the Native format, whose blocks are sent as Data packets.
+func TestFormatNativeInsert(t *testing.T) {
+	conn, err := GetNativeConnection(t, clickhouse.Native, nil, nil, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	source := createFormatTestTable(t, conn, true)
+	dest := createFormatTestTable(t, conn, false)
+
+	stream, err := conn.QueryFormat(ctx, "Native",
+		fmt.Sprintf("SELECT id, name, score, ok, created_at, comment FROM %s ORDER BY id", source))
+	require.NoError(t, err)
+	defer stream.Close()
+	require.NoError(t, conn.InsertFormat(ctx, "Native", fmt.Sprintf("INSERT INTO %s", dest), stream))
+	verifyFormatTestTable(t, conn, dest)
+}
+
+// TestFormatNativeHeader pins that the native protocol produces the same
+// header and rows as HTTP for the formats with names and types.
+func TestFormatNativeHeader(t *testing.T) {
+	conn, err := GetNativeConnection(t, clickhouse.Native, nil, nil, nil)
+	require.NoError(t, err)
+	httpConn, err := GetNativeConnection(t, clickhouse.HTTP, nil, nil, nil)
+	require.NoError(t, err)
+	table := createFormatTestTable(t, conn, true)
+	query := fmt.Sprintf("SELECT id, name, score, ok, created_at, comment FROM %s ORDER BY id", table)
+
+	for _, format := range []string{"CSVWithNames", "TSVWithNamesAndTypes", "JSONCompactEachRowWithNamesAndTypes", "RowBinaryWithNamesAndTypes"} {
+		t.Run(format, func(t *testing.T) {
+			read := func(conn driver.Conn) []byte {
+				stream, err := conn.QueryFormat(context.Background(), format, query)
+				require.NoError(t, err)
+				defer stream.Close()
+				payload, err := io.ReadAll(stream)
+				require.NoError(t, err)
+				return payload
+			}
+			assert.Equal(t, string(read(httpConn)), string(read(conn)))
+		})
+	}
+}
+
+// TestFormatNativeJSON verifies the JSON document written around the rows
+// over the native protocol has the columns and rows HTTP returns.
+func TestFormatNativeJSON(t *testing.T) {
+	conn, err := GetNativeConnection(t, clickhouse.Native, nil, nil, nil)
+	require.NoError(t, err)
+	httpConn, err := GetNativeConnection(t, clickhouse.HTTP, nil, nil, nil)
+	require.NoError(t, err)
+	table := createFormatTestTable(t, conn, true)
+	query := fmt.Sprintf("SELECT id, name, score, ok, created_at, comment FROM %s ORDER BY id", table)
+
+	type document struct {
+		Meta []map[string]string
+		Data []any
+		Rows int
+	}
+	read := func(conn driver.Conn, format string) document {
+		stream, err := conn.QueryFormat(context.Background(), format, query)
+		require.NoError(t, err)
+		defer stream.Close()
+		var doc document
+		require.NoError(t, json.NewDecoder(stream).Decode(&doc))
+		return doc
+	}
+	for _, format := range []string{"JSON", "JSONCompact", "JSONStrings"} {
+		expected := read(httpConn, format)
+		assert.Equal(t, expected, read(conn, format), format)
+		assert.Equal(t, len(formatTestRows), expected.Rows, format)
+	}
+}
+
+// TestFormatNativeCSVContent pins that the native protocol produces the same
+// CSV bytes as HTTP.
+func TestFormatNativeCSVContent(t *testing.T) {
+	expected := "1,\"alice\",3.5,true,\"2026-07-06 10:30:00\",\"first\"\n" +
+		"2,\"bob\",-0.25,false,\"2026-01-01 00:00:00\",\\N\n" +
+		"3,\"carol, \"\"quoted\"\"\",100,true,\"2026-07-06 23:59:59\",\"\\N looks like null\"\n"
+
+	conn, err := GetNativeConnection(t, clickhouse.Native, nil, nil, nil)
+	require.NoError(t, err)
+	table := createFormatTestTable(t, conn, true)
+
+	stream, err := conn.QueryFormat(context.Background(), "CSV",
+		fmt.Sprintf("SELECT id, name, score, ok, created_at, comment FROM %s ORDER BY id", table))
+	require.NoError(t, err)
+	defer stream.Close()
+	payload, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(payload))
+}
+
+// TestFormatNativeProtocolUnsupported verifies the sentinel error for inserts
+// in formats other than Native and block formats without an encoder over the
 // native protocol and that the pool stays healthy after the rejected calls.
 func TestFormatNativeProtocolUnsupported(t *testing.T) {
 	conn, err := GetNativeConnection(t, clickhouse.Native, nil, nil, nil)
 	require.NoError(t, err)
 	ctx := context.Background()
 
-	_, err = conn.QueryFormat(ctx, "CSV", "SELECT 1")
+	_, err = conn.QueryFormat(ctx, "Parquet", "SELECT 1")
 	require.ErrorIs(t, err, clickhouse.ErrFormatNativeUnsupported)
-
-	err = conn.InsertFormat(ctx, "CSV", "INSERT INTO t", strings.NewReader(""))
+	err = conn.InsertFormat(ctx, "CSV", "INSERT INTO t", strings.NewReader("1\n"))
 	require.ErrorIs(t, err, clickhouse.ErrFormatNativeUnsupported)
 
 	require.NoError(t, conn.Exec(ctx, "SELECT 1"))
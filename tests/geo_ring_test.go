@@ -70,7 +70,6 @@ func TestGeoRing(t *testing.T) {
 
 func TestGeoRingFlush(t *testing.T) {
 	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
-		SkipOnHTTP(t, protocol, "Flush")
 		conn, err := GetNativeConnection(t, protocol, clickhouse.Settings{
 			"allow_experimental_geo_types": 1,
 		}, nil, &clickhouse.Compression{
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestHTTPSession(t *testing.T) {
+	conn, err := GetNativeConnection(t, clickhouse.HTTP, nil, nil, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	session := clickhouse.Context(context.Background(),
+		clickhouse.WithSessionID(uuid.NewString()),
+		clickhouse.WithSessionTimeout(time.Minute),
+	)
+	require.NoError(t, conn.Exec(session, "CREATE TEMPORARY TABLE test_http_session (Col1 UInt8)"))
+	require.NoError(t, conn.Exec(session, "SET max_block_size = 4242"))
+	require.NoError(t, conn.Exec(session, "INSERT INTO test_http_session VALUES (1), (2)"))
+
+	var count uint64
+	require.NoError(t, conn.QueryRow(session, "SELECT count() FROM test_http_session").Scan(&count))
+	assert.Equal(t, uint64(2), count)
+
+	var blockSize string
+	require.NoError(t, conn.QueryRow(session, "SELECT getSetting('max_block_size')").Scan(&blockSize))
+	assert.Equal(t, "4242", blockSize)
+
+	batch, err := conn.PrepareBatch(session, "INSERT INTO test_http_session")
+	require.NoError(t, err)
+	require.NoError(t, batch.Append(uint8(3)))
+	require.NoError(t, batch.Send())
+	require.NoError(t, conn.QueryRow(session, "SELECT count() FROM test_http_session").Scan(&count))
+	assert.Equal(t, uint64(3), count)
+
+	// outside the session the temporary table doesn't exist
+	assert.Error(t, conn.Exec(context.Background(), "SELECT count() FROM test_http_session"))
+
+	// session_check rejects a session the server doesn't know
+	unknown := clickhouse.Context(context.Background(),
+		clickhouse.WithSessionID(uuid.NewString()),
+		clickhouse.WithSessionCheck(true),
+	)
+	assert.Error(t, conn.Exec(unknown, "SELECT 1"))
+}
@@ -364,7 +364,6 @@ func TestJSONString(t *testing.T) {
 
 func TestJSON_BatchFlush(t *testing.T) {
 	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
-		SkipOnHTTP(t, protocol, "Flush")
 		conn := setupJSONTest(t, protocol)
 		ctx := context.Background()
 
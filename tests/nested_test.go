@@ -257,7 +257,6 @@ func TestNestedUnFlattened(t *testing.T) {
 
 func TestNestedFlush(t *testing.T) {
 	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
-		SkipOnHTTP(t, protocol, "Flush")
 		conn, err := GetNativeConnection(t, protocol, clickhouse.Settings{
 			"flatten_nested": 0,
 		}, nil, &clickhouse.Compression{
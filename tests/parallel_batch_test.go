@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestParallelBatch(t *testing.T) {
+	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
+		conn, err := GetNativeConnection(t, protocol, nil, nil, nil)
+		require.NoError(t, err)
+		ctx := context.Background()
+		const ddl = `
+			CREATE TABLE test_parallel_batch (
+				  Col1 UInt64
+				, Col2 String
+			) Engine MergeTree() ORDER BY Col1
+		`
+		require.NoError(t, conn.Exec(ctx, "DROP TABLE IF EXISTS test_parallel_batch"))
+		require.NoError(t, conn.Exec(ctx, ddl))
+		defer conn.Exec(ctx, "DROP TABLE IF EXISTS test_parallel_batch")
+
+		batch, err := clickhouse.PrepareParallelBatch(ctx, conn, "INSERT INTO test_parallel_batch", 3)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, batch.Append(uint64(i), "value"))
+		}
+		results, err := batch.Send()
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		for _, result := range results {
+			assert.NoError(t, result.Err)
+			assert.InDelta(t, 333, result.Rows, 1)
+		}
+
+		var count, sum uint64
+		require.NoError(t, conn.QueryRow(ctx, "SELECT count(), sum(Col1) FROM test_parallel_batch").Scan(&count, &sum))
+		assert.Equal(t, uint64(1000), count)
+		assert.Equal(t, uint64(999*1000/2), sum)
+	})
+}
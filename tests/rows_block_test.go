@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func TestRowsNextBlock(t *testing.T) {
+	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
+		conn, err := GetNativeConnection(t, protocol, clickhouse.Settings{
+			"max_block_size": 1000,
+		}, nil, nil)
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		result, err := conn.Query(ctx, "SELECT number, toString(number) AS str FROM system.numbers LIMIT 10000")
+		require.NoError(t, err)
+		defer result.Close()
+		rows, ok := result.(driver.BlockRows)
+		require.True(t, ok)
+
+		var (
+			blocks int
+			sum    uint64
+			count  int
+		)
+		for rows.NextBlock() {
+			block := rows.Block()
+			blocks++
+			numbers, err := clickhouse.ColumnValues[uint64](block.ColumnByName("number"))
+			require.NoError(t, err)
+			strs, err := clickhouse.ColumnValues[string](block.ColumnByName("str"))
+			require.NoError(t, err)
+			require.Len(t, strs, len(numbers))
+			for _, n := range numbers {
+				sum += n
+			}
+			count += block.Rows()
+		}
+		require.NoError(t, rows.Err())
+		assert.Equal(t, 10000, count)
+		assert.Equal(t, uint64(10000*9999/2), sum)
+		assert.Greater(t, blocks, 1)
+	})
+}
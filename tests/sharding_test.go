@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestShardedBatch(t *testing.T) {
+	te, err := GetTestEnvironment(testSet)
+	require.NoError(t, err)
+	opts := ClientOptionsFromEnv(te, clickhouse.Settings{}, false)
+	// both shards are the test server, the rows they receive are compared
+	// with the shards the server computes for them
+	conn, err := clickhouse.OpenSharded(&opts, []clickhouse.Shard{
+		{Addr: opts.Addr},
+		{Addr: opts.Addr, Weight: 2},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+	const ddl = `
+		CREATE TABLE test_sharded_batch (
+			  Col1 Int32
+			, Col2 LowCardinality(String)
+		) Engine Memory
+	`
+	require.NoError(t, conn.Shard(0).Exec(ctx, "DROP TABLE IF EXISTS test_sharded_batch"))
+	require.NoError(t, conn.Shard(0).Exec(ctx, ddl))
+	defer conn.Shard(0).Exec(ctx, "DROP TABLE IF EXISTS test_sharded_batch")
+
+	for _, tc := range []struct {
+		key  clickhouse.ShardingKey
+		expr string
+	}{
+		{clickhouse.ShardingKey{Column: "Col2"}, "cityHash64(Col2)"},
+		{clickhouse.ShardingKey{Column: "Col1"}, "cityHash64(Col1)"},
+		{clickhouse.ShardingKey{Column: "Col2", Hash: clickhouse.XXHash64}, "xxHash64(Col2)"},
+		{clickhouse.ShardingKey{Column: "Col1", Hash: clickhouse.XXHash64}, "xxHash64(Col1)"},
+		{clickhouse.ShardingKey{Column: "Col1", Hash: clickhouse.NoHash}, "reinterpretAsUInt32(Col1)"},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			require.NoError(t, conn.Shard(0).Exec(ctx, "TRUNCATE TABLE test_sharded_batch"))
+			batch, err := conn.PrepareBatch(ctx, "INSERT INTO test_sharded_batch", tc.key)
+			require.NoError(t, err)
+			for i := -500; i < 500; i++ {
+				require.NoError(t, batch.Append(int32(i), fmt.Sprintf("value_%d", i)))
+			}
+			results, err := batch.Send()
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+
+			var first, second uint64
+			query := fmt.Sprintf("SELECT countIf(%[1]s %% 3 = 0), countIf(%[1]s %% 3 != 0) FROM test_sharded_batch", tc.expr)
+			require.NoError(t, conn.Shard(0).QueryRow(ctx, query).Scan(&first, &second))
+			assert.Equal(t, int(first), results[0].Rows)
+			assert.Equal(t, int(second), results[1].Rows)
+			assert.Equal(t, 1000, results[0].Rows+results[1].Rows)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestSSHKeyAuth(t *testing.T) {
+	te, err := GetTestEnvironment(testSet)
+	require.NoError(t, err)
+	opts := ClientOptionsFromEnv(te, clickhouse.Settings{}, false)
+	conn, err := GetConnectionWithOptions(&opts)
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	// the authorized key is the key type followed by the base64 key
+	authorizedKey := strings.Fields(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	username := fmt.Sprintf("ssh_user_%s", RandAsciiString(6))
+	err = conn.Exec(ctx, fmt.Sprintf("CREATE USER %s IDENTIFIED WITH ssh_key BY KEY '%s' TYPE '%s'", username, authorizedKey[1], authorizedKey[0]))
+	if err != nil {
+		t.Skipf("the server does not support SSH keys: %s", err)
+	}
+	defer conn.Exec(ctx, fmt.Sprintf("DROP USER IF EXISTS %s", username))
+
+	sshOpts := opts
+	sshOpts.Auth = clickhouse.Auth{Username: username, SSHSigner: signer}
+	sshConn, err := clickhouse.Open(&sshOpts)
+	require.NoError(t, err)
+	defer sshConn.Close()
+	var user string
+	require.NoError(t, sshConn.QueryRow(ctx, "SELECT currentUser()").Scan(&user))
+	assert.Equal(t, username, user)
+
+	// another key is rejected
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshOpts.Auth.SSHSigner, err = ssh.NewSignerFromKey(otherKey)
+	require.NoError(t, err)
+	otherConn, err := clickhouse.Open(&sshOpts)
+	require.NoError(t, err)
+	defer otherConn.Close()
+	exception := new(clickhouse.Exception)
+	require.ErrorAs(t, otherConn.Ping(ctx), &exception)
+	assert.Equal(t, int32(516), exception.Code)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 )
 
 func TestWithTotals(t *testing.T) {
@@ -53,3 +54,48 @@ func TestWithTotals(t *testing.T) {
 		require.NoError(t, rows.Err())
 	})
 }
+
+func TestWithExtremes(t *testing.T) {
+	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
+		if protocol == clickhouse.HTTP {
+			t.Skip("Only test Extremes for Native")
+		}
+
+		conn, err := GetNativeConnection(t, protocol, nil, nil, nil)
+		require.NoError(t, err)
+		ctx := clickhouse.Context(context.Background(), clickhouse.WithSettings(clickhouse.Settings{
+			"extremes": 1,
+		}))
+		const query = `
+		SELECT
+			number % 10 AS n
+			, COUNT()
+		FROM numbers(100)
+		GROUP BY n WITH TOTALS
+		`
+		rows, err := conn.Query(ctx, query)
+		require.NoError(t, err)
+
+		var count int
+		for rows.Next() {
+			count++
+		}
+		require.Equal(t, 10, count)
+		var (
+			n, totals        uint64
+			minN, maxN       uint64
+			minCnt, maxCount uint64
+		)
+		require.NoError(t, rows.Totals(&n, &totals))
+		assert.Equal(t, uint64(100), totals)
+		extremes, ok := rows.(driver.ExtremesRows)
+		require.True(t, ok)
+		require.NoError(t, extremes.Extremes([]any{&minN, &minCnt}, []any{&maxN, &maxCount}))
+		assert.Equal(t, uint64(0), minN)
+		assert.Equal(t, uint64(9), maxN)
+		assert.Equal(t, uint64(10), minCnt)
+		assert.Equal(t, uint64(10), maxCount)
+		require.NoError(t, rows.Close())
+		require.NoError(t, rows.Err())
+	})
+}
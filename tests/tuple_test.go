@@ -647,7 +647,6 @@ func TestColumnarTuple(t *testing.T) {
 
 func TestTupleFlush(t *testing.T) {
 	TestProtocols(t, func(t *testing.T, protocol clickhouse.Protocol) {
-		SkipOnHTTP(t, protocol, "Flush")
 		conn, err := GetNativeConnection(t, protocol, nil, nil, nil)
 		ctx := context.Background()
 		require.NoError(t, err)
@@ -0,0 +1,143 @@
+package clickhouse
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// tlsFiles loads the client certificate and CA certificates of Options from
+// their files, reading them again when they change.
+type tlsFiles struct {
+	certFile, keyFile, caFile string
+
+	mu    sync.Mutex
+	stamp [3]fileStamp
+	cert  *tls.Certificate
+	roots *x509.CertPool
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newTLSFiles(o *Options) *tlsFiles {
+	if o.TLSCertFile == "" && o.TLSKeyFile == "" && o.TLSCAFile == "" {
+		return nil
+	}
+	return &tlsFiles{certFile: o.TLSCertFile, keyFile: o.TLSKeyFile, caFile: o.TLSCAFile}
+}
+
+// config returns a copy of base with the certificates of the files, reloading
+// those that changed since the last call. The client certificate is also
+// checked on each handshake, as the HTTP transports keep the configuration
+// they are created with.
+func (f *tlsFiles) config(base *tls.Config) (*tls.Config, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.loadCertificate(); err != nil {
+		return nil, err
+	}
+	if err := f.loadRoots(); err != nil {
+		return nil, err
+	}
+	config := base.Clone()
+	if f.cert != nil {
+		config.Certificates = nil
+		config.GetClientCertificate = f.clientCertificate
+	}
+	if f.roots != nil {
+		config.RootCAs = f.roots
+	}
+	return config, nil
+}
+
+// clientCertificate is the GetClientCertificate of the configurations, so a
+// rotated certificate is sent by the next handshake.
+func (f *tlsFiles) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.loadCertificate(); err != nil {
+		return nil, err
+	}
+	return f.cert, nil
+}
+
+// loadCertificate loads the client certificate if its files changed.
+// Must be called with f.mu held.
+func (f *tlsFiles) loadCertificate() error {
+	if f.certFile == "" {
+		return nil
+	}
+	certStamp, err := statFile(f.certFile)
+	if err != nil {
+		return err
+	}
+	keyStamp, err := statFile(f.keyFile)
+	if err != nil {
+		return err
+	}
+	if f.cert != nil && certStamp == f.stamp[0] && keyStamp == f.stamp[1] {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return fmt.Errorf("clickhouse [tls]: load client certificate: %w", err)
+	}
+	f.cert, f.stamp[0], f.stamp[1] = &cert, certStamp, keyStamp
+	return nil
+}
+
+// loadRoots loads the CA certificates if their file changed.
+// Must be called with f.mu held.
+func (f *tlsFiles) loadRoots() error {
+	if f.caFile == "" {
+		return nil
+	}
+	stamp, err := statFile(f.caFile)
+	if err != nil {
+		return err
+	}
+	if f.roots != nil && stamp == f.stamp[2] {
+		return nil
+	}
+	pem, err := os.ReadFile(f.caFile)
+	if err != nil {
+		return fmt.Errorf("clickhouse [tls]: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("clickhouse [tls]: no certificate found in %s", f.caFile)
+	}
+	f.roots, f.stamp[2] = roots, stamp
+	return nil
+}
+
+func statFile(name string) (fileStamp, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("clickhouse [tls]: %w", err)
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// tlsConfig returns the TLS configuration new connections are dialed with.
+func (o *Options) tlsConfig() (*tls.Config, error) {
+	if o.tlsFiles == nil || o.TLS == nil {
+		return o.TLS, nil
+	}
+	return o.tlsFiles.config(o.TLS)
+}
+
+// checkCertificateAuth reports whether Auth.CertificateAuth is set without TLS.
+func (o *Options) checkCertificateAuth() error {
+	if o.Auth.CertificateAuth && o.TLS == nil {
+		return ErrCertificateAuthWithoutTLS
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate is a certificate and its key, signed by the parent or self
+// signed.
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer := &testCertificate{cert: template, key: key}
+	if parent != nil {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{cert: cert, key: key}
+}
+
+// write writes the PEM certificate and key to dir as name.crt and name.key.
+func (c *testCertificate) write(t *testing.T, dir, name string) {
+	t.Helper()
+	key, err := x509.MarshalPKCS8PrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600))
+}
+
+func TestTLSFiles(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		ca     = newTestCertificate(t, "ca", nil)
+		client = newTestCertificate(t, "client", ca)
+	)
+	ca.write(t, dir, "ca")
+	client.write(t, dir, "client")
+	opt := (&Options{
+		TLSCertFile: filepath.Join(dir, "client.crt"),
+		TLSKeyFile:  filepath.Join(dir, "client.key"),
+		TLSCAFile:   filepath.Join(dir, "ca.crt"),
+	}).setDefaults()
+	require.NotNil(t, opt.TLS, "the files imply TLS")
+
+	config, err := opt.tlsConfig()
+	require.NoError(t, err)
+	cert, err := config.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, client.cert.Raw, cert.Certificate[0])
+	assert.True(t, config.RootCAs.Equal(func() *x509.CertPool {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		return roots
+	}()))
+	assert.Empty(t, opt.TLS.Certificates, "the configuration of the options is not changed")
+
+	// a rotated certificate is sent by the next handshakes, also with the
+	// configuration an HTTP transport was created with
+	rotated := newTestCertificate(t, "rotated", ca)
+	rotated.write(t, dir, "client")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "client.crt"), later, later))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "client.key"), later, later))
+	cert, err = config.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, rotated.cert.Raw, cert.Certificate[0])
+
+	require.NoError(t, os.WriteFile(opt.TLSCAFile, []byte("not a certificate"), 0o600))
+	_, err = opt.tlsConfig()
+	assert.ErrorContains(t, err, "no certificate found")
+}
+
+func TestCertificateAuthWithoutTLS(t *testing.T) {
+	_, err := Open(&Options{Auth: Auth{CertificateAuth: true}})
+	assert.ErrorIs(t, err, ErrCertificateAuthWithoutTLS)
+	_, err = Connector(&Options{Auth: Auth{CertificateAuth: true}}).Connect(context.Background())
+	assert.ErrorIs(t, err, ErrCertificateAuthWithoutTLS)
+}
+
+func TestCertificateAuthHTTP(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		ca     = newTestCertificate(t, "ca", nil)
+		server = newTestCertificate(t, "server", ca)
+		client = newTestCertificate(t, "client", ca)
+	)
+	ca.write(t, dir, "ca")
+	client.write(t, dir, "client")
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	var header http.Header
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.cert.Raw}, PrivateKey: server.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    roots,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	opt := (&Options{
+		Protocol:    HTTP,
+		Auth:        Auth{Username: "user", Password: "unused", CertificateAuth: true},
+		TLSCertFile: filepath.Join(dir, "client.crt"),
+		TLSKeyFile:  filepath.Join(dir, "client.key"),
+		TLSCAFile:   filepath.Join(dir, "ca.crt"),
+	}).setDefaults()
+	rt, err := createHTTPRoundTripper(opt)
+	require.NoError(t, err)
+	h := newTestHTTPConnect(t, srv.URL)
+	h.opt, h.client = opt, &http.Client{Transport: rt}
+
+	require.NoError(t, h.exec(context.Background(), "SELECT 1"))
+	assert.Equal(t, "user", header.Get("X-ClickHouse-User"))
+	assert.Equal(t, "on", header.Get("X-ClickHouse-SSL-Certificate-Auth"))
+	assert.Empty(t, header.Get("X-ClickHouse-Key"))
+}
+
+func TestCertificateAuthNative(t *testing.T) {
+	// the fake server accepts the empty password only; the options dial
+	// their own connection, so no certificate is needed
+	opt := (&Options{
+		TLS:         &tls.Config{},
+		Auth:        Auth{Username: "user", Password: "unused", CertificateAuth: true},
+		DialContext: fakeNativeAuth(""),
+	}).setDefaults()
+	conn, err := dial(context.Background(), "fake:9440", 1, opt)
+	require.NoError(t, err)
+	conn.close()
+}